@@ -0,0 +1,454 @@
+package admin
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/certs"
+	"github.com/crit/fake-ops/internal/journal"
+	"github.com/crit/fake-ops/internal/jwt"
+	"github.com/crit/fake-ops/internal/mailbox"
+	"github.com/crit/fake-ops/internal/services"
+	"github.com/crit/fake-ops/internal/verify"
+	"github.com/gin-gonic/gin"
+)
+
+// Start creates the admin HTTP server and manages it's lifecycle.
+func Start(ctx *app.Context, m *services.Manager) {
+	server := &http.Server{
+		Addr:    ctx.Flags.Admin,
+		Handler: New(ctx, m),
+	}
+
+	go func() {
+		ctx.PublishInfo("starting admin api %s", ctx.Flags.Admin)
+
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ctx.PublishError("admin api error: %s", err)
+		}
+	}()
+
+	// wait for termination
+	<-ctx.Done()
+
+	if err := server.Close(); err != nil {
+		ctx.PublishError("error stopping admin api: %s", err)
+	}
+}
+
+// New creates the admin API handler.
+func New(ctx *app.Context, m *services.Manager) http.Handler {
+	a := api{ctx: ctx, m: m}
+
+	g := gin.New()
+	g.GET("/services", a.listServices)
+	g.GET("/services/:name", a.getService)
+	g.POST("/services/:name/start", a.startService)
+	g.POST("/services/:name/stop", a.stopService)
+	g.GET("/services/:name/routes", a.listRoutes)
+	g.GET("/services/:name/journal", a.listJournal)
+	g.DELETE("/services/:name/journal", a.clearJournal)
+	g.GET("/services/:name/journal/export", a.exportJournal)
+	g.POST("/services/:name/verify", a.verify)
+	g.GET("/services/:name/messages", a.listMessages)
+	g.DELETE("/services/:name/messages", a.clearMessages)
+	g.GET("/services/:name/messages/:id", a.getMessage)
+	g.GET("/services/:name/messages/:id/raw", a.getRawMessage)
+	g.GET("/services/:name/messages/:id/attachments/:index", a.getAttachment)
+	g.GET("/scenario", a.getScenario)
+	g.PUT("/scenario", a.putScenario)
+	g.POST("/reset", a.reset)
+	g.POST("/certs/client", a.issueClientCert)
+	g.POST("/tokens", a.issueToken)
+	g.GET("/tokens/jwks", a.getJWKS)
+
+	return g
+}
+
+type api struct {
+	ctx *app.Context
+	m   *services.Manager
+}
+
+type scenarioBody struct {
+	Active    string   `json:"active"`
+	Available []string `json:"available"`
+}
+
+func (a api) listServices(c *gin.Context) {
+	c.JSON(http.StatusOK, a.m.Services())
+}
+
+func (a api) getService(c *gin.Context) {
+	info, err := a.m.Service(c.Param("name"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (a api) startService(c *gin.Context) {
+	if err := a.m.StartService(c.Param("name")); err != nil {
+		fail(c, err)
+		return
+	}
+
+	a.getService(c)
+}
+
+func (a api) stopService(c *gin.Context) {
+	if err := a.m.StopService(c.Param("name")); err != nil {
+		fail(c, err)
+		return
+	}
+
+	a.getService(c)
+}
+
+func (a api) listRoutes(c *gin.Context) {
+	rt, err := a.m.Runtime(c.Param("name"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rt.Routes())
+}
+
+func (a api) listJournal(c *gin.Context) {
+	rt, err := a.m.Runtime(c.Param("name"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	q := journal.Query{
+		Method: c.Query("method"),
+		Path:   c.Query("path"),
+	}
+
+	if since := c.Query("since"); since != "" {
+		if q.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since: " + since})
+			return
+		}
+	}
+
+	if after := c.Query("after"); after != "" {
+		if q.AfterID, err = strconv.ParseInt(after, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after: " + after})
+			return
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + limit})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, rt.Journal.Entries(q))
+}
+
+func (a api) clearJournal(c *gin.Context) {
+	rt, err := a.m.Runtime(c.Param("name"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	rt.Journal.Clear()
+	c.Status(http.StatusNoContent)
+}
+
+func (a api) exportJournal(c *gin.Context) {
+	rt, err := a.m.Runtime(c.Param("name"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-journal-%s.json", c.Param("name"), time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+
+	if err := rt.Journal.Export(c.Writer); err != nil {
+		a.ctx.PublishError("failed to export journal for %s: %s", c.Param("name"), err)
+	}
+}
+
+func (a api) verify(c *gin.Context) {
+	rt, err := a.m.Runtime(c.Param("name"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	var v verify.Verification
+	if err := c.ShouldBindJSON(&v); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := verify.Verify(rt.Journal.Entries(journal.Query{}), v)
+	if !report.OK {
+		c.JSON(http.StatusConflict, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func (a api) listMessages(c *gin.Context) {
+	rt, err := a.m.Runtime(c.Param("name"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	q := mailbox.Query{
+		From:    c.Query("from"),
+		To:      c.Query("to"),
+		Subject: c.Query("subject"),
+	}
+
+	if after := c.Query("after"); after != "" {
+		if q.AfterID, err = strconv.ParseInt(after, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after: " + after})
+			return
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + limit})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, rt.Mailbox.Messages(q))
+}
+
+func (a api) clearMessages(c *gin.Context) {
+	rt, err := a.m.Runtime(c.Param("name"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	if err := rt.Mailbox.Clear(); err != nil {
+		fail(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (a api) getMessage(c *gin.Context) {
+	if m := a.message(c); m != nil {
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+func (a api) getRawMessage(c *gin.Context) {
+	if m := a.message(c); m != nil {
+		c.Data(http.StatusOK, "message/rfc822", m.Raw)
+	}
+}
+
+func (a api) getAttachment(c *gin.Context) {
+	m := a.message(c)
+	if m == nil {
+		return
+	}
+
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 || index >= len(m.Attachments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown attachment: " + c.Param("index")})
+		return
+	}
+
+	attachment := m.Attachments[index]
+	if attachment.Filename != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.Filename))
+	}
+
+	c.Data(http.StatusOK, attachment.ContentType, attachment.Content)
+}
+
+// message looks up the message named by the request, writing an error
+// response when there is none.
+func (a api) message(c *gin.Context) *mailbox.Message {
+	rt, err := a.m.Runtime(c.Param("name"))
+	if err != nil {
+		fail(c, err)
+		return nil
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id: " + c.Param("id")})
+		return nil
+	}
+
+	m := rt.Mailbox.Message(id)
+	if m == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown message: " + c.Param("id")})
+	}
+
+	return m
+}
+
+func (a api) getScenario(c *gin.Context) {
+	c.JSON(http.StatusOK, scenarioBody{
+		Active:    a.ctx.Scenario(),
+		Available: a.ctx.Scenarios(),
+	})
+}
+
+func (a api) putScenario(c *gin.Context) {
+	var body struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := a.ctx.SwitchScenario(body.Name); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	a.getScenario(c)
+}
+
+func (a api) reset(c *gin.Context) {
+	if err := a.m.Reset(); err != nil {
+		fail(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (a api) issueClientCert(c *gin.Context) {
+	var body struct {
+		CommonName   string   `json:"commonName"`
+		Organization []string `json:"organization"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.CommonName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "commonName is required"})
+		return
+	}
+
+	ca, err := certs.LoadAuthority(a.ctx.Flags.Certs)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	cert, err := ca.IssueClient(body.CommonName, body.Organization)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	certPEM, keyPEM, err := certs.EncodePEM(cert)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subject": cert.Leaf.Subject.String(),
+		"cert":    string(certPEM),
+		"key":     string(keyPEM),
+		"ca":      caPEM(ca),
+	})
+}
+
+func (a api) issueToken(c *gin.Context) {
+	var body struct {
+		Claims    jwt.Claims `json:"claims"`
+		ExpiresIn string     `json:"expiresIn"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expiresIn := time.Hour
+	if body.ExpiresIn != "" {
+		d, err := time.ParseDuration(body.ExpiresIn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expiresIn: " + err.Error()})
+			return
+		}
+		expiresIn = d
+	}
+
+	key, err := jwt.LoadKey(a.ctx.Flags.Certs)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	claims := jwt.Claims{}
+	for k, v := range body.Claims {
+		claims[k] = v
+	}
+
+	now := time.Now()
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = now.Unix()
+	}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = now.Add(expiresIn).Unix()
+	}
+
+	token, err := key.Sign(claims)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "claims": claims})
+}
+
+func (a api) getJWKS(c *gin.Context) {
+	key, err := jwt.LoadKey(a.ctx.Flags.Certs)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, key.JWKS())
+}
+
+// caPEM encodes the certificate of the local certificate authority.
+func caPEM(ca *certs.Authority) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw}))
+}
+
+// fail writes err as a JSON error response.
+func fail(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrUnknownService) {
+		status = http.StatusNotFound
+	}
+
+	c.JSON(status, gin.H{"error": err.Error()})
+}
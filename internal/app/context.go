@@ -11,7 +11,9 @@ import (
 // Context handles communicating to the UI and processing flags.
 type Context struct {
 	context.Context
-	publish func(msg tea.Msg)
+	publish   func(msg tea.Msg)
+	scenarios *scenarios
+	statuses  *statuses
 
 	Flags Flags
 }
@@ -25,9 +27,25 @@ func NewContext(sender func(msg tea.Msg)) (*Context, func()) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Context{
-		Context: ctx,
-		publish: sender,
-		Flags:   flags,
+		Context:   ctx,
+		publish:   sender,
+		scenarios: &scenarios{},
+		statuses:  &statuses{status: make(map[string]string)},
+		Flags:     flags,
+	}, cancel
+}
+
+// WithCancel creates a child Context that can be cancelled on its own while
+// still communicating with the same UI.
+func (ctx *Context) WithCancel() (*Context, func()) {
+	child, cancel := context.WithCancel(ctx.Context)
+
+	return &Context{
+		Context:   child,
+		publish:   ctx.publish,
+		scenarios: ctx.scenarios,
+		statuses:  ctx.statuses,
+		Flags:     ctx.Flags,
 	}, cancel
 }
 
@@ -47,13 +65,34 @@ func (ctx *Context) PublishError(msg string, args ...any) {
 	)
 }
 
+// PublishFake sends a Message to the UI about a request answered by a
+// response file.
+func (ctx *Context) PublishFake(msg string, args ...any) {
+	ctx.publish(Message{
+		Kind:  FakeKind,
+		Value: fmt.Sprintf(msg, args...)},
+	)
+}
+
+// PublishProxy sends a Message to the UI about a request forwarded to an
+// upstream.
+func (ctx *Context) PublishProxy(msg string, args ...any) {
+	ctx.publish(Message{
+		Kind:  ProxyKind,
+		Value: fmt.Sprintf(msg, args...)},
+	)
+}
+
 // PublishService sends a ServiceMessage to the UI. Registering the service
-// with the UI.
-func (ctx *Context) PublishService(kind, name string, port int) {
+// with the UI. Addresses are given when the service listens somewhere other
+// than its port on all interfaces.
+func (ctx *Context) PublishService(kind, name string, port int, addresses ...string) {
+	ctx.statuses.set(name, "offline")
 	ctx.publish(ServiceMessage{
 		Kind:       kind,
 		Name:       name,
 		Port:       port,
+		Addresses:  addresses,
 		Status:     "offline",
 		LastStatus: time.Now(),
 	})
@@ -62,6 +101,7 @@ func (ctx *Context) PublishService(kind, name string, port int) {
 // PublishServiceOnline sends a ServiceStatus to the UI indicating that the
 // service is online.
 func (ctx *Context) PublishServiceOnline(name string) {
+	ctx.statuses.set(name, "online")
 	ctx.publish(ServiceStatus{
 		Sent:   time.Now(),
 		Name:   name,
@@ -72,6 +112,7 @@ func (ctx *Context) PublishServiceOnline(name string) {
 // PublishServiceOffline sends a ServiceStatus to the UI indicating that the
 // service is offline.
 func (ctx *Context) PublishServiceOffline(name string) {
+	ctx.statuses.set(name, "offline")
 	ctx.publish(ServiceStatus{
 		Sent:   time.Now(),
 		Name:   name,
@@ -82,6 +123,7 @@ func (ctx *Context) PublishServiceOffline(name string) {
 // PublishServiceError sends a ServiceStatus to the UI indicating that the
 // service is currently erroring.
 func (ctx *Context) PublishServiceError(name string) {
+	ctx.statuses.set(name, "error")
 	ctx.publish(ServiceStatus{
 		Sent:   time.Now(),
 		Name:   name,
@@ -2,6 +2,8 @@ package app
 
 import (
 	"flag"
+	"os"
+	"path/filepath"
 	"sync"
 )
 
@@ -9,6 +11,9 @@ import (
 type Flags struct {
 	Services string
 	Results  string
+	Scenario string
+	Admin    string
+	Certs    string
 }
 
 // Parse handles loading flags passed to this program on startup.
@@ -18,9 +23,26 @@ func (f *Flags) Parse() {
 	once.Do(func() {
 		svc := flag.String("services", "./services", "directory containing service definitions")
 		res := flag.String("results", "./results", "directory containing service results")
+		scn := flag.String("scenario", "", "scenario to activate on startup")
+		adm := flag.String("admin", "", "address for the admin API, e.g. :4000 (disabled when empty)")
+		crt := flag.String("certs", defaultCerts(), "directory for the local certificate authority")
 		flag.Parse()
 
 		f.Services = *svc
 		f.Results = *res
+		f.Scenario = *scn
+		f.Admin = *adm
+		f.Certs = *crt
 	})
 }
+
+// defaultCerts keeps the local certificate authority in the user's cache
+// directory, outside of any project its keys could be committed with.
+func defaultCerts() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "fake-ops", "certs")
+}
@@ -7,6 +7,8 @@ type MessageKind string
 const (
 	ErrorKind MessageKind = "error"
 	InfoKind  MessageKind = "info"
+	FakeKind  MessageKind = "fake"
+	ProxyKind MessageKind = "proxy"
 )
 
 // Message communicates log information.
@@ -24,6 +26,7 @@ type ServiceMessage struct {
 	Kind       string
 	Name       string
 	Port       int
+	Addresses  []string
 	Status     string
 	LastStatus time.Time
 }
@@ -34,3 +37,10 @@ type ServiceStatus struct {
 	Name   string
 	Status string
 }
+
+// ScenarioMessage communicates the active scenario and the scenarios
+// available to switch to.
+type ScenarioMessage struct {
+	Active    string
+	Available []string
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// scenarios tracks the active scenario and who needs to know when it changes.
+type scenarios struct {
+	mu        sync.Mutex
+	active    string
+	available []string
+	listeners []func(name string)
+}
+
+// Scenario returns the name of the active scenario. An empty name means no
+// scenario is active and services run from their base results.
+func (ctx *Context) Scenario() string {
+	ctx.scenarios.mu.Lock()
+	defer ctx.scenarios.mu.Unlock()
+
+	return ctx.scenarios.active
+}
+
+// SetScenarios registers the scenarios available to switch to and activates
+// the scenario given by the --scenario flag. An unknown scenario leaves the
+// base results active.
+func (ctx *Context) SetScenarios(names []string) error {
+	var err error
+
+	ctx.scenarios.mu.Lock()
+	ctx.scenarios.available = names
+
+	name := ctx.Flags.Scenario
+	if name != "" && !slices.Contains(names, name) {
+		err = fmt.Errorf("unknown scenario: %s", name)
+		name = ""
+	}
+
+	ctx.scenarios.active = name
+	ctx.scenarios.mu.Unlock()
+
+	ctx.publishScenario()
+	return err
+}
+
+// Scenarios returns the names of all scenarios available to switch to.
+func (ctx *Context) Scenarios() []string {
+	ctx.scenarios.mu.Lock()
+	defer ctx.scenarios.mu.Unlock()
+
+	return slices.Clone(ctx.scenarios.available)
+}
+
+// SwitchScenario activates the named scenario and blocks while listeners
+// apply it. An empty name returns to the base results.
+func (ctx *Context) SwitchScenario(name string) error {
+	ctx.scenarios.mu.Lock()
+	if name != "" && !slices.Contains(ctx.scenarios.available, name) {
+		ctx.scenarios.mu.Unlock()
+		return fmt.Errorf("unknown scenario: %s", name)
+	}
+
+	ctx.scenarios.active = name
+	listeners := slices.Clone(ctx.scenarios.listeners)
+	ctx.scenarios.mu.Unlock()
+
+	ctx.publishScenario()
+
+	for _, fn := range listeners {
+		fn(name)
+	}
+
+	return nil
+}
+
+// OnScenario registers fn to be called whenever the active scenario changes.
+func (ctx *Context) OnScenario(fn func(name string)) {
+	ctx.scenarios.mu.Lock()
+	defer ctx.scenarios.mu.Unlock()
+
+	ctx.scenarios.listeners = append(ctx.scenarios.listeners, fn)
+}
+
+func (ctx *Context) publishScenario() {
+	ctx.scenarios.mu.Lock()
+	msg := ScenarioMessage{
+		Active:    ctx.scenarios.active,
+		Available: slices.Clone(ctx.scenarios.available),
+	}
+	ctx.scenarios.mu.Unlock()
+
+	ctx.publish(msg)
+}
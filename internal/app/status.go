@@ -0,0 +1,66 @@
+package app
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+// statuses remembers the last status published for each service and who
+// needs to know when one changes.
+type statuses struct {
+	mu        sync.Mutex
+	status    map[string]string
+	listeners map[int]func(name, status string)
+	next      int
+}
+
+// set records the status of a service, calling the listeners when it
+// changed.
+func (s *statuses) set(name, status string) {
+	s.mu.Lock()
+	changed := s.status[name] != status
+	s.status[name] = status
+	listeners := slices.Collect(maps.Values(s.listeners))
+	s.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	for _, fn := range listeners {
+		fn(name, status)
+	}
+}
+
+// Status returns the last status published for the named service.
+func (ctx *Context) Status(name string) string {
+	ctx.statuses.mu.Lock()
+	defer ctx.statuses.mu.Unlock()
+
+	return ctx.statuses.status[name]
+}
+
+// OnStatus registers fn to be called whenever the status of a service
+// changes, until the returned function is called.
+func (ctx *Context) OnStatus(fn func(name, status string)) (stop func()) {
+	s := ctx.statuses
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listeners == nil {
+		s.listeners = make(map[int]func(name, status string))
+	}
+
+	id := s.next
+	s.next++
+	s.listeners[id] = fn
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.listeners, id)
+	}
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnStatus(t *testing.T) {
+	ctx := &Context{publish: func(tea.Msg) {}, statuses: &statuses{status: make(map[string]string)}}
+
+	var changes []string
+	stop := ctx.OnStatus(func(name, status string) { changes = append(changes, name+" "+status) })
+
+	ctx.PublishService("http", "users", 3001)
+	ctx.PublishServiceOnline("users")
+	ctx.PublishServiceOnline("users")
+	ctx.PublishServiceError("users")
+
+	assert.Equal(t, []string{"users offline", "users online", "users error"}, changes, "only changes are reported")
+	assert.Equal(t, "error", ctx.Status("users"))
+
+	stop()
+	ctx.PublishServiceOffline("users")
+
+	assert.Len(t, changes, 3, "listener was called after it was removed")
+	assert.Equal(t, "offline", ctx.Status("users"))
+}
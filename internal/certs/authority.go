@@ -0,0 +1,283 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Files written to the certs directory.
+const (
+	CertFile = "ca.pem"
+	KeyFile  = "ca-key.pem"
+)
+
+// DefaultHosts are issued certificates when a service names no hosts.
+var DefaultHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+var (
+	mu          sync.Mutex
+	authorities = make(map[string]*Authority)
+)
+
+// Authority is a local certificate authority managed by fake-ops. Its
+// certificate can be trusted by clients to accept certificates it issues.
+type Authority struct {
+	Cert     *x509.Certificate
+	Key      crypto.Signer
+	CertPath string
+}
+
+// LoadAuthority reads the authority stored in dir, creating one when dir does
+// not have it yet. Services share the authority loaded for a dir.
+func LoadAuthority(dir string) (*Authority, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if a, ok := authorities[dir]; ok {
+		return a, nil
+	}
+
+	a, err := readAuthority(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		a, err = createAuthority(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	authorities[dir] = a
+	return a, nil
+}
+
+// Issue creates a server certificate for hosts, which may be names or IP
+// addresses, signed by the authority.
+func (a *Authority) Issue(hosts []string) (tls.Certificate, error) {
+	if len(hosts) == 0 {
+		hosts = DefaultHosts
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"fake-ops"}, CommonName: hosts[0]},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	return a.issue(template)
+}
+
+// issue signs a leaf certificate from template with a new key.
+func (a *Authority) issue(template *x509.Certificate) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().AddDate(1, 0, 0)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.Cert, key.Public(), a.Key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to issue certificate: %s", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der, a.Cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// Pool returns a certificate pool trusting the authority.
+func (a *Authority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.Cert)
+
+	return pool
+}
+
+func readAuthority(dir string) (*Authority, error) {
+	certPath := filepath.Join(dir, CertFile)
+
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := os.ReadFile(filepath.Join(dir, KeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate authority in %s: %s", dir, err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("invalid certificate authority key in %s", dir)
+	}
+
+	return &Authority{Cert: cert, Key: key, CertPath: certPath}, nil
+}
+
+func createAuthority(dir string) (*Authority, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"fake-ops"}, CommonName: "fake-ops local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate authority: %s", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPath := filepath.Join(dir, CertFile)
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, KeyFile), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authority{Cert: cert, Key: key, CertPath: certPath}, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// IssueClient creates a client certificate for commonName, signed by the
+// authority.
+func (a *Authority) IssueClient(commonName string, organization []string) (tls.Certificate, error) {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{Organization: organization, CommonName: commonName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	return a.issue(template)
+}
+
+// EncodePEM encodes the leaf certificate and private key of cert.
+func EncodePEM(cert tls.Certificate) (certPEM, keyPEM []byte, err error) {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
+
+// WriteClient issues a client certificate for commonName into the clients
+// folder of dir, unless one is already there. It returns the paths of the
+// certificate and key.
+func (a *Authority) WriteClient(dir, commonName string) (certPath, keyPath string, err error) {
+	// the name becomes a file name, which must stay in the clients folder
+	if commonName == "" || strings.ContainsAny(commonName, `/\`) || strings.Contains(commonName, "..") {
+		return "", "", fmt.Errorf("invalid client certificate name: %s", commonName)
+	}
+
+	clients := filepath.Join(dir, "clients")
+	certPath = filepath.Join(clients, commonName+".pem")
+	keyPath = filepath.Join(clients, commonName+"-key.pem")
+
+	if _, err := os.Stat(certPath); err == nil {
+		return certPath, keyPath, nil
+	}
+
+	cert, err := a.IssueClient(commonName, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	certPEM, keyPEM, err := EncodePEM(cert)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(clients, 0755); err != nil {
+		return "", "", err
+	}
+
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return "", "", err
+	}
+
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return "", "", err
+	}
+
+	return certPath, keyPath, nil
+}
@@ -0,0 +1,83 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAuthorityCreatesAndReuses(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := LoadAuthority(dir)
+	require.Nil(t, err, "error creating authority")
+	assert.FileExists(t, filepath.Join(dir, CertFile), "certificate was not exported")
+
+	info, err := os.Stat(filepath.Join(dir, KeyFile))
+	require.Nil(t, err, "key was not written")
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "key is readable by others")
+
+	// a fresh read from disk must find the same authority
+	b, err := readAuthority(dir)
+	require.Nil(t, err, "error reading authority")
+	assert.True(t, a.Cert.Equal(b.Cert), "authority was not reused")
+}
+
+func TestIssueVerifiesAgainstAuthority(t *testing.T) {
+	a, err := LoadAuthority(t.TempDir())
+	require.Nil(t, err, "error creating authority")
+
+	cert, err := a.Issue([]string{"payments.local", "127.0.0.1"})
+	require.Nil(t, err, "error issuing certificate")
+
+	opts := x509.VerifyOptions{Roots: a.Pool(), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+
+	opts.DNSName = "payments.local"
+	_, err = cert.Leaf.Verify(opts)
+	assert.Nil(t, err, "certificate is not valid for payments.local")
+
+	opts.DNSName = "127.0.0.1"
+	_, err = cert.Leaf.Verify(opts)
+	assert.Nil(t, err, "certificate is not valid for 127.0.0.1")
+
+	opts.DNSName = "users.local"
+	_, err = cert.Leaf.Verify(opts)
+	assert.NotNil(t, err, "certificate is valid for a host it was not issued for")
+}
+
+func TestIssueClientVerifiesAgainstAuthority(t *testing.T) {
+	dir := t.TempDir()
+	a, err := LoadAuthority(dir)
+	require.Nil(t, err, "error creating authority")
+
+	certPath, keyPath, err := a.WriteClient(dir, "checkout")
+	require.Nil(t, err, "error writing client certificate")
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	require.Nil(t, err, "written client certificate is invalid")
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	require.Nil(t, err, "error parsing client certificate")
+	assert.Equal(t, "checkout", leaf.Subject.CommonName)
+
+	_, err = leaf.Verify(x509.VerifyOptions{Roots: a.Pool(), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	assert.Nil(t, err, "client certificate does not verify")
+}
+
+func TestWriteClientRejectsPaths(t *testing.T) {
+	dir := t.TempDir()
+	a, err := LoadAuthority(dir)
+	require.Nil(t, err, "error creating authority")
+
+	for _, name := range []string{"", "../checkout", "clients/checkout", `..\checkout`, "check..out"} {
+		_, _, err := a.WriteClient(dir, name)
+		assert.NotNil(t, err, "name %q was accepted", name)
+	}
+
+	assert.NoFileExists(t, filepath.Join(dir, "checkout.pem"))
+}
@@ -0,0 +1,421 @@
+package dns_zone
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Extension marks zone files, which sit in the services directory.
+const Extension = ".zone"
+
+// DefaultDomain is the domain records of running services are made under.
+const DefaultDomain = "internal"
+
+// DefaultTTL is the ttl of records that do not set one.
+const DefaultTTL = 60
+
+// Config is parsed from the dns section of a service yaml file.
+type Config struct {
+	// Zone is a zone file in the services directory. Defaults to the
+	// service's name with the .zone extension, when it exists.
+	Zone string `yaml:"zone"`
+
+	// Domain is the origin of the zone file and the domain records of
+	// running services are made under. Defaults to DefaultDomain.
+	Domain string `yaml:"domain"`
+
+	// Addresses are what the names of running services resolve to. Defaults
+	// to 127.0.0.1 and ::1.
+	Addresses []string `yaml:"addresses"`
+
+	// TTL is the ttl of records that do not set one. Defaults to DefaultTTL.
+	TTL uint32 `yaml:"ttl"`
+}
+
+// Zone holds the records a dns service answers with.
+//
+//	$ORIGIN internal.
+//	$TTL 60
+//	payments              A      127.0.0.1
+//	                      AAAA   ::1
+//	api                   CNAME  payments
+//	@                     TXT    "v=spf1 -all"
+//	_http._tcp.payments   SRV    0 0 3001 payments
+type Zone struct {
+	// Origin is the domain names in the zone file are relative to.
+	Origin string
+
+	records map[string][]dnsmessage.Resource
+}
+
+// New creates an empty Zone for the origin.
+func New(origin string) *Zone {
+	return &Zone{
+		Origin:  Canonical(origin),
+		records: make(map[string][]dnsmessage.Resource),
+	}
+}
+
+// Canonical lowercases name and makes it absolute.
+func Canonical(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+
+	return name
+}
+
+// Parse reads the records of a zone file: one per line, as name, optional ttl
+// and class, type and data. Names are relative to origin unless they end with
+// a dot, @ is the origin itself and a line starting with a space repeats the
+// previous name. $ORIGIN and $TTL change the origin and default ttl.
+func Parse(data []byte, origin string, ttl uint32) (*Zone, error) {
+	z := New(origin)
+	current := z.Origin
+	var previous string
+
+	for i, line := range strings.Split(string(data), "\n") {
+		fields, err := split(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "$ORIGIN":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: $ORIGIN needs a domain", i+1)
+			}
+			current = absolute(fields[1], current)
+			continue
+		case "$TTL":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: $TTL needs a number", i+1)
+			}
+			n, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid $TTL %s", i+1, fields[1])
+			}
+			ttl = uint32(n)
+			continue
+		}
+
+		// a line starting with a space is for the previous name
+		name := previous
+		if line[0] != ' ' && line[0] != '\t' {
+			name, fields = absolute(fields[0], current), fields[1:]
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("line %d: record without a name", i+1)
+		}
+		previous = name
+
+		r, err := parseRecord(name, fields, current, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+
+		z.Add(r)
+	}
+
+	return z, nil
+}
+
+// parseRecord reads the optional ttl and class, the type and the data of a
+// record.
+func parseRecord(name string, fields []string, origin string, ttl uint32) (dnsmessage.Resource, error) {
+	n, err := newName(name)
+	if err != nil {
+		return dnsmessage.Resource{}, err
+	}
+
+	r := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: n, Class: dnsmessage.ClassINET, TTL: ttl},
+	}
+
+	for len(fields) > 0 {
+		if n, err := strconv.ParseUint(fields[0], 10, 32); err == nil {
+			r.Header.TTL = uint32(n)
+		} else if !strings.EqualFold(fields[0], "IN") {
+			break
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return r, fmt.Errorf("record without a type")
+	}
+
+	kind, data := strings.ToUpper(fields[0]), fields[1:]
+
+	want := map[string]int{"A": 1, "AAAA": 1, "CNAME": 1, "SRV": 4}
+	if n, ok := want[kind]; ok && len(data) != n {
+		return r, fmt.Errorf("%s record needs %d values, got %d", kind, n, len(data))
+	}
+
+	switch kind {
+	case "A":
+		ip := net.ParseIP(data[0]).To4()
+		if ip == nil {
+			return r, fmt.Errorf("invalid A address %s", data[0])
+		}
+		r.Body = &dnsmessage.AResource{A: [4]byte(ip)}
+
+	case "AAAA":
+		ip := net.ParseIP(data[0])
+		if ip == nil || ip.To4() != nil {
+			return r, fmt.Errorf("invalid AAAA address %s", data[0])
+		}
+		r.Body = &dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}
+
+	case "CNAME":
+		target, err := newName(absolute(data[0], origin))
+		if err != nil {
+			return r, err
+		}
+		r.Body = &dnsmessage.CNAMEResource{CNAME: target}
+
+	case "TXT":
+		if len(data) == 0 {
+			return r, fmt.Errorf("TXT record needs a value")
+		}
+		r.Body = &dnsmessage.TXTResource{TXT: data}
+
+	case "SRV":
+		var numbers [3]uint16
+		for i, s := range data[:3] {
+			n, err := strconv.ParseUint(s, 10, 16)
+			if err != nil {
+				return r, fmt.Errorf("invalid SRV value %s", s)
+			}
+			numbers[i] = uint16(n)
+		}
+		target, err := newName(absolute(data[3], origin))
+		if err != nil {
+			return r, err
+		}
+		r.Body = &dnsmessage.SRVResource{Priority: numbers[0], Weight: numbers[1], Port: numbers[2], Target: target}
+
+	default:
+		return r, fmt.Errorf("unsupported record type %s", fields[0])
+	}
+
+	r.Header.Type = Type(r.Body)
+
+	return r, nil
+}
+
+// split breaks a line into fields, keeping quoted strings together and
+// dropping comments.
+func split(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	var quoted, inField bool
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quoted && c == '\\' && i+1 < len(line):
+			i++
+			field.WriteByte(line[i])
+		case c == '"':
+			quoted = !quoted
+			inField = true
+		case quoted:
+			field.WriteByte(c)
+		case c == ';':
+			i = len(line)
+		case c == ' ' || c == '\t' || c == '\r':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteByte(c)
+			inField = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+
+	if inField {
+		fields = append(fields, field.String())
+	}
+
+	return fields, nil
+}
+
+// absolute makes name absolute, relative to origin.
+func absolute(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.ToLower(name)
+	default:
+		return strings.ToLower(name) + "." + origin
+	}
+}
+
+// newName makes a dnsmessage.Name of an absolute name.
+func newName(name string) (dnsmessage.Name, error) {
+	n, err := dnsmessage.NewName(name)
+	if err != nil || len(name) > 254 {
+		return n, fmt.Errorf("invalid name %s", name)
+	}
+
+	return n, nil
+}
+
+// Type returns the record type of a resource body.
+func Type(body dnsmessage.ResourceBody) dnsmessage.Type {
+	switch body.(type) {
+	case *dnsmessage.AResource:
+		return dnsmessage.TypeA
+	case *dnsmessage.AAAAResource:
+		return dnsmessage.TypeAAAA
+	case *dnsmessage.CNAMEResource:
+		return dnsmessage.TypeCNAME
+	case *dnsmessage.TXTResource:
+		return dnsmessage.TypeTXT
+	case *dnsmessage.SRVResource:
+		return dnsmessage.TypeSRV
+	default:
+		return 0
+	}
+}
+
+// Value describes the data of a resource body, as written in a zone file.
+func Value(body dnsmessage.ResourceBody) string {
+	switch b := body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(b.A[:]).String()
+	case *dnsmessage.AAAAResource:
+		return net.IP(b.AAAA[:]).String()
+	case *dnsmessage.CNAMEResource:
+		return b.CNAME.String()
+	case *dnsmessage.TXTResource:
+		return strconv.Quote(strings.Join(b.TXT, ""))
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", b.Priority, b.Weight, b.Port, b.Target)
+	default:
+		return body.GoString()
+	}
+}
+
+// Add adds a record to the zone.
+func (z *Zone) Add(r dnsmessage.Resource) {
+	name := Canonical(r.Header.Name.String())
+	z.records[name] = append(z.records[name], r)
+}
+
+// AddService adds the records of a running service: its name under the
+// origin resolving to addresses, and an SRV record for its port, like
+// _http._tcp.payments.internal.
+func (z *Zone) AddService(name, kind, network string, port int, addresses []net.IP, ttl uint32) error {
+	host := absolute(strings.ToLower(name), z.Origin)
+
+	n, err := newName(host)
+	if err != nil {
+		return err
+	}
+
+	header := dnsmessage.ResourceHeader{Name: n, Class: dnsmessage.ClassINET, TTL: ttl}
+
+	for _, ip := range addresses {
+		r := dnsmessage.Resource{Header: header}
+		if ip4 := ip.To4(); ip4 != nil {
+			r.Body = &dnsmessage.AResource{A: [4]byte(ip4)}
+		} else {
+			r.Body = &dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}
+		}
+		r.Header.Type = Type(r.Body)
+		z.Add(r)
+	}
+
+	if port <= 0 || kind == "" {
+		return nil
+	}
+
+	srv, err := newName(fmt.Sprintf("_%s._%s.%s", strings.ToLower(kind), network, host))
+	if err != nil {
+		return err
+	}
+
+	z.Add(dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: srv, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.SRVResource{Port: uint16(port), Target: n},
+	})
+
+	return nil
+}
+
+// Has reports whether the zone has any record for name.
+func (z *Zone) Has(name string) bool {
+	return len(z.records[Canonical(name)]) > 0
+}
+
+// Clone copies the zone, so records can be added without changing it.
+func (z *Zone) Clone() *Zone {
+	c := New(z.Origin)
+	for name, records := range z.records {
+		c.records[name] = append([]dnsmessage.Resource(nil), records...)
+	}
+
+	return c
+}
+
+// Lookup answers a question for name and t. CNAME records are followed
+// within the zone. Names under the origin without records are NXDOMAIN,
+// names outside it the zone knows nothing about are refused.
+func (z *Zone) Lookup(name string, t dnsmessage.Type) ([]dnsmessage.Resource, dnsmessage.RCode) {
+	var answers []dnsmessage.Resource
+	name = Canonical(name)
+
+	// follow a few CNAMEs at most, they could loop
+	for range 8 {
+		records, ok := z.records[name]
+		if !ok {
+			break
+		}
+
+		var cname *dnsmessage.CNAMEResource
+		for _, r := range records {
+			if r.Header.Type == t || t == dnsmessage.TypeALL {
+				answers = append(answers, r)
+			} else if c, ok := r.Body.(*dnsmessage.CNAMEResource); ok {
+				answers = append(answers, r)
+				cname = c
+			}
+		}
+
+		if cname == nil {
+			return answers, dnsmessage.RCodeSuccess
+		}
+
+		name = Canonical(cname.CNAME.String())
+	}
+
+	switch {
+	case len(answers) > 0:
+		// a CNAME pointing outside the zone
+		return answers, dnsmessage.RCodeSuccess
+	case name == z.Origin || strings.HasSuffix(name, "."+z.Origin):
+		return nil, dnsmessage.RCodeNameError
+	default:
+		return nil, dnsmessage.RCodeRefused
+	}
+}
@@ -0,0 +1,111 @@
+package dns_zone
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const zone = `
+; fakes for local development
+$TTL 30
+payments              A      127.0.0.1
+                      AAAA   ::1
+api         300 IN    CNAME  payments
+outside               CNAME  example.com.
+@                     TXT    "v=spf1 -all" "second; not a comment"
+_http._tcp.payments   SRV    0 5 3001 payments
+
+$ORIGIN corp.
+ldap                  A      10.0.0.5
+`
+
+func TestParse(t *testing.T) {
+	z, err := Parse([]byte(zone), "Internal", DefaultTTL)
+	require.Nil(t, err, "error parsing zone")
+	assert.Equal(t, "internal.", z.Origin)
+
+	answers, code := z.Lookup("PAYMENTS.internal", dnsmessage.TypeA)
+	assert.Equal(t, dnsmessage.RCodeSuccess, code)
+	require.Len(t, answers, 1)
+	assert.Equal(t, &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}, answers[0].Body)
+	assert.Equal(t, uint32(30), answers[0].Header.TTL, "$TTL is not applied")
+
+	answers, _ = z.Lookup("payments.internal.", dnsmessage.TypeAAAA)
+	require.Len(t, answers, 1, "a line starting with a space is for the previous name")
+	assert.Equal(t, net.IPv6loopback, net.IP(answers[0].Body.(*dnsmessage.AAAAResource).AAAA[:]))
+
+	answers, code = z.Lookup("api.internal", dnsmessage.TypeA)
+	assert.Equal(t, dnsmessage.RCodeSuccess, code)
+	require.Len(t, answers, 2, "cname is not followed")
+	assert.Equal(t, dnsmessage.TypeCNAME, answers[0].Header.Type)
+	assert.Equal(t, uint32(300), answers[0].Header.TTL)
+	assert.Equal(t, dnsmessage.TypeA, answers[1].Header.Type)
+
+	answers, code = z.Lookup("outside.internal", dnsmessage.TypeA)
+	assert.Equal(t, dnsmessage.RCodeSuccess, code)
+	assert.Len(t, answers, 1, "cname outside the zone")
+
+	answers, _ = z.Lookup("internal", dnsmessage.TypeTXT)
+	require.Len(t, answers, 1)
+	assert.Equal(t, []string{"v=spf1 -all", "second; not a comment"}, answers[0].Body.(*dnsmessage.TXTResource).TXT)
+
+	answers, _ = z.Lookup("_http._tcp.payments.internal", dnsmessage.TypeSRV)
+	require.Len(t, answers, 1)
+	srv := answers[0].Body.(*dnsmessage.SRVResource)
+	assert.Equal(t, uint16(3001), srv.Port)
+	assert.Equal(t, "payments.internal.", srv.Target.String())
+
+	answers, _ = z.Lookup("ldap.corp", dnsmessage.TypeA)
+	assert.Len(t, answers, 1, "$ORIGIN is not applied")
+
+	answers, code = z.Lookup("payments.internal", dnsmessage.TypeTXT)
+	assert.Equal(t, dnsmessage.RCodeSuccess, code, "existing name without the type")
+	assert.Empty(t, answers)
+
+	_, code = z.Lookup("missing.internal", dnsmessage.TypeA)
+	assert.Equal(t, dnsmessage.RCodeNameError, code)
+
+	_, code = z.Lookup("example.org", dnsmessage.TypeA)
+	assert.Equal(t, dnsmessage.RCodeRefused, code)
+
+	tests := map[string]string{
+		"unsupported type":  "a MX 10 mail",
+		"invalid address":   "a A ::1",
+		"missing values":    "a SRV 0 0 80",
+		"unterminated":      `a TXT "nope`,
+		"no name":           " A 127.0.0.1",
+		"no type":           "a 60 IN",
+		"invalid ttl":       "$TTL soon",
+		"invalid srv value": "a SRV 0 0 http b",
+	}
+
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(file), DefaultDomain, DefaultTTL)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestAddService(t *testing.T) {
+	z := New(DefaultDomain)
+	require.Nil(t, z.AddService("Payments", "http", "tcp", 3001, []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}, DefaultTTL))
+
+	assert.True(t, z.Has("payments.internal"))
+
+	answers, _ := z.Lookup("payments.internal", dnsmessage.TypeALL)
+	assert.Len(t, answers, 2)
+
+	answers, _ = z.Lookup("_http._tcp.payments.internal", dnsmessage.TypeSRV)
+	require.Len(t, answers, 1)
+	assert.Equal(t, uint16(3001), answers[0].Body.(*dnsmessage.SRVResource).Port)
+
+	c := z.Clone()
+	require.Nil(t, c.AddService("users", "", "", 0, []net.IP{net.ParseIP("127.0.0.1")}, DefaultTTL))
+	assert.True(t, c.Has("users.internal"))
+	assert.False(t, z.Has("users.internal"), "clone shares records")
+}
@@ -0,0 +1,273 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// executor answers a selection set from the schema. Introspection fields are
+// resolved, fields of a response file's data are kept and everything else is
+// mocked.
+type executor struct {
+	schema *ast.Schema
+	vars   map[string]any
+}
+
+// resolver is a value that knows its own fields, like the introspection types.
+type resolver interface {
+	resolve(field string, args map[string]any) any
+}
+
+// mocked marks a value to be made up from its type.
+type mocked struct{}
+
+// object keeps the fields of a response in the order they were asked for.
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *object) set(key string, value any) {
+	if o.values == nil {
+		o.values = make(map[string]any)
+	}
+
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+
+	o.values[key] = value
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// object answers set on an object of type def. A nil source is mocked, as
+// are fields a response file's data leaves out.
+func (e *executor) object(def *ast.Definition, set ast.SelectionSet, source any) *object {
+	var out object
+
+	fields, order := e.collect(def, set, nil, nil)
+	for _, key := range order {
+		f := fields[key][0]
+
+		var merged ast.SelectionSet
+		for _, same := range fields[key] {
+			merged = append(merged, same.SelectionSet...)
+		}
+
+		if f.Name == "__typename" {
+			out.set(key, def.Name)
+			continue
+		}
+
+		var value any = mocked{}
+		switch r := source.(type) {
+		case resolver:
+			value = r.resolve(f.Name, f.ArgumentMap(e.vars))
+		case map[string]any:
+			if v, ok := r[key]; ok {
+				value = v
+			}
+		case nil:
+			if def == e.schema.Query {
+				switch f.Name {
+				case "__schema":
+					value = &schemaType{schema: e.schema}
+				case "__type":
+					name, _ := f.ArgumentMap(e.vars)["name"].(string)
+					value = namedType(e.schema, name)
+				}
+			}
+		}
+
+		out.set(key, e.value(f.Definition.Type, merged, value, f.Name))
+	}
+
+	return &out
+}
+
+// collect gathers the fields of set by response key, following fragments
+// that apply to def and leaving out skipped ones.
+func (e *executor) collect(def *ast.Definition, set ast.SelectionSet, fields map[string][]*ast.Field, order []string) (map[string][]*ast.Field, []string) {
+	if fields == nil {
+		fields = make(map[string][]*ast.Field)
+	}
+
+	for _, sel := range set {
+		switch s := sel.(type) {
+		case *ast.Field:
+			if !e.included(s.Directives) {
+				continue
+			}
+
+			key := s.Alias
+			if key == "" {
+				key = s.Name
+			}
+
+			if _, ok := fields[key]; !ok {
+				order = append(order, key)
+			}
+			fields[key] = append(fields[key], s)
+
+		case *ast.InlineFragment:
+			if e.included(s.Directives) && e.applies(def, s.TypeCondition) {
+				fields, order = e.collect(def, s.SelectionSet, fields, order)
+			}
+
+		case *ast.FragmentSpread:
+			if s.Definition != nil && e.included(s.Directives) && e.applies(def, s.Definition.TypeCondition) {
+				fields, order = e.collect(def, s.Definition.SelectionSet, fields, order)
+			}
+		}
+	}
+
+	return fields, order
+}
+
+// included reports whether @skip and @include keep a selection.
+func (e *executor) included(directives ast.DirectiveList) bool {
+	if d := directives.ForName("skip"); d != nil {
+		if skip, _ := d.ArgumentMap(e.vars)["if"].(bool); skip {
+			return false
+		}
+	}
+
+	if d := directives.ForName("include"); d != nil {
+		if include, _ := d.ArgumentMap(e.vars)["if"].(bool); !include {
+			return false
+		}
+	}
+
+	return true
+}
+
+// applies reports whether a fragment on condition applies to objects of def.
+func (e *executor) applies(def *ast.Definition, condition string) bool {
+	if condition == "" || condition == def.Name {
+		return true
+	}
+
+	for _, t := range e.schema.GetPossibleTypes(e.schema.Types[condition]) {
+		if t.Name == def.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// value answers a field of type t. name is the field name, used by mocks.
+func (e *executor) value(t *ast.Type, set ast.SelectionSet, value any, name string) any {
+	if _, ok := value.(mocked); ok {
+		return e.mock(t, set, name)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	if t.Elem != nil {
+		list, _ := value.([]any)
+
+		out := make([]any, 0, len(list))
+		for _, item := range list {
+			out = append(out, e.value(t.Elem, set, item, name))
+		}
+
+		return out
+	}
+
+	def := e.schema.Types[t.NamedType]
+	switch def.Kind {
+	case ast.Object:
+		return e.object(def, set, value)
+	case ast.Interface, ast.Union:
+		if data, ok := value.(map[string]any); ok {
+			def = e.concrete(def, data)
+		}
+		return e.object(def, set, value)
+	default:
+		return value
+	}
+}
+
+// concrete picks the object type of an interface or union value from a
+// response file, by its __typename or else the first possible type.
+func (e *executor) concrete(def *ast.Definition, data map[string]any) *ast.Definition {
+	possible := e.schema.GetPossibleTypes(def)
+
+	name, _ := data["__typename"].(string)
+	for _, t := range possible {
+		if t.Name == name {
+			return t
+		}
+	}
+
+	if len(possible) > 0 {
+		return possible[0]
+	}
+
+	return def
+}
+
+// mock makes up a value of type t.
+func (e *executor) mock(t *ast.Type, set ast.SelectionSet, name string) any {
+	if t.Elem != nil {
+		return []any{e.mock(t.Elem, set, name), e.mock(t.Elem, set, name)}
+	}
+
+	def := e.schema.Types[t.NamedType]
+	switch def.Kind {
+	case ast.Object:
+		return e.object(def, set, nil)
+	case ast.Interface, ast.Union:
+		possible := e.schema.GetPossibleTypes(def)
+		if len(possible) == 0 {
+			return nil
+		}
+		return e.object(possible[0], set, nil)
+	case ast.Enum:
+		if len(def.EnumValues) == 0 {
+			return nil
+		}
+		return def.EnumValues[0].Name
+	}
+
+	switch def.Name {
+	case "Int":
+		return 42
+	case "Float":
+		return 4.2
+	case "Boolean":
+		return true
+	case "ID":
+		return "1"
+	default:
+		return name
+	}
+}
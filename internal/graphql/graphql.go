@@ -0,0 +1,323 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is where a graphql service answers requests.
+const DefaultPath = "/graphql"
+
+// SchemaExtensions mark the files of a graphql service that hold its schema.
+var SchemaExtensions = []string{".graphql", ".graphqls", ".gql"}
+
+// Config is parsed from the graphql section of a service yaml file.
+type Config struct {
+	// Path is where requests are answered. Defaults to /graphql.
+	Path string `yaml:"path"`
+
+	// Mock answers operations without a response file with values made up
+	// from the schema, and fills in the fields response files leave out.
+	Mock bool `yaml:"mock"`
+}
+
+// Request is a GraphQL request sent over HTTP.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// ParseRequest reads a request from the query string of a GET, or the JSON
+// or application/graphql body of a POST.
+func ParseRequest(r *http.Request) (Request, error) {
+	var req Request
+
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return req, fmt.Errorf("invalid variables: %s", err)
+			}
+		}
+
+		return req, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return req, err
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/graphql" {
+		req.Query = string(body)
+		return req, nil
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, fmt.Errorf("invalid request body: %s", err)
+	}
+
+	return req, nil
+}
+
+// Operation is parsed from a graphql response file. It answers requests for
+// the operation with the same name.
+//
+//	# query GetUser
+//	## variables: {id: "1"}
+//	{"data": {"user": {"id": "1", "name": "Alice"}}}
+type Operation struct {
+	Name string
+
+	// Variables the request must have, when set. Others are not compared.
+	Variables map[string]any `yaml:"variables"`
+
+	// Data is the whole response body.
+	Data []byte
+
+	// File is the response file this Operation was parsed from, when known.
+	File string
+}
+
+// ParseOperation takes in the content of a graphql response file and creates
+// an Operation. A body without data or errors is sent as the data.
+func ParseOperation(data []byte) (*Operation, error) {
+	var op Operation
+
+	line, rest, _ := bytes.Cut(data, []byte("\n"))
+
+	// # query GetUser => ["query", "GetUser"], or just ["GetUser"]
+	parts := strings.Fields(strings.TrimPrefix(strings.TrimSpace(string(line)), "#"))
+	if !bytes.HasPrefix(line, []byte("#")) || len(parts) == 0 || len(parts) > 2 {
+		return nil, fmt.Errorf("invalid line: %s", line)
+	}
+	op.Name = parts[len(parts)-1]
+
+	// lines starting with ## hold options
+	var options []byte
+	for bytes.HasPrefix(rest, []byte("##")) {
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		line = bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("##")), []byte(" "))
+		options = append(append(options, line...), '\n')
+	}
+
+	if err := yaml.Unmarshal(options, &op); err != nil {
+		return nil, fmt.Errorf("invalid options: %s", err)
+	}
+
+	if op.Variables != nil {
+		op.Variables, _ = normalize(op.Variables).(map[string]any)
+	}
+
+	op.Data = bytes.TrimSpace(rest)
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(op.Data, &body); err != nil {
+		return nil, fmt.Errorf("invalid response body, it must be a JSON object: %s", err)
+	}
+
+	if _, ok := body["data"]; !ok {
+		if _, ok := body["errors"]; !ok {
+			op.Data = append(append([]byte(`{"data": `), op.Data...), '}')
+		}
+	}
+
+	return &op, nil
+}
+
+// Matches reports whether every variable of the Operation is in vars.
+func (o *Operation) Matches(vars map[string]any) bool {
+	for name, want := range o.Variables {
+		got, ok := vars[name]
+		if !ok || !reflect.DeepEqual(want, got) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Server answers requests against Schema with the Operations, in order, or
+// with mock values.
+type Server struct {
+	Schema     *ast.Schema
+	Operations []*Operation
+	Mock       bool
+}
+
+// LoadSchema parses and validates the schema from sources.
+func LoadSchema(sources ...*ast.Source) (*ast.Schema, error) {
+	return gqlparser.LoadSchema(sources...)
+}
+
+// Response is the answer to a Request.
+type Response struct {
+	Body []byte
+
+	// File is the response file answering, if any.
+	File string
+
+	// Mocked is set when the schema answered instead of a response file.
+	Mocked bool
+}
+
+// Execute answers req. Requests for an operation with a matching response
+// file get its body, with the selected fields it leaves out mocked when
+// mocking. Introspection is answered from the schema, as is everything else
+// when mocking.
+func (s *Server) Execute(req Request) Response {
+	doc, errs := gqlparser.LoadQuery(s.Schema, req.Query)
+	if len(errs) > 0 {
+		return errorResponse(errs)
+	}
+
+	op := operation(doc, req.OperationName)
+	if op == nil {
+		return errorResponse(gqlerror.List{gqlerror.Errorf("unknown operation: %s", req.OperationName)})
+	}
+
+	vars, err := validator.VariableValues(s.Schema, op, req.Variables)
+	if err != nil {
+		return errorResponse(gqlerror.List{gqlerror.Wrap(err)})
+	}
+
+	root := s.Schema.Query
+	if op.Operation == ast.Mutation {
+		root = s.Schema.Mutation
+	}
+
+	if op.Name != "" {
+		if found := s.find(op.Name, req.Variables); found != nil {
+			body := found.Data
+			if s.Mock && op.Operation != ast.Subscription {
+				body = s.complete(root, op, vars, body)
+			}
+			return Response{Body: body, File: found.File}
+		}
+	}
+
+	if !s.Mock && !introspection(op) {
+		return errorResponse(gqlerror.List{gqlerror.Errorf("no response file for operation %s", name(op))})
+	}
+
+	if op.Operation == ast.Subscription {
+		return errorResponse(gqlerror.List{gqlerror.Errorf("subscriptions are not supported")})
+	}
+
+	e := executor{schema: s.Schema, vars: vars}
+	body, err := json.Marshal(map[string]any{"data": e.object(root, op.SelectionSet, nil)})
+	if err != nil {
+		return errorResponse(gqlerror.List{gqlerror.Wrap(err)})
+	}
+
+	return Response{Body: body, Mocked: true}
+}
+
+// complete answers op from the data of a response file body, mocking the
+// selected fields it leaves out. Bodies without a data object are sent as
+// they are.
+func (s *Server) complete(root *ast.Definition, op *ast.OperationDefinition, vars map[string]any, body []byte) []byte {
+	var res map[string]any
+	if err := json.Unmarshal(body, &res); err != nil {
+		return body
+	}
+
+	data, ok := res["data"].(map[string]any)
+	if !ok {
+		return body
+	}
+
+	e := executor{schema: s.Schema, vars: vars}
+	res["data"] = e.object(root, op.SelectionSet, data)
+
+	completed, err := json.Marshal(res)
+	if err != nil {
+		return body
+	}
+
+	return completed
+}
+
+// find returns the first Operation named name whose variables match, or the
+// first one without variables.
+func (s *Server) find(name string, vars map[string]any) *Operation {
+	var fallback *Operation
+
+	for _, op := range s.Operations {
+		switch {
+		case op.Name != name:
+		case op.Variables == nil:
+			if fallback == nil {
+				fallback = op
+			}
+		case op.Matches(vars):
+			return op
+		}
+	}
+
+	return fallback
+}
+
+// operation picks the operation to run from doc.
+func operation(doc *ast.QueryDocument, name string) *ast.OperationDefinition {
+	if name == "" && len(doc.Operations) == 1 {
+		return doc.Operations[0]
+	}
+
+	return doc.Operations.ForName(name)
+}
+
+// introspection reports whether op only asks about the schema.
+func introspection(op *ast.OperationDefinition) bool {
+	for _, sel := range op.SelectionSet {
+		f, ok := sel.(*ast.Field)
+		if !ok || !strings.HasPrefix(f.Name, "__") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func name(op *ast.OperationDefinition) string {
+	if op.Name == "" {
+		return "without a name"
+	}
+
+	return op.Name
+}
+
+func errorResponse(errs gqlerror.List) Response {
+	body, _ := json.Marshal(map[string]any{"errors": errs})
+	return Response{Body: body}
+}
+
+// normalize converts v to what decoding it from JSON gives, so values from
+// yaml and JSON compare equal.
+func normalize(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var out any
+	_ = json.Unmarshal(data, &out)
+
+	return out
+}
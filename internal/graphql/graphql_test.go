@@ -0,0 +1,227 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const schema = `
+type Query {
+  user(id: ID!): User
+  users: [User!]!
+  search(term: String!): [SearchResult!]!
+}
+
+type Mutation {
+  createUser(name: String!): User!
+}
+
+"A person using the app."
+type User implements Node {
+  id: ID!
+  name: String!
+  age: Int
+  role: Role!
+  nick: String @deprecated(reason: "use name")
+}
+
+interface Node {
+  id: ID!
+}
+
+type Post implements Node {
+  id: ID!
+  title: String!
+}
+
+union SearchResult = User | Post
+
+enum Role {
+  ADMIN
+  MEMBER
+}
+`
+
+func newServer(t *testing.T, mock bool, files ...string) *Server {
+	s, err := LoadSchema(&ast.Source{Name: "schema.graphql", Input: schema})
+	require.Nil(t, err, "error loading schema")
+
+	server := &Server{Schema: s, Mock: mock}
+	for _, file := range files {
+		op, err := ParseOperation([]byte(file))
+		require.Nil(t, err, "error parsing operation")
+		server.Operations = append(server.Operations, op)
+	}
+
+	return server
+}
+
+func decode(t *testing.T, res Response) map[string]any {
+	var body map[string]any
+	require.Nil(t, json.Unmarshal(res.Body, &body), "invalid response: %s", res.Body)
+	return body
+}
+
+func TestParseOperation(t *testing.T) {
+	op, err := ParseOperation([]byte("# query GetUser\n## variables: {id: 1}\n{\"user\": {\"id\": \"1\"}}\n"))
+	require.Nil(t, err, "error parsing operation")
+
+	assert.Equal(t, "GetUser", op.Name)
+	assert.Equal(t, map[string]any{"id": float64(1)}, op.Variables)
+	assert.JSONEq(t, `{"data": {"user": {"id": "1"}}}`, string(op.Data))
+	assert.True(t, op.Matches(map[string]any{"id": float64(1), "other": true}))
+	assert.False(t, op.Matches(map[string]any{"id": "1"}))
+
+	op, err = ParseOperation([]byte("# GetUser\n{\"errors\": [{\"message\": \"not found\"}]}"))
+	require.Nil(t, err, "error parsing operation without kind")
+	assert.JSONEq(t, `{"errors": [{"message": "not found"}]}`, string(op.Data))
+
+	tests := map[string]string{
+		"no operation":    "{}",
+		"invalid body":    "# query GetUser\nnot json",
+		"invalid options": "# query GetUser\n## variables: [\n{}",
+	}
+
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseOperation([]byte(file))
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestExecuteOperations(t *testing.T) {
+	server := newServer(t, false,
+		"# query GetUser\n{\"user\": {\"id\": \"0\", \"name\": \"Anyone\"}}",
+		"# query GetUser\n## variables: {id: \"1\"}\n{\"user\": {\"id\": \"1\", \"name\": \"Alice\"}}",
+	)
+
+	query := `query GetUser($id: ID!) { user(id: $id) { id name } }`
+
+	res := server.Execute(Request{Query: query, Variables: map[string]any{"id": "1"}})
+	assert.JSONEq(t, `{"data": {"user": {"id": "1", "name": "Alice"}}}`, string(res.Body))
+
+	res = server.Execute(Request{Query: query, Variables: map[string]any{"id": "2"}})
+	assert.JSONEq(t, `{"data": {"user": {"id": "0", "name": "Anyone"}}}`, string(res.Body))
+
+	body := decode(t, server.Execute(Request{Query: `query Other { users { id } }`}))
+	assert.Contains(t, body["errors"].([]any)[0].(map[string]any)["message"], "no response file for operation Other")
+
+	body = decode(t, server.Execute(Request{Query: `query GetUser { user(id: "1") { missing } }`}))
+	assert.NotNil(t, body["errors"], "validation errors are returned")
+
+	body = decode(t, server.Execute(Request{Query: query}))
+	assert.NotNil(t, body["errors"], "missing variables are an error")
+}
+
+func TestExecuteMock(t *testing.T) {
+	server := newServer(t, true)
+
+	res := server.Execute(Request{Query: `
+		query Users($admins: Boolean!) {
+			users { id name age role kind: __typename nick @include(if: $admins) }
+			search(term: "a") {
+				__typename
+				... on Post { title }
+				... Named
+			}
+		}
+		fragment Named on User { name }
+	`, Variables: map[string]any{"admins": false}})
+
+	assert.True(t, res.Mocked)
+	assert.Equal(t,
+		`{"data":{"users":[{"id":"1","name":"name","age":42,"role":"ADMIN","kind":"User"},{"id":"1","name":"name","age":42,"role":"ADMIN","kind":"User"}],`+
+			`"search":[{"__typename":"User","name":"name"},{"__typename":"User","name":"name"}]}}`,
+		string(res.Body),
+	)
+
+	res = server.Execute(Request{Query: `mutation { createUser(name: "Bob") { id } }`})
+	assert.JSONEq(t, `{"data": {"createUser": {"id": "1"}}}`, string(res.Body))
+}
+
+func TestExecuteMockMissingFields(t *testing.T) {
+	server := newServer(t, true,
+		"# query GetUser\n{\"user\": {\"id\": \"7\", \"name\": \"Alice\", \"extra\": true}}",
+		"# query Search\n{\"search\": [{\"__typename\": \"Post\"}]}",
+		"# query Broken\n{\"errors\": [{\"message\": \"boom\"}]}",
+	)
+
+	res := server.Execute(Request{Query: `query GetUser { user(id: "7") { id name age role } }`})
+	assert.False(t, res.Mocked)
+	assert.JSONEq(t, `{"data": {"user": {"id": "7", "name": "Alice", "age": 42, "role": "ADMIN"}}}`, string(res.Body),
+		"fields the file leaves out are mocked, fields the query does not select are dropped")
+
+	res = server.Execute(Request{Query: `query Search { search(term: "a") { __typename ... on Post { title } } }`})
+	assert.JSONEq(t, `{"data": {"search": [{"__typename": "Post", "title": "title"}]}}`, string(res.Body),
+		"the file picks the type of a union")
+
+	res = server.Execute(Request{Query: `query Broken { users { id } }`})
+	assert.JSONEq(t, `{"errors": [{"message": "boom"}]}`, string(res.Body), "errors are sent as they are")
+}
+
+func TestExecuteIntrospection(t *testing.T) {
+	server := newServer(t, false)
+
+	body := decode(t, server.Execute(Request{Query: `{
+		__schema { queryType { name } mutationType { name } subscriptionType { name } types { name } }
+		__type(name: "User") {
+			kind description interfaces { name }
+			fields { name type { kind name ofType { kind name } } }
+			all: fields(includeDeprecated: true) { name isDeprecated deprecationReason }
+		}
+		role: __type(name: "Role") { enumValues { name } }
+		node: __type(name: "Node") { possibleTypes { name } }
+	}`}))
+	require.Nil(t, body["errors"], "errors: %v", body["errors"])
+
+	data := body["data"].(map[string]any)
+
+	s := data["__schema"].(map[string]any)
+	assert.Equal(t, map[string]any{"name": "Query"}, s["queryType"])
+	assert.Equal(t, map[string]any{"name": "Mutation"}, s["mutationType"])
+	assert.Nil(t, s["subscriptionType"])
+	assert.Contains(t, s["types"], map[string]any{"name": "Role"})
+
+	user := data["__type"].(map[string]any)
+	assert.Equal(t, "OBJECT", user["kind"])
+	assert.Equal(t, "A person using the app.", user["description"])
+	assert.Equal(t, []any{map[string]any{"name": "Node"}}, user["interfaces"])
+	assert.Len(t, user["fields"], 4, "deprecated fields are left out")
+	assert.Equal(t, map[string]any{
+		"name": "id",
+		"type": map[string]any{"kind": "NON_NULL", "name": nil, "ofType": map[string]any{"kind": "SCALAR", "name": "ID"}},
+	}, user["fields"].([]any)[0])
+	assert.Equal(t, map[string]any{"name": "nick", "isDeprecated": true, "deprecationReason": "use name"}, user["all"].([]any)[4])
+
+	assert.Equal(t, []any{map[string]any{"name": "ADMIN"}, map[string]any{"name": "MEMBER"}}, data["role"].(map[string]any)["enumValues"])
+	assert.Len(t, data["node"].(map[string]any)["possibleTypes"], 2)
+}
+
+func TestParseRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "{ users { id } }", "operationName": "Users", "variables": {"id": 1}}`))
+	req, err := ParseRequest(r)
+	require.Nil(t, err, "error parsing request")
+	assert.Equal(t, Request{Query: "{ users { id } }", OperationName: "Users", Variables: map[string]any{"id": float64(1)}}, req)
+
+	r = httptest.NewRequest("GET", `/graphql?query={users{id}}&variables={"id":"1"}`, nil)
+	req, err = ParseRequest(r)
+	require.Nil(t, err, "error parsing get request")
+	assert.Equal(t, "{users{id}}", req.Query)
+	assert.Equal(t, map[string]any{"id": "1"}, req.Variables)
+
+	r = httptest.NewRequest("POST", "/graphql", strings.NewReader("{ users { id } }"))
+	r.Header.Set("Content-Type", "application/graphql")
+	req, err = ParseRequest(r)
+	require.Nil(t, err, "error parsing graphql body")
+	assert.Equal(t, "{ users { id } }", req.Query)
+
+	_, err = ParseRequest(httptest.NewRequest("POST", "/graphql", strings.NewReader("nope")))
+	assert.NotNil(t, err, "invalid body should fail")
+}
@@ -0,0 +1,328 @@
+package graphql
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// schemaType resolves __Schema.
+type schemaType struct {
+	schema *ast.Schema
+}
+
+func (s *schemaType) resolve(field string, _ map[string]any) any {
+	switch field {
+	case "description":
+		return text(s.schema.Description)
+	case "types":
+		names := make([]string, 0, len(s.schema.Types))
+		for name := range s.schema.Types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		types := make([]any, 0, len(names))
+		for _, name := range names {
+			types = append(types, &typeRef{schema: s.schema, def: s.schema.Types[name]})
+		}
+		return types
+	case "queryType":
+		return definition(s.schema, s.schema.Query)
+	case "mutationType":
+		return definition(s.schema, s.schema.Mutation)
+	case "subscriptionType":
+		return definition(s.schema, s.schema.Subscription)
+	case "directives":
+		names := make([]string, 0, len(s.schema.Directives))
+		for name := range s.schema.Directives {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		directives := make([]any, 0, len(names))
+		for _, name := range names {
+			directives = append(directives, &directiveType{schema: s.schema, def: s.schema.Directives[name]})
+		}
+		return directives
+	}
+
+	return nil
+}
+
+// typeRef resolves __Type, either a named type or a list or non null wrapper
+// around another.
+type typeRef struct {
+	schema *ast.Schema
+	def    *ast.Definition
+
+	// kind and of are set for wrappers.
+	kind string
+	of   *ast.Type
+}
+
+// namedType returns the type called name, or nil when there is none.
+func namedType(schema *ast.Schema, name string) any {
+	return definition(schema, schema.Types[name])
+}
+
+func definition(schema *ast.Schema, def *ast.Definition) any {
+	if def == nil {
+		return nil
+	}
+
+	return &typeRef{schema: schema, def: def}
+}
+
+// reference returns the __Type of a field or argument type.
+func reference(schema *ast.Schema, t *ast.Type) any {
+	switch {
+	case t.NonNull:
+		of := *t
+		of.NonNull = false
+		return &typeRef{schema: schema, kind: "NON_NULL", of: &of}
+	case t.Elem != nil:
+		return &typeRef{schema: schema, kind: "LIST", of: t.Elem}
+	default:
+		return namedType(schema, t.NamedType)
+	}
+}
+
+func (t *typeRef) resolve(field string, args map[string]any) any {
+	if t.def == nil {
+		switch field {
+		case "kind":
+			return t.kind
+		case "ofType":
+			return reference(t.schema, t.of)
+		}
+		return nil
+	}
+
+	def := t.def
+	switch field {
+	case "kind":
+		return string(def.Kind)
+	case "name":
+		return def.Name
+	case "description":
+		return text(def.Description)
+	case "specifiedByURL":
+		if d := def.Directives.ForName("specifiedBy"); d != nil {
+			return d.ArgumentMap(nil)["url"]
+		}
+		return nil
+	case "fields":
+		if def.Kind != ast.Object && def.Kind != ast.Interface {
+			return nil
+		}
+
+		deprecated, _ := args["includeDeprecated"].(bool)
+
+		fields := make([]any, 0, len(def.Fields))
+		for _, f := range def.Fields {
+			if strings.HasPrefix(f.Name, "__") || (!deprecated && f.Directives.ForName("deprecated") != nil) {
+				continue
+			}
+			fields = append(fields, &fieldType{schema: t.schema, def: f})
+		}
+		return fields
+	case "interfaces":
+		if def.Kind != ast.Object && def.Kind != ast.Interface {
+			return nil
+		}
+
+		interfaces := make([]any, 0, len(def.Interfaces))
+		for _, name := range def.Interfaces {
+			interfaces = append(interfaces, namedType(t.schema, name))
+		}
+		return interfaces
+	case "possibleTypes":
+		if def.Kind != ast.Interface && def.Kind != ast.Union {
+			return nil
+		}
+
+		possible := []any{}
+		for _, p := range t.schema.GetPossibleTypes(def) {
+			possible = append(possible, definition(t.schema, p))
+		}
+		return possible
+	case "enumValues":
+		if def.Kind != ast.Enum {
+			return nil
+		}
+
+		deprecated, _ := args["includeDeprecated"].(bool)
+
+		values := make([]any, 0, len(def.EnumValues))
+		for _, v := range def.EnumValues {
+			if !deprecated && v.Directives.ForName("deprecated") != nil {
+				continue
+			}
+			values = append(values, &enumValueType{def: v})
+		}
+		return values
+	case "inputFields":
+		if def.Kind != ast.InputObject {
+			return nil
+		}
+
+		fields := make([]any, 0, len(def.Fields))
+		for _, f := range def.Fields {
+			fields = append(fields, &inputValueType{
+				schema:      t.schema,
+				name:        f.Name,
+				description: f.Description,
+				typ:         f.Type,
+				value:       f.DefaultValue,
+				directives:  f.Directives,
+			})
+		}
+		return fields
+	case "isOneOf":
+		if def.Kind != ast.InputObject {
+			return nil
+		}
+		return def.Directives.ForName("oneOf") != nil
+	}
+
+	return nil
+}
+
+// fieldType resolves __Field.
+type fieldType struct {
+	schema *ast.Schema
+	def    *ast.FieldDefinition
+}
+
+func (f *fieldType) resolve(field string, _ map[string]any) any {
+	switch field {
+	case "name":
+		return f.def.Name
+	case "description":
+		return text(f.def.Description)
+	case "args":
+		return arguments(f.schema, f.def.Arguments)
+	case "type":
+		return reference(f.schema, f.def.Type)
+	}
+
+	return deprecation(f.def.Directives, field)
+}
+
+// inputValueType resolves __InputValue, for arguments and input fields.
+type inputValueType struct {
+	schema      *ast.Schema
+	name        string
+	description string
+	typ         *ast.Type
+	value       *ast.Value
+	directives  ast.DirectiveList
+}
+
+func arguments(schema *ast.Schema, args ast.ArgumentDefinitionList) []any {
+	out := make([]any, 0, len(args))
+	for _, a := range args {
+		out = append(out, &inputValueType{
+			schema:      schema,
+			name:        a.Name,
+			description: a.Description,
+			typ:         a.Type,
+			value:       a.DefaultValue,
+			directives:  a.Directives,
+		})
+	}
+
+	return out
+}
+
+func (v *inputValueType) resolve(field string, _ map[string]any) any {
+	switch field {
+	case "name":
+		return v.name
+	case "description":
+		return text(v.description)
+	case "type":
+		return reference(v.schema, v.typ)
+	case "defaultValue":
+		if v.value == nil {
+			return nil
+		}
+		return v.value.String()
+	}
+
+	return deprecation(v.directives, field)
+}
+
+// enumValueType resolves __EnumValue.
+type enumValueType struct {
+	def *ast.EnumValueDefinition
+}
+
+func (v *enumValueType) resolve(field string, _ map[string]any) any {
+	switch field {
+	case "name":
+		return v.def.Name
+	case "description":
+		return text(v.def.Description)
+	}
+
+	return deprecation(v.def.Directives, field)
+}
+
+// directiveType resolves __Directive.
+type directiveType struct {
+	schema *ast.Schema
+	def    *ast.DirectiveDefinition
+}
+
+func (d *directiveType) resolve(field string, _ map[string]any) any {
+	switch field {
+	case "name":
+		return d.def.Name
+	case "description":
+		return text(d.def.Description)
+	case "isRepeatable":
+		return d.def.IsRepeatable
+	case "locations":
+		locations := make([]any, 0, len(d.def.Locations))
+		for _, l := range d.def.Locations {
+			locations = append(locations, string(l))
+		}
+		return locations
+	case "args":
+		return arguments(d.schema, d.def.Arguments)
+	}
+
+	return nil
+}
+
+// deprecation resolves isDeprecated and deprecationReason.
+func deprecation(directives ast.DirectiveList, field string) any {
+	d := directives.ForName("deprecated")
+
+	switch field {
+	case "isDeprecated":
+		return d != nil
+	case "deprecationReason":
+		if d == nil {
+			return nil
+		}
+		if reason, ok := d.ArgumentMap(nil)["reason"].(string); ok {
+			return reason
+		}
+		return "No longer supported"
+	}
+
+	return nil
+}
+
+// text returns s, or nil when it is empty.
+func text(s string) any {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
@@ -0,0 +1,128 @@
+package grpc_results
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Match limits the calls a Result answers. Every value is a regular
+// expression that must match for the Result to be used.
+type Match struct {
+	// Fields of the request message, by JSON or proto name. Nested fields are
+	// separated with dots, like customer.id.
+	Fields map[string]string `yaml:"fields" json:"fields,omitempty"`
+
+	// Metadata sent with the call.
+	Metadata map[string]string `yaml:"metadata" json:"metadata,omitempty"`
+
+	fields   map[string]*regexp.Regexp
+	metadata map[string]*regexp.Regexp
+}
+
+// Matches reports whether a call with the request fields and md satisfies
+// every expression in the Match. A nil Match matches every call.
+func (m *Match) Matches(fields map[string]any, md metadata.MD) bool {
+	if m == nil {
+		return true
+	}
+
+	for path, re := range m.fields {
+		value, ok := lookup(fields, path)
+		if !ok || !re.MatchString(value) {
+			return false
+		}
+	}
+
+	for name, re := range m.metadata {
+		values := md.Get(name)
+		if len(values) == 0 || !re.MatchString(values[0]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compile prepares the regular expressions used by Matches.
+func (m *Match) compile() error {
+	var err error
+
+	if m.fields, err = compileAll("field", m.Fields); err != nil {
+		return err
+	}
+
+	m.metadata, err = compileAll("metadata", m.Metadata)
+	return err
+}
+
+func compileAll(kind string, patterns map[string]string) (map[string]*regexp.Regexp, error) {
+	compiled := make(map[string]*regexp.Regexp, len(patterns))
+
+	for name, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match %s %q: %s", kind, name, pattern, err)
+		}
+
+		compiled[name] = re
+	}
+
+	return compiled, nil
+}
+
+// lookup finds the field at the dotted path in fields, the request message as
+// JSON, and returns it as text.
+func lookup(fields map[string]any, path string) (string, bool) {
+	var value any = fields
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+
+		if value, ok = object[name]; !ok {
+			// proto names are written in lowerCamelCase in JSON
+			if value, ok = object[camel(name)]; !ok {
+				return "", false
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		data, _ := json.Marshal(v)
+		return string(data), true
+	}
+}
+
+// camel converts a proto field name like customer_id to customerId.
+func camel(name string) string {
+	var b strings.Builder
+
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,147 @@
+package grpc_results
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v3"
+)
+
+// Result is parsed from a grpc response file. It answers calls to Method.
+type Result struct {
+	// Method is the full name of the method, like /inventory.v1.Inventory/GetItem.
+	Method string
+
+	// Messages are the JSON responses. Unary methods answer with the first,
+	// server streaming methods send them all.
+	Messages []json.RawMessage
+
+	// Code is the status the call ends with.
+	Code codes.Code
+
+	// File is the response file this Result was parsed from, when known.
+	File string
+
+	Options
+}
+
+// Options are set by the yaml in lines starting with ## that directly follow
+// the first line of a response file.
+//
+//	# inventory.v1.Inventory/GetItem
+//	## match:
+//	##   fields:
+//	##     sku: ^ABC-
+//	## status: NOT_FOUND
+//	## message: item not found
+type Options struct {
+	// Match limits which calls this Result answers.
+	Match *Match `yaml:"match"`
+
+	// Status is the name or number of the status code. Defaults to OK.
+	Status string `yaml:"status"`
+
+	// Message is the status message sent with an error status.
+	Message string `yaml:"message"`
+
+	// Metadata is sent as the response headers.
+	Metadata map[string]string `yaml:"metadata"`
+
+	// Delay is waited before responding, instead of the service's delay.
+	Delay time.Duration `yaml:"delay"`
+
+	// Interval is waited between the messages of a stream.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Parse takes in the content of a grpc response file and creates a Result.
+// The body is a JSON message, or an array of them for a stream.
+func Parse(data []byte) (*Result, error) {
+	var result Result
+
+	line, rest, _ := bytes.Cut(data, []byte("\n"))
+	line = bytes.TrimRight(line, "\r")
+
+	// # inventory.v1.Inventory/GetItem => ["#", "inventory.v1.Inventory/GetItem"]
+	parts := strings.Fields(string(line))
+	if len(parts) != 2 || parts[0] != "#" || !strings.Contains(parts[1], "/") {
+		return nil, fmt.Errorf("invalid line: %s", line)
+	}
+	result.Method = "/" + strings.TrimPrefix(parts[1], "/")
+
+	// lines starting with ## hold options
+	var options []byte
+	for bytes.HasPrefix(rest, []byte("##")) {
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		line = bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("##")), []byte(" "))
+		options = append(append(options, line...), '\n')
+	}
+
+	if err := result.parseOptions(options); err != nil {
+		return nil, err
+	}
+
+	body := bytes.TrimSpace(rest)
+	switch {
+	case len(body) == 0:
+	case body[0] == '[':
+		if err := json.Unmarshal(body, &result.Messages); err != nil {
+			return nil, fmt.Errorf("invalid messages: %s", err)
+		}
+	default:
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("invalid message, it must be JSON")
+		}
+		result.Messages = []json.RawMessage{body}
+	}
+
+	return &result, nil
+}
+
+// parseOptions decodes the yaml from ## lines.
+func (r *Result) parseOptions(data []byte) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	if err := yaml.Unmarshal(data, &r.Options); err != nil {
+		return fmt.Errorf("invalid options: %s", err)
+	}
+
+	if r.Match != nil {
+		if err := r.Match.compile(); err != nil {
+			return err
+		}
+	}
+
+	if r.Status != "" {
+		code, err := parseCode(r.Status)
+		if err != nil {
+			return err
+		}
+		r.Code = code
+	}
+
+	return nil
+}
+
+// parseCode reads a status code by number or name, like 5 or NOT_FOUND.
+func parseCode(status string) (codes.Code, error) {
+	var code codes.Code
+
+	s := strings.ToUpper(strings.TrimSpace(status))
+	if _, err := strconv.Atoi(s); err != nil {
+		s = strconv.Quote(s)
+	}
+
+	if err := code.UnmarshalJSON([]byte(s)); err != nil {
+		return code, fmt.Errorf("invalid status: %s", status)
+	}
+
+	return code, nil
+}
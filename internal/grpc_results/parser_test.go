@@ -0,0 +1,157 @@
+package grpc_results
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestParse(t *testing.T) {
+	result, err := Parse([]byte("# /inventory.v1.Inventory/GetItem\n## metadata: {x-request-id: abc}\n## delay: 10ms\n{\"sku\": \"MUG-1\"}\n"))
+	require.Nil(t, err, "error parsing unary result")
+
+	assert.Equal(t, "/inventory.v1.Inventory/GetItem", result.Method)
+	assert.Equal(t, codes.OK, result.Code)
+	assert.Equal(t, map[string]string{"x-request-id": "abc"}, result.Metadata)
+	assert.Equal(t, 10*time.Millisecond, result.Delay)
+	require.Len(t, result.Messages, 1)
+	assert.JSONEq(t, `{"sku": "MUG-1"}`, string(result.Messages[0]))
+
+	result, err = Parse([]byte("# inventory.v1.Inventory/ListItems\n## interval: 5ms\n## status: unavailable\n[{\"sku\": \"A\"}, {\"sku\": \"B\"}]"))
+	require.Nil(t, err, "error parsing stream result")
+
+	assert.Equal(t, "/inventory.v1.Inventory/ListItems", result.Method, "leading / is added")
+	assert.Equal(t, codes.Unavailable, result.Code)
+	assert.Equal(t, 5*time.Millisecond, result.Interval)
+	assert.Len(t, result.Messages, 2)
+
+	result, err = Parse([]byte("# inventory.v1.Inventory/GetItem\n## status: 5\n## message: item not found"))
+	require.Nil(t, err, "error parsing result without a body")
+	assert.Equal(t, codes.NotFound, result.Code)
+	assert.Equal(t, "item not found", result.Message)
+	assert.Empty(t, result.Messages)
+
+	tests := map[string]string{
+		"no method":       "# GetItem\n{}",
+		"no hash":         "inventory.v1.Inventory/GetItem\n{}",
+		"invalid status":  "# inventory.v1.Inventory/GetItem\n## status: NOPE\n{}",
+		"invalid body":    "# inventory.v1.Inventory/GetItem\nnot json",
+		"invalid stream":  "# inventory.v1.Inventory/GetItem\n[{}",
+		"invalid match":   "# inventory.v1.Inventory/GetItem\n## match: {fields: {sku: \"[\"}}\n{}",
+		"invalid options": "# inventory.v1.Inventory/GetItem\n## delay: soon\n{}",
+	}
+
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(file))
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	result, err := Parse([]byte("# inventory.v1.Inventory/GetItem\n## match:\n##   fields:\n##     sku: ^MUG-\n##     customer.customer_id: \"^42$\"\n##     gift: \"true\"\n##   metadata:\n##     authorization: ^Bearer \n{}"))
+	require.Nil(t, err, "error parsing result")
+
+	fields := map[string]any{"sku": "MUG-1", "gift": true, "customer": map[string]any{"customerId": float64(42)}}
+	md := metadata.Pairs("authorization", "Bearer token")
+
+	assert.True(t, result.Match.Matches(fields, md))
+	assert.False(t, result.Match.Matches(fields, metadata.MD{}), "missing metadata")
+	assert.False(t, result.Match.Matches(map[string]any{"sku": "TEE-1"}, md), "different field")
+
+	var none *Match
+	assert.True(t, none.Matches(nil, nil))
+}
+
+// inventory is a descriptor set with the service used in the tests.
+func inventory(t *testing.T) []byte {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			JsonName: proto.String(camel(name)),
+		}
+	}
+
+	updated := field("updated_at", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	updated.TypeName = proto.String(".google.protobuf.Timestamp")
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:       proto.String("inventory.proto"),
+		Package:    proto.String("inventory.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("GetItemRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("sku", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			}},
+			{Name: proto.String("Item"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("sku", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("stock", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+				updated,
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Inventory"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("GetItem"), InputType: proto.String(".inventory.v1.GetItemRequest"), OutputType: proto.String(".inventory.v1.Item")},
+				{Name: proto.String("ListItems"), InputType: proto.String(".inventory.v1.GetItemRequest"), OutputType: proto.String(".inventory.v1.Item"), ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}}}
+
+	data, err := proto.Marshal(set)
+	require.Nil(t, err, "error marshaling descriptor set")
+
+	return data
+}
+
+func TestRegistry(t *testing.T) {
+	registry, err := LoadDescriptorSets(inventory(t))
+	require.Nil(t, err, "error loading descriptor set, the timestamp import should be found")
+
+	md, err := registry.Method("/inventory.v1.Inventory/ListItems")
+	require.Nil(t, err, "error finding method")
+	assert.True(t, md.IsStreamingServer())
+
+	_, err = registry.Method("/inventory.v1.Inventory/Missing")
+	assert.NotNil(t, err, "unknown method should fail")
+
+	_, err = registry.Method("/inventory.v1.Missing/GetItem")
+	assert.NotNil(t, err, "unknown service should fail")
+
+	info := registry.GetServiceInfo()
+	require.Contains(t, info, "inventory.v1.Inventory")
+	assert.Len(t, info["inventory.v1.Inventory"].Methods, 2)
+
+	result, err := Parse([]byte("# inventory.v1.Inventory/ListItems\n[{\"sku\": \"A\", \"stock\": 3, \"updatedAt\": \"2026-01-02T15:04:05Z\"}, {\"sku\": \"B\"}]"))
+	require.Nil(t, err, "error parsing result")
+
+	messages, err := registry.Responses(md, result)
+	require.Nil(t, err, "error building responses")
+	require.Len(t, messages, 2)
+	assert.Equal(t, map[string]any{"sku": "A", "stock": float64(3), "updatedAt": "2026-01-02T15:04:05Z"}, registry.Fields(messages[0]))
+
+	result, err = Parse([]byte("# inventory.v1.Inventory/ListItems\n{\"unknown\": 1}"))
+	require.Nil(t, err, "error parsing result")
+
+	_, err = registry.Responses(md, result)
+	assert.NotNil(t, err, "unknown fields should fail")
+
+	req := registry.NewRequest(md)
+	req.Set(md.Input().Fields().ByName("sku"), protoreflect.ValueOfString("MUG-1"))
+	assert.Equal(t, map[string]any{"sku": "MUG-1"}, registry.Fields(req))
+
+	_, err = LoadDescriptorSets([]byte("nope"))
+	assert.NotNil(t, err, "invalid descriptor set should fail")
+}
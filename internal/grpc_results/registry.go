@@ -0,0 +1,219 @@
+package grpc_results
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// well known types for descriptor sets that leave them out
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// DescriptorExtension marks the descriptor set files of a grpc service, as
+// written by protoc --descriptor_set_out.
+const DescriptorExtension = ".protoset"
+
+// Registry holds the services, messages and extensions of descriptor sets.
+type Registry struct {
+	*protoregistry.Files
+	Types *dynamicpb.Types
+}
+
+// LoadDescriptorSets builds a Registry from the content of descriptor set
+// files. Sets should be built with --include_imports, imports of the well
+// known types may be left out.
+func LoadDescriptorSets(sets ...[]byte) (*Registry, error) {
+	var files []*descriptorpb.FileDescriptorProto
+	seen := make(map[string]bool)
+
+	for _, data := range sets {
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("invalid descriptor set: %s", err)
+		}
+
+		for _, file := range set.File {
+			if !seen[file.GetName()] {
+				seen[file.GetName()] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	// the well known types are used without being in every set
+	protoregistry.GlobalFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		if !seen[fd.Path()] && strings.HasPrefix(fd.Path(), "google/protobuf/") {
+			files = append(files, protodesc.ToFileDescriptorProto(fd))
+		}
+		return true
+	})
+
+	registry, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: files})
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %s", err)
+	}
+
+	return &Registry{Files: registry, Types: dynamicpb.NewTypes(registry)}, nil
+}
+
+// Method finds a method by its full name, like /inventory.v1.Inventory/GetItem.
+func (r *Registry) Method(name string) (protoreflect.MethodDescriptor, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(name, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid method: %s", name)
+	}
+
+	d, err := r.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("unknown service: %s", service)
+	}
+
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("unknown service: %s", service)
+	}
+
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("unknown method: %s", name)
+	}
+
+	return md, nil
+}
+
+// Services lists every service by its full name.
+func (r *Registry) Services() []protoreflect.ServiceDescriptor {
+	var services []protoreflect.ServiceDescriptor
+
+	r.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			services = append(services, fd.Services().Get(i))
+		}
+		return true
+	})
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].FullName() < services[j].FullName()
+	})
+
+	return services
+}
+
+// GetServiceInfo describes the services for server reflection.
+func (r *Registry) GetServiceInfo() map[string]grpc.ServiceInfo {
+	info := make(map[string]grpc.ServiceInfo)
+
+	for _, sd := range r.Services() {
+		var methods []grpc.MethodInfo
+		for i := 0; i < sd.Methods().Len(); i++ {
+			md := sd.Methods().Get(i)
+			methods = append(methods, grpc.MethodInfo{
+				Name:           string(md.Name()),
+				IsClientStream: md.IsStreamingClient(),
+				IsServerStream: md.IsStreamingServer(),
+			})
+		}
+
+		info[string(sd.FullName())] = grpc.ServiceInfo{Methods: methods, Metadata: sd.ParentFile().Path()}
+	}
+
+	return info
+}
+
+// FindExtensionByName finds an extension for server reflection.
+func (r *Registry) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return r.Types.FindExtensionByName(name)
+}
+
+// FindExtensionByNumber finds an extension for server reflection.
+func (r *Registry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return r.Types.FindExtensionByNumber(message, field)
+}
+
+// RangeExtensionsByMessage calls f with every extension of message.
+func (r *Registry) RangeExtensionsByMessage(message protoreflect.FullName, f func(protoreflect.ExtensionType) bool) {
+	var extensions []protoreflect.ExtensionDescriptor
+
+	var collect func(xds protoreflect.ExtensionDescriptors, mds protoreflect.MessageDescriptors)
+	collect = func(xds protoreflect.ExtensionDescriptors, mds protoreflect.MessageDescriptors) {
+		for i := 0; i < xds.Len(); i++ {
+			if xds.Get(i).ContainingMessage().FullName() == message {
+				extensions = append(extensions, xds.Get(i))
+			}
+		}
+
+		for i := 0; i < mds.Len(); i++ {
+			collect(mds.Get(i).Extensions(), mds.Get(i).Messages())
+		}
+	}
+
+	r.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		collect(fd.Extensions(), fd.Messages())
+		return true
+	})
+
+	for _, xd := range extensions {
+		if !f(dynamicpb.NewExtensionType(xd)) {
+			return
+		}
+	}
+}
+
+// NewRequest creates an empty request message of md, to read a call into.
+func (r *Registry) NewRequest(md protoreflect.MethodDescriptor) *dynamicpb.Message {
+	return dynamicpb.NewMessage(md.Input())
+}
+
+// NewResponse creates an empty response message of md.
+func (r *Registry) NewResponse(md protoreflect.MethodDescriptor) *dynamicpb.Message {
+	return dynamicpb.NewMessage(md.Output())
+}
+
+// Responses builds the response messages of result for md.
+func (r *Registry) Responses(md protoreflect.MethodDescriptor, result *Result) ([]proto.Message, error) {
+	messages := make([]proto.Message, 0, len(result.Messages))
+
+	for _, data := range result.Messages {
+		msg := r.NewResponse(md)
+
+		opts := protojson.UnmarshalOptions{Resolver: r.Types}
+		if err := opts.Unmarshal(data, msg); err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", md.Output().FullName(), err)
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// Fields returns msg as JSON, for matching and logging.
+func (r *Registry) Fields(msg proto.Message) map[string]any {
+	opts := protojson.MarshalOptions{Resolver: r.Types, EmitUnpopulated: true}
+
+	data, err := opts.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+
+	var fields map[string]any
+	_ = json.Unmarshal(data, &fields)
+
+	return fields
+}
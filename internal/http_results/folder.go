@@ -0,0 +1,103 @@
+package http_results
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FolderFile holds the Folder settings of the folder it is in.
+const FolderFile = "_folder.yaml"
+
+// Folder is shared by the response files in a folder and the folders below
+// it.
+//
+//	prefix: /v1
+//	headers:
+//	  X-Api-Version: "1"
+//	delay: 200ms
+//	contentType: application/json
+type Folder struct {
+	// Prefix is put in front of the paths of the responses.
+	Prefix string `yaml:"prefix"`
+
+	// Headers are sent with every response, unless the response sets them.
+	Headers map[string]string `yaml:"headers"`
+
+	// Delay is used by responses without one of their own.
+	Delay time.Duration `yaml:"delay"`
+
+	// ContentType is used by responses without one of their own.
+	ContentType string `yaml:"contentType"`
+}
+
+// ParseFolder takes in the content of a folder file and creates a Folder.
+func ParseFolder(data []byte) (Folder, error) {
+	var f Folder
+
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("invalid folder settings: %s", err)
+	}
+
+	if f.Prefix != "" && !strings.HasPrefix(f.Prefix, "/") {
+		return f, fmt.Errorf("invalid folder prefix, it must start with /: %s", f.Prefix)
+	}
+
+	return f, nil
+}
+
+// Inherit returns the settings of f for a folder inside parent. The prefixes
+// are joined, everything else set in f wins.
+func (f Folder) Inherit(parent Folder) Folder {
+	merged := parent
+
+	if f.Prefix != "" {
+		merged.Prefix = path.Join("/", parent.Prefix, f.Prefix)
+	}
+
+	if len(f.Headers) > 0 {
+		merged.Headers = maps.Clone(parent.Headers)
+		if merged.Headers == nil {
+			merged.Headers = make(map[string]string, len(f.Headers))
+		}
+		maps.Copy(merged.Headers, f.Headers)
+	}
+
+	if f.Delay != 0 {
+		merged.Delay = f.Delay
+	}
+
+	if f.ContentType != "" {
+		merged.ContentType = f.ContentType
+	}
+
+	return merged
+}
+
+// Apply returns a copy of r using the folder's settings.
+func (f Folder) Apply(r *Result) *Result {
+	applied := *r
+
+	if f.Prefix != "" {
+		applied.Path = path.Join(f.Prefix, r.Path)
+	}
+
+	if len(f.Headers) > 0 {
+		applied.Headers = maps.Clone(f.Headers)
+		maps.Copy(applied.Headers, r.Headers)
+	}
+
+	if applied.Delay == 0 {
+		applied.Delay = f.Delay
+	}
+
+	if applied.ContentType == "" {
+		applied.ContentType = f.ContentType
+	}
+
+	return &applied
+}
@@ -0,0 +1,36 @@
+package http_results
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFolder(t *testing.T) {
+	parent, err := ParseFolder([]byte("prefix: /api\nheaders: {X-Api-Version: \"1\", X-Env: test}\ncontentType: application/json\n"))
+	require.Nil(t, err, "error parsing folder")
+
+	child, err := ParseFolder([]byte("prefix: /v1\nheaders: {X-Api-Version: \"2\"}\ndelay: 100ms\n"))
+	require.Nil(t, err, "error parsing folder")
+
+	folder := child.Inherit(parent)
+	assert.Equal(t, "/api/v1", folder.Prefix)
+	assert.Equal(t, map[string]string{"X-Api-Version": "2", "X-Env": "test"}, folder.Headers)
+	assert.Equal(t, 100*time.Millisecond, folder.Delay)
+	assert.Equal(t, "application/json", folder.ContentType)
+
+	result, err := Parse([]byte("# GET /users/:id 200\n## headers: {X-Env: dev}\n{}"))
+	require.Nil(t, err, "error parsing without content type")
+
+	applied := folder.Apply(result)
+	assert.Equal(t, "/api/v1/users/:id", applied.Path)
+	assert.Equal(t, "application/json", applied.ContentType)
+	assert.Equal(t, "dev", applied.Headers["X-Env"], "response headers win")
+	assert.Equal(t, "2", applied.Headers["X-Api-Version"])
+	assert.Equal(t, "/users/:id", result.Path, "result was changed")
+
+	_, err = ParseFolder([]byte("prefix: v1\n"))
+	assert.NotNil(t, err, "prefix without / should fail")
+}
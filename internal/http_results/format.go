@@ -0,0 +1,89 @@
+package http_results
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Format creates the content of a response file that Parse turns back into
+// result. JSON bodies are indented to make them easier to edit.
+func Format(result *Result) []byte {
+	contentType := result.ContentType
+	if media, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = media
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s %s %d %s\n", result.Method, result.Path, result.Code, contentType)
+
+	data := bytes.TrimSpace(result.Data)
+	if json.Valid(data) {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err == nil {
+			data = indented.Bytes()
+		}
+	}
+
+	buf.Write(data)
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+// GeneralizePath replaces the segments of path that look like ids with route
+// parameters: the first becomes :param, the next :param2 and so on.
+//
+//	/payments/pay_987654321/refund => /payments/:param/refund
+func GeneralizePath(path string) string {
+	segments := strings.Split(path, "/")
+
+	n := 0
+	for i, segment := range segments {
+		if !isID(segment) {
+			continue
+		}
+
+		n++
+		if n == 1 {
+			segments[i] = ":param"
+		} else {
+			segments[i] = ":param" + strconv.Itoa(n)
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// isID reports whether a path segment looks like an identifier rather than a
+// fixed part of the route: a number, a UUID or a hex string, on its own or
+// after a prefix like pay_987654321 or user-42.
+func isID(segment string) bool {
+	if segment == "" {
+		return false
+	}
+
+	if _, err := uuid.Parse(segment); err == nil {
+		return true
+	}
+
+	if i := strings.LastIndexAny(segment, "_-"); i > 0 {
+		segment = segment[i+1:]
+	}
+
+	if _, err := strconv.ParseUint(segment, 10, 64); err == nil {
+		return true
+	}
+
+	// hashes and object ids, like 5f3a9c2e or 507f1f77bcf86cd799439011
+	return len(segment) >= 8 && strings.ContainsAny(segment, "0123456789") &&
+		strings.Trim(strings.ToLower(segment), "0123456789abcdef") == ""
+}
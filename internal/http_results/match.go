@@ -0,0 +1,87 @@
+package http_results
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Match limits the requests a Result answers. Every value is a regular
+// expression that must match for the Result to be used.
+type Match struct {
+	Headers    map[string]string `yaml:"headers" json:"headers,omitempty"`
+	Query      map[string]string `yaml:"query" json:"query,omitempty"`
+	ClientCert string            `yaml:"clientCert" json:"clientCert,omitempty"`
+
+	headers    map[string]*regexp.Regexp
+	query      map[string]*regexp.Regexp
+	clientCert *regexp.Regexp
+}
+
+// Matches reports whether req satisfies every expression in the Match. A nil
+// Match matches every request.
+func (m *Match) Matches(req Request) bool {
+	if m == nil {
+		return true
+	}
+
+	for name, re := range m.headers {
+		value, ok := req.Headers[name]
+		if !ok || !re.MatchString(value) {
+			return false
+		}
+	}
+
+	for name, re := range m.query {
+		value, ok := req.Query[name]
+		if !ok || !re.MatchString(value) {
+			return false
+		}
+	}
+
+	if m.clientCert != nil {
+		if req.ClientCert == nil || !m.clientCert.MatchString(req.ClientCert.Subject) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compile prepares the regular expressions used by Matches.
+func (m *Match) compile() error {
+	var err error
+
+	if m.headers, err = compileAll("header", m.Headers, canonicalHeader); err != nil {
+		return err
+	}
+
+	if m.query, err = compileAll("query", m.Query, nil); err != nil {
+		return err
+	}
+
+	if m.ClientCert != "" {
+		if m.clientCert, err = regexp.Compile(m.ClientCert); err != nil {
+			return fmt.Errorf("invalid clientCert match %q: %s", m.ClientCert, err)
+		}
+	}
+
+	return nil
+}
+
+func compileAll(kind string, patterns map[string]string, key func(string) string) (map[string]*regexp.Regexp, error) {
+	compiled := make(map[string]*regexp.Regexp, len(patterns))
+
+	for name, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match %s %q: %s", kind, name, pattern, err)
+		}
+
+		if key != nil {
+			name = key(name)
+		}
+		compiled[name] = re
+	}
+
+	return compiled, nil
+}
@@ -1,11 +1,15 @@
 package http_results
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
+
+	"github.com/crit/fake-ops/internal/ratelimit"
+	"gopkg.in/yaml.v3"
 )
 
 // Result is parsed from a http response file.
@@ -15,6 +19,41 @@ type Result struct {
 	Path        string
 	ContentType string
 	Data        []byte
+
+	// File is the response file this Result was parsed from, when known.
+	File string
+
+	Options
+
+	tmpl *template.Template
+}
+
+// Options are set by the yaml in lines starting with ## that directly follow
+// the first line of a response file.
+//
+//	# GET /users/:id 200 application/json
+//	## template: true
+//	## match:
+//	##   headers:
+//	##     X-Tenant: acme
+type Options struct {
+	// Template renders Data as a text/template for every request.
+	Template bool `yaml:"template"`
+
+	// Match limits which requests this Result answers.
+	Match *Match `yaml:"match"`
+
+	// Headers are sent with the response.
+	Headers map[string]string `yaml:"headers"`
+
+	// Delay is waited before responding, instead of the service's delay.
+	Delay time.Duration `yaml:"delay"`
+
+	// RateLimit answers requests over the limit with a 429 instead.
+	RateLimit *ratelimit.Config `yaml:"rateLimit"`
+
+	// Webhooks are sent after answering.
+	Webhooks []*Webhook `yaml:"webhooks"`
 }
 
 // Parse takes in the content of a response file and creates a Result.
@@ -22,13 +61,13 @@ func Parse(data []byte) (*Result, error) {
 	var result Result
 
 	// get first line of data
-	scanner := bufio.NewScanner(bytes.NewReader(data))
-	scanner.Scan()
-	line := scanner.Text()
+	line, rest, _ := bytes.Cut(data, []byte("\n"))
+	line = bytes.TrimRight(line, "\r")
 
 	// # GET /api/v1/users 200 application/json => ["#", "GET", "/api/v1/users", "200", "application/json"]
-	parts := strings.Split(line, " ")
-	if len(parts) < 5 {
+	// The content type may be left to the folder settings.
+	parts := strings.Split(string(line), " ")
+	if len(parts) < 4 {
 		return nil, fmt.Errorf("invalid line: %s", line)
 	}
 
@@ -45,10 +84,59 @@ func Parse(data []byte) (*Result, error) {
 		return nil, fmt.Errorf("invalid code: %s", parts[3])
 	}
 
-	result.ContentType = parts[4]
+	if len(parts) > 4 {
+		result.ContentType = parts[4]
+	}
+
+	// lines starting with ## hold options
+	var options []byte
+	for bytes.HasPrefix(rest, []byte("##")) {
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		line = bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("##")), []byte(" "))
+		options = append(append(options, line...), '\n')
+	}
+
+	if err := result.parseOptions(options); err != nil {
+		return nil, err
+	}
 
 	// rest of the data is put into result.Data
-	result.Data = bytes.TrimSpace(data[len(scanner.Bytes()):])
+	result.Data = bytes.TrimSpace(rest)
+
+	if err := result.compileTemplate(); err != nil {
+		return nil, err
+	}
 
 	return &result, nil
 }
+
+// parseOptions decodes the yaml from ## lines.
+func (r *Result) parseOptions(data []byte) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	if err := yaml.Unmarshal(data, &r.Options); err != nil {
+		return fmt.Errorf("invalid options: %s", err)
+	}
+
+	if r.Match != nil {
+		if err := r.Match.compile(); err != nil {
+			return err
+		}
+	}
+
+	if r.RateLimit != nil {
+		if err := r.RateLimit.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, w := range r.Webhooks {
+		if err := w.compile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
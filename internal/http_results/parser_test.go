@@ -1,7 +1,10 @@
 package http_results
 
 import (
+	"io"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -33,3 +36,108 @@ func TestParser(t *testing.T) {
 	assert.Equal(t, "application/json", result.ContentType, "content type is not correct")
 	assert.Equal(t, postResult, result.Data, "data is not correct")
 }
+
+func TestFormat(t *testing.T) {
+	result := &Result{
+		Code:        201,
+		Method:      "POST",
+		Path:        "/payments/:param/refund",
+		ContentType: "application/json; charset=utf-8",
+		Data:        []byte(`{"status":"SUCCESS"}`),
+	}
+
+	data := Format(result)
+	assert.Equal(t, "# POST /payments/:param/refund 201 application/json\n{\n  \"status\": \"SUCCESS\"\n}\n", string(data))
+
+	parsed, err := Parse(data)
+	require.Nil(t, err, "error parsing formatted result")
+	assert.Equal(t, result.Path, parsed.Path, "path is not correct")
+	assert.Equal(t, "application/json", parsed.ContentType, "content type is not correct")
+}
+
+func TestGeneralizePath(t *testing.T) {
+	assert.Equal(t, "/payments/:param/refund", GeneralizePath("/payments/pay_987654321/refund"))
+	assert.Equal(t, "/users/:param/posts/:param2", GeneralizePath("/users/42/posts/8BC48765-6456-4F70-9B73-E03CE3760F44"))
+	assert.Equal(t, "/api/v1/users", GeneralizePath("/api/v1/users"))
+	assert.Equal(t, "/api/v2-users/:param", GeneralizePath("/api/v2-users/user-42"))
+	assert.Equal(t, "/files/:param/sha256sum", GeneralizePath("/files/507f1f77bcf86cd799439011/sha256sum"))
+	assert.Equal(t, "/teams/backend2024/members", GeneralizePath("/teams/backend2024/members"))
+	assert.Equal(t, "/", GeneralizePath("/"))
+}
+
+var matched = []byte(
+	`# GET /payments/:id 200 application/json
+## template: true
+## match:
+##   clientCert: CN=checkout
+##   headers:
+##     x-tenant: ^acme$
+{"id": "{{.Params.id}}", "client": "{{.ClientCert.CommonName}}"}
+`)
+
+func TestParserOptions(t *testing.T) {
+	result, err := Parse(matched)
+	require.Nil(t, err, "error parsing")
+
+	assert.True(t, result.Template, "template option not set")
+	require.NotNil(t, result.Match, "match option not set")
+	assert.Equal(t, `{"id": "{{.Params.id}}", "client": "{{.ClientCert.CommonName}}"}`, string(result.Data), "options are in the data")
+
+	req := Request{
+		Params:     map[string]string{"id": "pay_1"},
+		Headers:    map[string]string{"X-Tenant": "acme"},
+		ClientCert: &ClientCert{Subject: "CN=checkout,O=fake-ops", CommonName: "checkout"},
+	}
+	assert.True(t, result.Match.Matches(req), "request should match")
+
+	data, err := result.Render(req)
+	require.Nil(t, err, "error rendering")
+	assert.Equal(t, `{"id": "pay_1", "client": "checkout"}`, string(data), "template not rendered")
+
+	req.ClientCert = nil
+	assert.False(t, result.Match.Matches(req), "request without a client cert should not match")
+
+	req.ClientCert = &ClientCert{Subject: "CN=checkout"}
+	req.Headers["X-Tenant"] = "acme-eu"
+	assert.False(t, result.Match.Matches(req), "request with another tenant should not match")
+}
+
+func TestParserInvalidOptions(t *testing.T) {
+	_, err := Parse([]byte("# GET / 200 text/plain\n## match: {headers: {X-A: \"(\"}}\nbody"))
+	assert.NotNil(t, err, "invalid match expression should fail")
+
+	_, err = Parse([]byte("# GET / 200 text/plain\n## template: true\n{{.Nope"))
+	assert.NotNil(t, err, "invalid template should fail")
+
+	_, err = Parse([]byte("# GET / 200 text/plain\n## rateLimit: {limit: 0}\nbody"))
+	assert.NotNil(t, err, "rate limit without a limit should fail")
+}
+
+func TestParserWebhooks(t *testing.T) {
+	result, err := Parse([]byte(`# POST /payments 201 application/json
+## webhooks:
+##   - url: http://localhost:3000/hooks/{{.Query.tenant}}
+##     headers: {X-Event: payment.succeeded}
+##     body: '{"id": "{{.ResponseJSON.id}}", "amount": {{.ResponseJSON.amount}}}'
+##     delay: 2s
+{"id": "pay_1", "amount": 100}`))
+	require.Nil(t, err, "error parsing")
+	require.Len(t, result.Webhooks, 1)
+
+	hook := result.Webhooks[0]
+	assert.Equal(t, 2*time.Second, hook.Delay)
+
+	req := Request{Query: map[string]string{"tenant": "acme"}}
+	r, err := hook.NewRequest(NewWebhookData(req, result.Data))
+	require.Nil(t, err, "error rendering webhook")
+
+	body, _ := io.ReadAll(r.Body)
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.Equal(t, "http://localhost:3000/hooks/acme", r.URL.String())
+	assert.Equal(t, "payment.succeeded", r.Header.Get("X-Event"))
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"id": "pay_1", "amount": 100}`, string(body))
+
+	_, err = Parse([]byte("# GET / 200 text/plain\n## webhooks: [{body: hi}]\nbody"))
+	assert.NotNil(t, err, "webhook without url should fail")
+}
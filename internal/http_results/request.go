@@ -0,0 +1,82 @@
+package http_results
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// Request describes the request being answered. It is what matchers check and
+// what templates render with.
+type Request struct {
+	Method     string
+	Path       string
+	Params     map[string]string
+	Query      map[string]string
+	Headers    map[string]string
+	Body       string
+	ClientCert *ClientCert
+
+	// Claims are decoded from the bearer token that authorized the request.
+	Claims map[string]any
+}
+
+// ClientCert describes the verified certificate a client connected with.
+type ClientCert struct {
+	Subject      string
+	CommonName   string
+	Organization []string
+	SerialNumber string
+}
+
+// NewRequest describes r. Only the first value of each header and query
+// parameter is kept. The body is read and replaced so it can be read again.
+func NewRequest(r *http.Request, params map[string]string) Request {
+	req := Request{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Params:     params,
+		Query:      make(map[string]string),
+		Headers:    make(map[string]string),
+		ClientCert: NewClientCert(r.TLS),
+	}
+
+	for name, values := range r.URL.Query() {
+		req.Query[name] = values[0]
+	}
+
+	for name, values := range r.Header {
+		req.Headers[name] = values[0]
+	}
+
+	if r.Body != nil {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		req.Body = string(body)
+	}
+
+	return req
+}
+
+// NewClientCert describes the verified client certificate of a connection,
+// or returns nil when there is none.
+func NewClientCert(state *tls.ConnectionState) *ClientCert {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := state.VerifiedChains[0][0]
+
+	return &ClientCert{
+		Subject:      cert.Subject.String(),
+		CommonName:   cert.Subject.CommonName,
+		Organization: cert.Subject.Organization,
+		SerialNumber: cert.SerialNumber.String(),
+	}
+}
+
+func canonicalHeader(name string) string {
+	return textproto.CanonicalMIMEHeaderKey(name)
+}
@@ -0,0 +1,52 @@
+package http_results
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// funcs are available to response templates.
+var funcs = template.FuncMap{
+	"uuid": uuid.NewString,
+	"now":  func() string { return time.Now().UTC().Format(time.RFC3339) },
+}
+
+// TemplateFuncs returns the functions available to templates, for the other
+// kinds of fakes rendering templates like response files do.
+func TemplateFuncs() template.FuncMap {
+	return funcs
+}
+
+// compileTemplate prepares Data for Render when the Result is a template.
+func (r *Result) compileTemplate() error {
+	if !r.Template {
+		return nil
+	}
+
+	tmpl, err := template.New(r.Method + " " + r.Path).Funcs(funcs).Parse(string(r.Data))
+	if err != nil {
+		return fmt.Errorf("invalid template: %s", err)
+	}
+
+	r.tmpl = tmpl
+	return nil
+}
+
+// Render creates the response body for req. Data is returned as is unless the
+// Result is a template.
+func (r *Result) Render(req Request) ([]byte, error) {
+	if r.tmpl == nil {
+		return r.Data, nil
+	}
+
+	var buf bytes.Buffer
+	if err := r.tmpl.Execute(&buf, req); err != nil {
+		return nil, fmt.Errorf("failed to render template: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,134 @@
+package http_results
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// Webhook is a request sent after a Result has answered, like the callback a
+// real provider makes once it has processed a payment. URL, header values and
+// Body are templates rendered with the request and response.
+//
+//	## webhooks:
+//	##   - url: http://localhost:3000/webhooks/payments
+//	##     delay: 2s
+//	##     body: '{"id": "{{.ResponseJSON.id}}", "status": "succeeded"}'
+type Webhook struct {
+	Method  string            `yaml:"method" json:"method,omitempty"`
+	URL     string            `yaml:"url" json:"url"`
+	Headers map[string]string `yaml:"headers" json:"headers,omitempty"`
+	Body    string            `yaml:"body" json:"body,omitempty"`
+
+	// Delay is how long to wait after responding before sending.
+	Delay time.Duration `yaml:"delay" json:"delay,omitempty"`
+
+	// Retries is how many more times a failed delivery is attempted.
+	Retries int `yaml:"retries" json:"retries,omitempty"`
+
+	// RetryDelay is the wait between attempts. Defaults to a second.
+	RetryDelay time.Duration `yaml:"retryDelay" json:"retryDelay,omitempty"`
+
+	url     *template.Template
+	headers map[string]*template.Template
+	body    *template.Template
+}
+
+// WebhookData is what webhook templates are rendered with: the request that
+// triggered it, and the response sent back.
+type WebhookData struct {
+	Request
+
+	// Response is the response body.
+	Response string
+
+	// ResponseJSON is the response body decoded, when it is JSON.
+	ResponseJSON any
+}
+
+// NewWebhookData creates the data webhook templates of a Result answering req
+// with response are rendered with.
+func NewWebhookData(req Request, response []byte) WebhookData {
+	data := WebhookData{Request: req, Response: string(response)}
+	_ = json.Unmarshal(response, &data.ResponseJSON)
+
+	return data
+}
+
+// compile prepares the templates used by NewRequest.
+func (w *Webhook) compile() error {
+	if w.URL == "" {
+		return fmt.Errorf("webhook url is required")
+	}
+
+	if w.Method == "" {
+		w.Method = http.MethodPost
+	}
+
+	if w.RetryDelay == 0 {
+		w.RetryDelay = time.Second
+	}
+
+	var err error
+	if w.url, err = template.New("url").Funcs(funcs).Parse(w.URL); err != nil {
+		return fmt.Errorf("invalid webhook url: %s", err)
+	}
+
+	if w.body, err = template.New("body").Funcs(funcs).Parse(w.Body); err != nil {
+		return fmt.Errorf("invalid webhook body: %s", err)
+	}
+
+	w.headers = make(map[string]*template.Template, len(w.Headers))
+	for name, value := range w.Headers {
+		if w.headers[name], err = template.New(name).Funcs(funcs).Parse(value); err != nil {
+			return fmt.Errorf("invalid webhook header %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// NewRequest renders the webhook into a request.
+func (w *Webhook) NewRequest(data WebhookData) (*http.Request, error) {
+	url, err := execute(w.url, data)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := execute(w.body, data)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequest(w.Method, url, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	if body != "" && json.Valid([]byte(body)) {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	for name, tmpl := range w.headers {
+		value, err := execute(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Header.Set(name, value)
+	}
+
+	return r, nil
+}
+
+func execute(tmpl *template.Template, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render webhook: %s", err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,128 @@
+package journal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSize is how many entries a Journal keeps when no size is given.
+const DefaultSize = 100
+
+// Entry records a request received by an HTTP service and how it was
+// answered.
+type Entry struct {
+	ID         int64               `json:"id"`
+	Time       time.Time           `json:"time"`
+	Protocol   string              `json:"protocol"`
+	Method     string              `json:"method"`
+	Path       string              `json:"path"`
+	Route      string              `json:"route"`
+	Params     map[string]string   `json:"params"`
+	Query      map[string][]string `json:"query"`
+	Headers    http.Header         `json:"headers"`
+	Body       string              `json:"body"`
+	ClientCert string              `json:"clientCert,omitempty"`
+	File       string              `json:"file"`
+	Source     string              `json:"source"`
+	Status     int                 `json:"status"`
+	Latency    time.Duration       `json:"latency"`
+}
+
+// Query filters the entries returned by a Journal. Empty fields match
+// everything.
+type Query struct {
+	Method  string
+	Path    string // matches entries whose path starts with Path
+	Since   time.Time
+	AfterID int64
+	Limit   int // keeps only the most recent Limit entries
+}
+
+// matches reports whether e satisfies the query.
+func (q Query) matches(e Entry) bool {
+	if q.Method != "" && !strings.EqualFold(q.Method, e.Method) {
+		return false
+	}
+
+	if q.Path != "" && !strings.HasPrefix(e.Path, q.Path) {
+		return false
+	}
+
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+
+	return e.ID > q.AfterID
+}
+
+// Journal keeps the most recent requests received by a service.
+type Journal struct {
+	mu      sync.RWMutex
+	size    int
+	entries []Entry
+	lastID  int64
+}
+
+// New creates a Journal keeping at most size entries.
+func New(size int) *Journal {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	return &Journal{size: size}
+}
+
+// Add records an entry, dropping the oldest one when the Journal is full.
+func (j *Journal) Add(e Entry) Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.lastID++
+	e.ID = j.lastID
+
+	if len(j.entries) >= j.size {
+		j.entries = append(j.entries[:0], j.entries[len(j.entries)-j.size+1:]...)
+	}
+	j.entries = append(j.entries, e)
+
+	return e
+}
+
+// Entries returns the entries matching q, oldest first.
+func (j *Journal) Entries(q Query) []Entry {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	list := []Entry{}
+	for _, e := range j.entries {
+		if q.matches(e) {
+			list = append(list, e)
+		}
+	}
+
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[len(list)-q.Limit:]
+	}
+
+	return list
+}
+
+// Clear removes every entry.
+func (j *Journal) Clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = nil
+}
+
+// Export writes every entry to w as indented JSON.
+func (j *Journal) Export(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(j.Entries(Query{}))
+}
@@ -0,0 +1,55 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalBounded(t *testing.T) {
+	j := New(3)
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		j.Add(Entry{Method: "GET", Path: path})
+	}
+
+	entries := j.Entries(Query{})
+	require.Len(t, entries, 3, "journal is not bounded")
+	assert.Equal(t, "/c", entries[0].Path, "oldest entries were not dropped")
+	assert.Equal(t, int64(5), entries[2].ID, "ids are not sequential")
+}
+
+func TestJournalQuery(t *testing.T) {
+	j := New(10)
+	start := time.Now()
+	j.Add(Entry{Method: "GET", Path: "/payments/1", Time: start})
+	j.Add(Entry{Method: "POST", Path: "/payments/1/refund", Time: start.Add(time.Second)})
+	j.Add(Entry{Method: "POST", Path: "/users", Time: start.Add(2 * time.Second)})
+
+	assert.Len(t, j.Entries(Query{Method: "post"}), 2, "method filter")
+	assert.Len(t, j.Entries(Query{Path: "/payments"}), 2, "path filter")
+	assert.Len(t, j.Entries(Query{Since: start.Add(time.Second)}), 2, "since filter")
+	assert.Len(t, j.Entries(Query{AfterID: 2}), 1, "after id filter")
+
+	latest := j.Entries(Query{Limit: 1})
+	require.Len(t, latest, 1, "limit")
+	assert.Equal(t, "/users", latest[0].Path, "limit keeps the most recent")
+}
+
+func TestJournalClearAndExport(t *testing.T) {
+	j := New(10)
+	j.Add(Entry{Method: "GET", Path: "/a"})
+
+	var buf bytes.Buffer
+	require.Nil(t, j.Export(&buf), "error exporting")
+
+	var exported []Entry
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &exported), "export is not json")
+	assert.Len(t, exported, 1, "export is missing entries")
+
+	j.Clear()
+	assert.Empty(t, j.Entries(Query{}), "journal was not cleared")
+}
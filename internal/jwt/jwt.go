@@ -0,0 +1,252 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyFile is written to the key directory.
+const KeyFile = "jwt-key.pem"
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid token signature")
+	ErrExpired   = errors.New("token is expired")
+	ErrNotYet    = errors.New("token is not valid yet")
+)
+
+var (
+	mu   sync.Mutex
+	keys = make(map[string]*Key)
+)
+
+// Claims are the decoded payload of a token.
+type Claims map[string]any
+
+// Key signs and verifies RS256 tokens. Its public half is published as a
+// JSON Web Key Set so clients can verify tokens too.
+type Key struct {
+	ID      string
+	Private *rsa.PrivateKey
+}
+
+// LoadKey reads the signing key stored in dir, creating one when dir does not
+// have it yet. Services share the key loaded for a dir.
+func LoadKey(dir string) (*Key, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if k, ok := keys[dir]; ok {
+		return k, nil
+	}
+
+	k, err := readKey(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		k, err = createKey(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys[dir] = k
+	return k, nil
+}
+
+// Sign creates a token for claims.
+func (k *Key) Sign(claims Claims) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": k.ID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, k.Private, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + encode(signature), nil
+}
+
+// Verify checks the signature and validity period of token and returns its
+// claims.
+func (k *Key) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJSON(parts[0], &header); err != nil || header.Alg != "RS256" {
+		return nil, ErrMalformed
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&k.Private.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrSignature
+	}
+
+	var claims Claims
+	if err := decodeJSON(parts[1], &claims); err != nil {
+		return nil, ErrMalformed
+	}
+
+	now := time.Now()
+
+	if exp, ok := claims.Time("exp"); ok && !now.Before(exp) {
+		return claims, ErrExpired
+	}
+
+	if nbf, ok := claims.Time("nbf"); ok && now.Before(nbf) {
+		return claims, ErrNotYet
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the JSON Web Key Set publishing the public half of the key.
+func (k *Key) JWKS() map[string]any {
+	pub := k.Private.PublicKey
+
+	return map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": k.ID,
+			"n":   encode(pub.N.Bytes()),
+			"e":   encode(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	}
+}
+
+// Time reads a NumericDate claim such as exp.
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+// Strings reads a claim that may be a single string, a space separated string
+// or a list of strings, such as aud or scope.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+func readKey(dir string) (*Key, error) {
+	data, err := os.ReadFile(filepath.Join(dir, KeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid jwt key in %s", dir)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt key in %s: %s", dir, err)
+	}
+
+	private, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("jwt key in %s is not an RSA key", dir)
+	}
+
+	return newKey(private)
+}
+
+func createKey(dir string) (*Key, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, KeyFile), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+
+	return newKey(private)
+}
+
+// newKey identifies private by a thumbprint of its public half.
+func newKey(private *rsa.PrivateKey) (*Key, error) {
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(der)
+
+	return &Key{ID: encode(sum[:])[:16], Private: private}, nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeJSON(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,63 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	key, err := LoadKey(dir)
+	require.Nil(t, err, "error creating key")
+
+	token, err := key.Sign(Claims{"sub": "alice", "scope": "payments:read payments:write", "exp": time.Now().Add(time.Hour).Unix()})
+	require.Nil(t, err, "error signing")
+
+	// a fresh read from disk must verify tokens signed before
+	reread, err := readKey(dir)
+	require.Nil(t, err, "error reading key")
+	assert.Equal(t, key.ID, reread.ID, "key id changed")
+
+	claims, err := reread.Verify(token)
+	require.Nil(t, err, "error verifying")
+	assert.Equal(t, "alice", claims["sub"])
+	assert.Equal(t, []string{"payments:read", "payments:write"}, claims.Strings("scope"))
+}
+
+func TestVerifyRejects(t *testing.T) {
+	key, err := LoadKey(t.TempDir())
+	require.Nil(t, err, "error creating key")
+
+	expired, err := key.Sign(Claims{"sub": "alice", "exp": time.Now().Add(-time.Minute).Unix()})
+	require.Nil(t, err, "error signing")
+
+	_, err = key.Verify(expired)
+	assert.ErrorIs(t, err, ErrExpired)
+
+	token, err := key.Sign(Claims{"sub": "alice"})
+	require.Nil(t, err, "error signing")
+
+	parts := strings.Split(token, ".")
+	forged, err := key.Sign(Claims{"sub": "mallory"})
+	require.Nil(t, err, "error signing")
+
+	_, err = key.Verify(parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2])
+	assert.ErrorIs(t, err, ErrSignature)
+
+	_, err = key.Verify("not-a-token")
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestJWKS(t *testing.T) {
+	key, err := LoadKey(t.TempDir())
+	require.Nil(t, err, "error creating key")
+
+	set := key.JWKS()["keys"].([]map[string]string)
+	require.Len(t, set, 1)
+	assert.Equal(t, key.ID, set[0]["kid"])
+	assert.Equal(t, "AQAB", set[0]["e"], "exponent is not 65537")
+}
@@ -0,0 +1,230 @@
+package mailbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSize is how many messages a Mailbox keeps when no size is given.
+const DefaultSize = 100
+
+// Extension marks the files messages are stored in.
+const Extension = ".eml"
+
+// Config is parsed from the smtp section of a service yaml file.
+type Config struct {
+	// Dir stores every message as a file in this directory as well as in
+	// memory. Messages already in it are loaded when the service starts.
+	Dir string `yaml:"dir"`
+
+	// Size is how many messages are kept in memory. Defaults to DefaultSize.
+	Size int `yaml:"size"`
+}
+
+// Query filters the messages returned by a Mailbox. Empty fields match
+// everything.
+type Query struct {
+	From    string // matches messages whose sender contains From
+	To      string // matches messages with a recipient containing To
+	Subject string // matches messages whose subject contains Subject
+	AfterID int64
+	Limit   int // keeps only the most recent Limit messages
+}
+
+// matches reports whether m satisfies the query.
+func (q Query) matches(m *Message) bool {
+	if q.From != "" && !contains(q.From, m.MailFrom, m.From) {
+		return false
+	}
+
+	if q.To != "" && !contains(q.To, slices.Concat(m.RcptTo, m.To, m.Cc)...) {
+		return false
+	}
+
+	if q.Subject != "" && !contains(q.Subject, m.Subject) {
+		return false
+	}
+
+	return m.ID > q.AfterID
+}
+
+// contains reports whether any of values contains s, ignoring case.
+func contains(s string, values ...string) bool {
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), strings.ToLower(s)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Mailbox keeps the most recent messages received by a service.
+type Mailbox struct {
+	mu       sync.RWMutex
+	size     int
+	dir      string
+	messages []*Message
+	lastID   int64
+}
+
+// New creates a Mailbox keeping at most size messages in memory.
+func New(size int) *Mailbox {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	return &Mailbox{size: size}
+}
+
+// Open stores messages in dir from now on, loading the messages already in
+// it in place of the ones in memory. An empty dir keeps messages in memory
+// only. Opening the directory already open does nothing.
+func (mb *Mailbox) Open(dir string) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if dir == mb.dir {
+		return nil
+	}
+
+	mb.dir = dir
+	mb.messages = nil
+
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+Extension))
+	if err != nil {
+		return err
+	}
+
+	// file names start with the time they were received
+	slices.Sort(files)
+
+	var errs []error
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		m, err := Parse(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", file, err))
+			continue
+		}
+
+		m.File = file
+		if info, err := os.Stat(file); err == nil {
+			m.Time = info.ModTime()
+		}
+
+		mb.add(m)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Add parses and stores a raw message, writing it to the directory when the
+// Mailbox has one.
+func (mb *Mailbox) Add(raw []byte) (*Message, error) {
+	m, err := Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Time = time.Now()
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if mb.dir != "" {
+		m.File = filepath.Join(mb.dir, fmt.Sprintf("%s-%d%s", m.Time.Format("20060102-150405.000000000"), mb.lastID+1, Extension))
+		if err := os.WriteFile(m.File, raw, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	mb.add(m)
+
+	return m, nil
+}
+
+// add numbers and keeps a message, dropping the oldest one when the Mailbox
+// is full. Callers must hold mb.mu.
+func (mb *Mailbox) add(m *Message) {
+	mb.lastID++
+	m.ID = mb.lastID
+
+	if len(mb.messages) >= mb.size {
+		mb.messages = append(mb.messages[:0], mb.messages[len(mb.messages)-mb.size+1:]...)
+	}
+	mb.messages = append(mb.messages, m)
+}
+
+// Messages returns the messages matching q, oldest first.
+func (mb *Mailbox) Messages(q Query) []*Message {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	list := []*Message{}
+	for _, m := range mb.messages {
+		if q.matches(m) {
+			list = append(list, m)
+		}
+	}
+
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[len(list)-q.Limit:]
+	}
+
+	return list
+}
+
+// Message returns the message with the given id, or nil when it is not kept.
+func (mb *Mailbox) Message(id int64) *Message {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	for _, m := range mb.messages {
+		if m.ID == id {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// Clear removes every message, along with the files of the messages kept.
+func (mb *Mailbox) Clear() error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	var errs []error
+	for _, m := range mb.messages {
+		if m.File == "" {
+			continue
+		}
+
+		if err := os.Remove(m.File); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	mb.messages = nil
+
+	return errors.Join(errs...)
+}
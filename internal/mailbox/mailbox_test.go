@@ -0,0 +1,115 @@
+package mailbox
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const raw = "From: Shop <shop@example.com>\r\n" +
+	"To: Ada <ada@example.com>, bob@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Your_order_=E2=9C=93?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Thanks for your order =E2=9C=93\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Thanks for your order</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=invoice.pdf\r\n" +
+	"Content-Disposition: attachment; filename=invoice.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0x\r\n" +
+	"LjQ=\r\n" +
+	"--outer--\r\n"
+
+func TestParse(t *testing.T) {
+	m, err := Parse(Delivered([]byte(raw), "bounce@example.com", []string{"ada@example.com"}))
+	require.Nil(t, err, "error parsing message")
+
+	assert.Equal(t, "bounce@example.com", m.MailFrom)
+	assert.Equal(t, []string{"ada@example.com"}, m.RcptTo)
+	assert.Equal(t, "shop@example.com", m.From)
+	assert.Equal(t, []string{"ada@example.com", "bob@example.com"}, m.To)
+	assert.Empty(t, m.Cc)
+	assert.Equal(t, "Your order ✓", m.Subject)
+	assert.Equal(t, []string{"Your order ✓"}, m.Headers["Subject"])
+
+	assert.Equal(t, "Thanks for your order ✓", strings.TrimSpace(m.Text))
+	assert.Equal(t, "<p>Thanks for your order</p>", strings.TrimSpace(m.HTML))
+
+	require.Len(t, m.Attachments, 1)
+	assert.Equal(t, "invoice.pdf", m.Attachments[0].Filename)
+	assert.Equal(t, "application/pdf", m.Attachments[0].ContentType)
+	assert.Equal(t, "%PDF-1.4", string(m.Attachments[0].Content))
+
+	m, err = Parse([]byte("Subject: plain\r\n\r\nhello\r\n"))
+	require.Nil(t, err, "error parsing message without mime headers")
+	assert.Equal(t, "hello\r\n", m.Text)
+	assert.Empty(t, m.RcptTo)
+
+	_, err = Parse([]byte("not a message"))
+	assert.NotNil(t, err)
+}
+
+func TestMailboxQuery(t *testing.T) {
+	mb := New(2)
+	for _, to := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		_, err := mb.Add(Delivered([]byte("Subject: hi "+to+"\r\n\r\nbody\r\n"), "app@example.com", []string{to}))
+		require.Nil(t, err, "error adding message")
+	}
+
+	messages := mb.Messages(Query{})
+	require.Len(t, messages, 2, "mailbox is not bounded")
+	assert.Equal(t, int64(2), messages[0].ID, "oldest messages were not dropped")
+
+	assert.Len(t, mb.Messages(Query{To: "C@example"}), 1, "to filter")
+	assert.Len(t, mb.Messages(Query{From: "app@"}), 2, "from filter")
+	assert.Len(t, mb.Messages(Query{Subject: "hi b"}), 1, "subject filter")
+	assert.Len(t, mb.Messages(Query{AfterID: 2}), 1, "after id filter")
+	assert.Len(t, mb.Messages(Query{Limit: 1}), 1, "limit")
+
+	assert.NotNil(t, mb.Message(3))
+	assert.Nil(t, mb.Message(1), "dropped message is still found")
+}
+
+func TestMailboxDir(t *testing.T) {
+	dir := t.TempDir()
+
+	mb := New(10)
+	require.Nil(t, mb.Open(dir), "error opening directory")
+
+	m, err := mb.Add([]byte(raw))
+	require.Nil(t, err, "error adding message")
+	require.NotEmpty(t, m.File, "message was not stored")
+
+	stored, err := os.ReadFile(m.File)
+	require.Nil(t, err, "error reading stored message")
+	assert.Equal(t, raw, string(stored))
+
+	// a new mailbox loads what was stored
+	mb = New(10)
+	require.Nil(t, mb.Open(dir), "error loading directory")
+
+	messages := mb.Messages(Query{})
+	require.Len(t, messages, 1, "stored message was not loaded")
+	assert.Equal(t, "Your order ✓", messages[0].Subject)
+
+	require.Nil(t, mb.Clear(), "error clearing")
+	assert.Empty(t, mb.Messages(Query{}), "mailbox was not cleared")
+	assert.NoFileExists(t, m.File, "stored message was not removed")
+}
@@ -0,0 +1,205 @@
+package mailbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is a mail received by an smtp service.
+type Message struct {
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+
+	// MailFrom and RcptTo are the envelope the message was sent with, which
+	// may differ from its From and To headers.
+	MailFrom string   `json:"mailFrom"`
+	RcptTo   []string `json:"rcptTo"`
+
+	From    string              `json:"from"`
+	To      []string            `json:"to"`
+	Cc      []string            `json:"cc"`
+	Subject string              `json:"subject"`
+	Headers map[string][]string `json:"headers"`
+
+	// Text and HTML are the plain text and HTML bodies.
+	Text string `json:"text"`
+	HTML string `json:"html"`
+
+	Attachments []Attachment `json:"attachments"`
+
+	// Size is the length of the raw message.
+	Size int `json:"size"`
+
+	// File is where the message is stored, when the mailbox has a directory.
+	File string `json:"file,omitempty"`
+
+	// Raw is the message as received.
+	Raw []byte `json:"-"`
+}
+
+// Attachment is a part of a message that is not one of its bodies.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	ContentID   string `json:"contentId,omitempty"`
+	Size        int    `json:"size"`
+	Content     []byte `json:"content"`
+}
+
+// Delivered adds the headers an MTA adds on delivery, recording the envelope
+// of a message: Return-Path and one Delivered-To per recipient.
+func Delivered(raw []byte, from string, to []string) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "Return-Path: <%s>\r\n", from)
+	for _, rcpt := range to {
+		fmt.Fprintf(&buf, "Delivered-To: %s\r\n", rcpt)
+	}
+	buf.Write(raw)
+
+	return buf.Bytes()
+}
+
+// Parse reads a raw message: its headers, bodies and attachments. The envelope
+// is read from the headers added by Delivered.
+func Parse(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %s", err)
+	}
+
+	var dec mime.WordDecoder
+	decode := func(s string) string {
+		if decoded, err := dec.DecodeHeader(s); err == nil {
+			return decoded
+		}
+
+		return s
+	}
+
+	addresses := func(key string) []string {
+		list := []string{}
+		if m.Header.Get(key) == "" {
+			return list
+		}
+
+		parsed, err := m.Header.AddressList(key)
+		if err != nil {
+			// keep what was sent when it does not parse
+			return append(list, decode(m.Header.Get(key)))
+		}
+
+		for _, a := range parsed {
+			list = append(list, a.Address)
+		}
+
+		return list
+	}
+
+	msg := &Message{
+		MailFrom: strings.Trim(m.Header.Get("Return-Path"), "<>"),
+		RcptTo:   m.Header["Delivered-To"],
+		To:       addresses("To"),
+		Cc:       addresses("Cc"),
+		Subject:  decode(m.Header.Get("Subject")),
+		Headers:  make(map[string][]string, len(m.Header)),
+		Size:     len(raw),
+		Raw:      raw,
+	}
+
+	if msg.RcptTo == nil {
+		msg.RcptTo = []string{}
+	}
+
+	if from := addresses("From"); len(from) > 0 {
+		msg.From = from[0]
+	}
+
+	for key, values := range m.Header {
+		for _, v := range values {
+			msg.Headers[key] = append(msg.Headers[key], decode(v))
+		}
+	}
+
+	msg.Attachments = []Attachment{}
+	if err := msg.readPart(textproto.MIMEHeader(m.Header), m.Body); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// readPart reads a MIME part into the message, walking into multipart parts.
+func (msg *Message) readPart(header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := r.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("invalid %s part: %s", mediaType, err)
+			}
+
+			if err := msg.readPart(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := io.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("invalid %s part: %s", mediaType, err)
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+
+	switch {
+	case disposition != "attachment" && mediaType == "text/plain" && msg.Text == "":
+		msg.Text = string(content)
+	case disposition != "attachment" && mediaType == "text/html" && msg.HTML == "":
+		msg.HTML = string(content)
+	default:
+		filename := dparams["filename"]
+		if filename == "" {
+			filename = params["name"]
+		}
+
+		msg.Attachments = append(msg.Attachments, Attachment{
+			Filename:    filename,
+			ContentType: mediaType,
+			ContentID:   strings.Trim(header.Get("Content-Id"), "<>"),
+			Size:        len(content),
+			Content:     content,
+		})
+	}
+
+	return nil
+}
+
+// decodeTransfer undoes the Content-Transfer-Encoding of a part.
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
@@ -0,0 +1,176 @@
+package net_scripts
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"text/template"
+	"time"
+
+	"github.com/crit/fake-ops/internal/http_results"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultIdle is how long a UDP conversation lasts without datagrams.
+const DefaultIdle = time.Minute
+
+// Script is parsed from a tcp or udp script file. Every connection, or every
+// UDP peer, follows its Steps in order.
+//
+//	steps:
+//	  - send: "220 fake ready"
+//	  - expect: ^HELO (\S+)
+//	    timeout: 10s
+//	  - send: "250 hello {{index .Groups 1}}"
+//	  - expect: ^QUIT
+//	  - disconnect: true
+type Script struct {
+	Steps []*Step `yaml:"steps"`
+
+	// Loop starts over after the last step. Otherwise the connection stays
+	// open until the client closes it.
+	Loop bool `yaml:"loop"`
+
+	// Newline is added to everything sent. Defaults to \n over TCP.
+	Newline *string `yaml:"newline"`
+
+	// Idle ends a UDP conversation without datagrams for this long. Defaults
+	// to DefaultIdle.
+	Idle time.Duration `yaml:"idle"`
+
+	// File is the script file this Script was parsed from, when known.
+	File string `yaml:"-"`
+}
+
+// Step does one of: wait for input matching Expect, Send output, or
+// Disconnect.
+type Step struct {
+	// Expect is a regular expression a line, or a datagram over UDP, must
+	// match. Input that does not is skipped.
+	Expect string `yaml:"expect"`
+
+	// Timeout disconnects when nothing matching Expect arrives in time.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Send is a template rendered with Data.
+	Send string `yaml:"send"`
+
+	// Disconnect closes the connection, or forgets a UDP peer.
+	Disconnect bool `yaml:"disconnect"`
+
+	// Delay is waited before the step.
+	Delay time.Duration `yaml:"delay"`
+
+	expect *regexp.Regexp
+	tmpl   *template.Template
+}
+
+// Data is what sends are rendered with.
+type Data struct {
+	// Remote is the address of the client.
+	Remote string
+
+	// Input is the last input an expect step matched, Groups its submatches.
+	Input  string
+	Groups []string
+
+	// Count is how many inputs were received.
+	Count int
+}
+
+// Parse takes in the content of a script file and creates a Script.
+func Parse(data []byte) (*Script, error) {
+	var s Script
+
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid script: %s", err)
+	}
+
+	if len(s.Steps) == 0 {
+		return nil, fmt.Errorf("script has no steps")
+	}
+
+	// a loop that never waits would send as fast as it can forever
+	waits := false
+	for i, step := range s.Steps {
+		if err := step.compile(); err != nil {
+			return nil, fmt.Errorf("step %d: %s", i+1, err)
+		}
+		waits = waits || step.Expect != "" || step.Delay > 0
+	}
+
+	if s.Loop && !waits {
+		return nil, fmt.Errorf("a looping script needs an expect step or a delay")
+	}
+
+	if s.Idle == 0 {
+		s.Idle = DefaultIdle
+	}
+
+	return &s, nil
+}
+
+// Line returns what is added to every send, given the protocol.
+func (s *Script) Line(protocol string) string {
+	switch {
+	case s.Newline != nil:
+		return *s.Newline
+	case protocol == "tcp":
+		return "\n"
+	default:
+		return ""
+	}
+}
+
+// compile checks the step does one thing and prepares its expression or
+// template.
+func (s *Step) compile() error {
+	kinds := 0
+	for _, set := range []bool{s.Expect != "", s.Send != "", s.Disconnect} {
+		if set {
+			kinds++
+		}
+	}
+
+	if kinds != 1 {
+		return fmt.Errorf("a step needs exactly one of expect, send or disconnect")
+	}
+
+	var err error
+	switch {
+	case s.Expect != "":
+		if s.expect, err = regexp.Compile(s.Expect); err != nil {
+			return fmt.Errorf("invalid expect %q: %s", s.Expect, err)
+		}
+	case s.Send != "":
+		if s.tmpl, err = template.New("send").Funcs(http_results.TemplateFuncs()).Parse(s.Send); err != nil {
+			return fmt.Errorf("invalid send template: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Match returns the submatches of Expect in input, or nil when it does not
+// match.
+func (s *Step) Match(input string) []string {
+	if s.expect == nil {
+		return nil
+	}
+
+	return s.expect.FindStringSubmatch(input)
+}
+
+// Render creates the output of a send step.
+func (s *Step) Render(data Data) (string, error) {
+	if s.tmpl == nil {
+		return s.Send, nil
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render send: %s", err)
+	}
+
+	return buf.String(), nil
+}
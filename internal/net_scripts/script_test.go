@@ -0,0 +1,62 @@
+package net_scripts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(`
+steps:
+  - send: "220 fake ready"
+  - expect: ^HELO (\S+)
+    timeout: 10s
+  - send: "250 hello {{index .Groups 1}} from {{.Remote}}, {{.Count}} lines"
+    delay: 100ms
+  - disconnect: true
+`))
+	require.Nil(t, err, "error parsing script")
+
+	require.Len(t, s.Steps, 4)
+	assert.False(t, s.Loop)
+	assert.Equal(t, DefaultIdle, s.Idle)
+	assert.Equal(t, "\n", s.Line("tcp"))
+	assert.Equal(t, "", s.Line("udp"))
+
+	assert.Nil(t, s.Steps[1].Match("EHLO client"))
+	groups := s.Steps[1].Match("HELO client")
+	assert.Equal(t, []string{"HELO client", "client"}, groups)
+	assert.Equal(t, 10*time.Second, s.Steps[1].Timeout)
+
+	out, err := s.Steps[2].Render(Data{Remote: "127.0.0.1:5000", Input: "HELO client", Groups: groups, Count: 2})
+	require.Nil(t, err, "error rendering send")
+	assert.Equal(t, "250 hello client from 127.0.0.1:5000, 2 lines", out)
+	assert.Equal(t, 100*time.Millisecond, s.Steps[2].Delay)
+	assert.True(t, s.Steps[3].Disconnect)
+
+	s, err = Parse([]byte("loop: true\nnewline: \"\\r\\n\"\nidle: 5s\nsteps: [{expect: ping}, {send: pong}]"))
+	require.Nil(t, err, "error parsing looping script")
+	assert.True(t, s.Loop)
+	assert.Equal(t, "\r\n", s.Line("tcp"))
+	assert.Equal(t, 5*time.Second, s.Idle)
+
+	tests := map[string]string{
+		"invalid yaml":     "steps: [",
+		"no steps":         "loop: true",
+		"empty step":       "steps: [{delay: 1s}]",
+		"two kinds":        "steps: [{expect: a, send: b}]",
+		"invalid expect":   "steps: [{expect: '['}]",
+		"invalid template": "steps: [{send: '{{.Nope'}]",
+		"busy loop":        "loop: true\nsteps: [{send: a}, {send: b}]",
+	}
+
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(file))
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,552 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crit/fake-ops/internal/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// Endpoints served by a Provider, relative to the issuer.
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	AuthorizePath = "/authorize"
+	TokenPath     = "/token"
+	UserInfoPath  = "/userinfo"
+	JWKSPath      = "/.well-known/jwks.json"
+)
+
+// codeTTL is how long an authorization code can be exchanged for tokens.
+const codeTTL = 5 * time.Minute
+
+// Config is parsed from the oidc section of a service yaml file.
+type Config struct {
+	// Issuer is the iss of every token and the base of every endpoint.
+	Issuer string `yaml:"issuer"`
+
+	// AutoApprove logs in the first user without showing a login form.
+	AutoApprove bool `yaml:"autoApprove"`
+
+	// TokenTTL is how long access and id tokens are valid. Defaults to an hour.
+	TokenTTL time.Duration `yaml:"tokenTTL"`
+
+	// Scopes are advertised by discovery next to the scopes of every client.
+	Scopes []string `yaml:"scopes"`
+
+	Clients []Client `yaml:"clients"`
+	Users   []User   `yaml:"users"`
+}
+
+// Client is an application allowed to request tokens.
+type Client struct {
+	ID     string `yaml:"id"`
+	Secret string `yaml:"secret"`
+
+	// RedirectURIs the authorization code may be sent to.
+	RedirectURIs []string `yaml:"redirectURIs"`
+
+	// Scopes the client may request. Any scope is allowed when empty.
+	Scopes []string `yaml:"scopes"`
+
+	// Claims are added to tokens issued with the client credentials grant.
+	Claims map[string]any `yaml:"claims"`
+}
+
+// User can log in through the authorize endpoint.
+type User struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// Claims are added to the tokens of the user and returned by userinfo.
+	Claims map[string]any `yaml:"claims"`
+}
+
+// Subject is the sub claim of the user.
+func (u *User) Subject() string {
+	if sub, ok := u.Claims["sub"].(string); ok && sub != "" {
+		return sub
+	}
+
+	return u.Username
+}
+
+// Provider is an in-memory OAuth2 and OpenID Connect provider.
+type Provider struct {
+	cfg Config
+	key *jwt.Key
+
+	mu      sync.Mutex
+	codes   map[string]grant
+	refresh map[string]grant
+}
+
+// grant is what an authorization code or refresh token was issued for.
+type grant struct {
+	client      string
+	user        *User
+	scopes      []string
+	redirectURI string
+	nonce       string
+	challenge   string
+	method      string
+	authTime    time.Time
+	expires     time.Time
+}
+
+// New creates a Provider signing tokens with key.
+func New(cfg Config, key *jwt.Key) *Provider {
+	if cfg.TokenTTL == 0 {
+		cfg.TokenTTL = time.Hour
+	}
+
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+
+	return &Provider{
+		cfg:     cfg,
+		key:     key,
+		codes:   make(map[string]grant),
+		refresh: make(map[string]grant),
+	}
+}
+
+// Register adds the provider endpoints to r.
+func (p *Provider) Register(r gin.IRoutes) {
+	r.GET(DiscoveryPath, p.discovery)
+	r.GET(JWKSPath, p.jwks)
+	r.GET(AuthorizePath, p.authorize)
+	r.POST(AuthorizePath, p.authorize)
+	r.POST(TokenPath, p.token)
+	r.GET(UserInfoPath, p.userInfo)
+	r.POST(UserInfoPath, p.userInfo)
+}
+
+func (p *Provider) discovery(c *gin.Context) {
+	scopes := []string{"openid", "profile", "email", "offline_access"}
+	scopes = append(scopes, p.cfg.Scopes...)
+	for _, client := range p.cfg.Clients {
+		scopes = append(scopes, client.Scopes...)
+	}
+	slices.Sort(scopes)
+
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                p.cfg.Issuer,
+		"authorization_endpoint":                p.cfg.Issuer + AuthorizePath,
+		"token_endpoint":                        p.cfg.Issuer + TokenPath,
+		"userinfo_endpoint":                     p.cfg.Issuer + UserInfoPath,
+		"jwks_uri":                              p.cfg.Issuer + JWKSPath,
+		"scopes_supported":                      slices.Compact(scopes),
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+	})
+}
+
+func (p *Provider) jwks(c *gin.Context) {
+	c.JSON(http.StatusOK, p.key.JWKS())
+}
+
+// authorize logs a user in and redirects back to the client with a code. GET
+// shows the login form unless a user is picked by login_hint or AutoApprove,
+// POST submits it.
+func (p *Provider) authorize(c *gin.Context) {
+	client := p.client(c.Request.FormValue("client_id"))
+	if client == nil {
+		c.String(http.StatusBadRequest, "unknown client_id")
+		return
+	}
+
+	redirectURI := c.Request.FormValue("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		c.String(http.StatusBadRequest, "redirect_uri is not registered for the client")
+		return
+	}
+
+	state := c.Request.FormValue("state")
+
+	if c.Request.FormValue("response_type") != "code" {
+		redirect(c, redirectURI, url.Values{"error": {"unsupported_response_type"}, "state": {state}})
+		return
+	}
+
+	scopes := strings.Fields(c.Request.FormValue("scope"))
+	if !client.allows(scopes) {
+		redirect(c, redirectURI, url.Values{"error": {"invalid_scope"}, "state": {state}})
+		return
+	}
+
+	var user *User
+	var failed bool
+
+	if c.Request.Method == http.MethodPost {
+		user = p.login(c.PostForm("username"), c.PostForm("password"))
+		failed = user == nil
+	} else if hint := c.Query("login_hint"); hint != "" {
+		user = p.user(hint)
+	} else if p.cfg.AutoApprove && len(p.cfg.Users) > 0 {
+		user = &p.cfg.Users[0]
+	}
+
+	if user == nil {
+		status := http.StatusOK
+		if failed {
+			status = http.StatusUnauthorized
+		}
+
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(status)
+		_ = loginForm.Execute(c.Writer, gin.H{
+			"Action": AuthorizePath + "?" + c.Request.URL.RawQuery,
+			"Users":  p.cfg.Users,
+			"Failed": failed,
+		})
+		return
+	}
+
+	code := random()
+
+	p.mu.Lock()
+	p.codes[code] = grant{
+		client:      client.ID,
+		user:        user,
+		scopes:      scopes,
+		redirectURI: c.Request.FormValue("redirect_uri"),
+		nonce:       c.Request.FormValue("nonce"),
+		challenge:   c.Request.FormValue("code_challenge"),
+		method:      c.Request.FormValue("code_challenge_method"),
+		authTime:    time.Now(),
+		expires:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	redirect(c, redirectURI, url.Values{"code": {code}, "state": {state}})
+}
+
+// token exchanges a grant for tokens.
+func (p *Provider) token(c *gin.Context) {
+	client, ok := p.authenticate(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="token"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		p.mu.Lock()
+		g, ok := p.codes[c.PostForm("code")]
+		delete(p.codes, c.PostForm("code"))
+		p.mu.Unlock()
+
+		if !ok || g.client != client.ID || time.Now().After(g.expires) {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", "unknown or expired code")
+			return
+		}
+
+		if g.redirectURI != "" && g.redirectURI != c.PostForm("redirect_uri") {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+			return
+		}
+
+		if !g.verify(c.PostForm("code_verifier")) {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", "code_verifier does not match")
+			return
+		}
+
+		p.issue(c, client, g)
+
+	case "refresh_token":
+		p.mu.Lock()
+		g, ok := p.refresh[c.PostForm("refresh_token")]
+		delete(p.refresh, c.PostForm("refresh_token"))
+		p.mu.Unlock()
+
+		if !ok || g.client != client.ID {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", "unknown refresh_token")
+			return
+		}
+
+		g.nonce = ""
+		p.issue(c, client, g)
+
+	case "client_credentials":
+		if client.Secret == "" {
+			oauthError(c, http.StatusUnauthorized, "unauthorized_client", "public clients cannot use client_credentials")
+			return
+		}
+
+		scopes := strings.Fields(c.PostForm("scope"))
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+
+		if !client.allows(scopes) {
+			oauthError(c, http.StatusBadRequest, "invalid_scope", "scope is not allowed for the client")
+			return
+		}
+
+		p.issue(c, client, grant{client: client.ID, scopes: scopes})
+
+	default:
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "grant_type is not supported")
+	}
+}
+
+// issue responds with tokens for g.
+func (p *Provider) issue(c *gin.Context, client *Client, g grant) {
+	now := time.Now()
+
+	access := jwt.Claims{}
+	if g.user != nil {
+		for k, v := range g.user.Claims {
+			access[k] = v
+		}
+		access["sub"] = g.user.Subject()
+	} else {
+		for k, v := range client.Claims {
+			access[k] = v
+		}
+		access["sub"] = client.ID
+	}
+
+	access["iss"] = p.cfg.Issuer
+	access["aud"] = client.ID
+	access["client_id"] = client.ID
+	access["iat"] = now.Unix()
+	access["exp"] = now.Add(p.cfg.TokenTTL).Unix()
+	access["jti"] = random()
+	if len(g.scopes) > 0 {
+		access["scope"] = strings.Join(g.scopes, " ")
+	}
+
+	token, err := p.key.Sign(access)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	body := gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(p.cfg.TokenTTL.Seconds()),
+	}
+
+	if len(g.scopes) > 0 {
+		body["scope"] = strings.Join(g.scopes, " ")
+	}
+
+	// Only users log in, so only they get id and refresh tokens
+	if g.user != nil {
+		if slices.Contains(g.scopes, "openid") {
+			id := jwt.Claims{}
+			for k, v := range g.user.Claims {
+				id[k] = v
+			}
+
+			id["iss"] = p.cfg.Issuer
+			id["sub"] = g.user.Subject()
+			id["aud"] = client.ID
+			id["iat"] = now.Unix()
+			id["exp"] = now.Add(p.cfg.TokenTTL).Unix()
+			id["auth_time"] = g.authTime.Unix()
+			if g.nonce != "" {
+				id["nonce"] = g.nonce
+			}
+
+			body["id_token"], err = p.key.Sign(id)
+			if err != nil {
+				oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+				return
+			}
+		}
+
+		refresh := random()
+
+		p.mu.Lock()
+		p.refresh[refresh] = g
+		p.mu.Unlock()
+
+		body["refresh_token"] = refresh
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, body)
+}
+
+// userInfo returns the claims of the user an access token was issued to.
+func (p *Provider) userInfo(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		token = c.PostForm("access_token")
+	}
+
+	claims, err := p.key.Verify(strings.TrimSpace(token))
+	if err != nil || claims["iss"] != p.cfg.Issuer {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_token", "access token is not valid")
+		return
+	}
+
+	sub, _ := claims["sub"].(string)
+
+	user := p.user(sub)
+	if user == nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_token", "access token was not issued to a user")
+		return
+	}
+
+	info := gin.H{}
+	for k, v := range user.Claims {
+		info[k] = v
+	}
+	info["sub"] = user.Subject()
+
+	c.JSON(http.StatusOK, info)
+}
+
+// authenticate finds the client of a token request from basic auth or the
+// form. Clients with a secret must send it.
+func (p *Provider) authenticate(c *gin.Context) (*Client, bool) {
+	id, secret, ok := c.Request.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	client := p.client(id)
+	if client == nil {
+		return nil, false
+	}
+
+	if client.Secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(client.Secret)) != 1 {
+		return nil, false
+	}
+
+	return client, true
+}
+
+func (p *Provider) client(id string) *Client {
+	for i := range p.cfg.Clients {
+		if p.cfg.Clients[i].ID == id {
+			return &p.cfg.Clients[i]
+		}
+	}
+
+	return nil
+}
+
+// user finds a user by user name or subject.
+func (p *Provider) user(name string) *User {
+	for i := range p.cfg.Users {
+		u := &p.cfg.Users[i]
+		if u.Username == name || u.Subject() == name {
+			return u
+		}
+	}
+
+	return nil
+}
+
+func (p *Provider) login(username, password string) *User {
+	for i := range p.cfg.Users {
+		u := &p.cfg.Users[i]
+		if u.Username == username && subtle.ConstantTimeCompare([]byte(password), []byte(u.Password)) == 1 {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// allows reports whether the client may request every one of scopes.
+func (c *Client) allows(scopes []string) bool {
+	if len(c.Scopes) == 0 {
+		return true
+	}
+
+	for _, scope := range scopes {
+		if scope != "openid" && scope != "offline_access" && !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// verify checks the PKCE code verifier against the challenge of the grant.
+func (g grant) verify(verifier string) bool {
+	switch {
+	case g.challenge == "":
+		return true
+	case g.method == "S256":
+		sum := sha256.Sum256([]byte(verifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:]) == g.challenge
+	default:
+		return verifier == g.challenge
+	}
+}
+
+func redirect(c *gin.Context, uri string, values url.Values) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid redirect_uri")
+		return
+	}
+
+	q := u.Query()
+	for k, v := range values {
+		if v[0] != "" {
+			q[k] = v
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	c.Redirect(http.StatusFound, u.String())
+}
+
+func oauthError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
+
+// random creates an opaque code or token.
+func random() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!doctype html>
+<html>
+<head><title>Log in</title></head>
+<body style="font-family: sans-serif; max-width: 24em; margin: 4em auto">
+<h1>Log in</h1>
+{{if .Failed}}<p style="color: #c00">Wrong user name or password.</p>{{end}}
+<form method="post" action="{{.Action}}">
+<p><label>User name<br><input name="username" autofocus></label></p>
+<p><label>Password<br><input name="password" type="password"></label></p>
+<p><button type="submit">Log in</button></p>
+</form>
+{{if .Users}}<p>Users: {{range $i, $u := .Users}}{{if $i}}, {{end}}<code>{{$u.Username}}</code>{{end}}</p>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,197 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/crit/fake-ops/internal/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProvider(t *testing.T) (*Provider, http.Handler) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := jwt.LoadKey(t.TempDir())
+	require.Nil(t, err, "error creating key")
+
+	p := New(Config{
+		Issuer: "http://login.test/",
+		Clients: []Client{
+			{ID: "web", RedirectURIs: []string{"http://app.test/callback"}},
+			{ID: "worker", Secret: "s3cret", Scopes: []string{"payments:read"}, Claims: map[string]any{"role": "batch"}},
+		},
+		Users: []User{
+			{Username: "alice", Password: "secret", Claims: map[string]any{"email": "alice@example.com"}},
+		},
+	}, key)
+
+	g := gin.New()
+	p.Register(g)
+
+	return p, g
+}
+
+func do(h http.Handler, method, target string, form url.Values, header http.Header) *httptest.ResponseRecorder {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+
+	r := httptest.NewRequest(method, target, body)
+	if form != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for k, v := range header {
+		r.Header[k] = v
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	p, h := newProvider(t)
+
+	verifier := "a-long-enough-code-verifier-for-the-test"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"web"},
+		"redirect_uri":          {"http://app.test/callback"},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-1"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	// without auto approve the login form is shown
+	w := do(h, http.MethodGet, AuthorizePath+"?"+query.Encode(), nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<form")
+
+	w = do(h, http.MethodPost, AuthorizePath+"?"+query.Encode(), url.Values{"username": {"alice"}, "password": {"wrong"}}, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = do(h, http.MethodPost, AuthorizePath+"?"+query.Encode(), url.Values{"username": {"alice"}, "password": {"secret"}}, nil)
+	require.Equal(t, http.StatusFound, w.Code)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.Nil(t, err, "error parsing redirect")
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"web"},
+		"code":          {code},
+		"redirect_uri":  {"http://app.test/callback"},
+		"code_verifier": {verifier},
+	}
+
+	w = do(h, http.MethodPost, TokenPath, exchange, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		IDToken      string `json:"id_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	id, err := p.key.Verify(tokens.IDToken)
+	require.Nil(t, err, "error verifying id token")
+	assert.Equal(t, "http://login.test", id["iss"])
+	assert.Equal(t, "alice", id["sub"])
+	assert.Equal(t, "web", id["aud"])
+	assert.Equal(t, "n-1", id["nonce"])
+
+	// codes are single use
+	w = do(h, http.MethodPost, TokenPath, exchange, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(h, http.MethodGet, UserInfoPath, nil, http.Header{"Authorization": {"Bearer " + tokens.AccessToken}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"sub": "alice", "email": "alice@example.com"}`, w.Body.String())
+
+	w = do(h, http.MethodPost, TokenPath, url.Values{"grant_type": {"refresh_token"}, "client_id": {"web"}, "refresh_token": {tokens.RefreshToken}}, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthorizationCodeVerifier(t *testing.T) {
+	p, h := newProvider(t)
+	p.cfg.AutoApprove = true
+
+	query := url.Values{
+		"response_type":  {"code"},
+		"client_id":      {"web"},
+		"code_challenge": {"plain-challenge"},
+	}
+
+	w := do(h, http.MethodGet, AuthorizePath+"?"+query.Encode(), nil, nil)
+	require.Equal(t, http.StatusFound, w.Code)
+
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, "app.test", location.Host)
+
+	w = do(h, http.MethodPost, TokenPath, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"web"},
+		"code":          {location.Query().Get("code")},
+		"code_verifier": {"something-else"},
+	}, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// unregistered redirect uris are never redirected to
+	query.Set("redirect_uri", "http://evil.test/")
+	w = do(h, http.MethodGet, AuthorizePath+"?"+query.Encode(), nil, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestClientCredentials(t *testing.T) {
+	p, h := newProvider(t)
+
+	w := do(h, http.MethodPost, TokenPath, url.Values{"grant_type": {"client_credentials"}}, http.Header{
+		"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("worker:wrong"))},
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = do(h, http.MethodPost, TokenPath, url.Values{"grant_type": {"client_credentials"}, "scope": {"payments:write"}}, http.Header{
+		"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("worker:s3cret"))},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(h, http.MethodPost, TokenPath, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"worker"},
+		"client_secret": {"s3cret"},
+	}, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var tokens map[string]any
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	assert.NotContains(t, tokens, "id_token")
+	assert.NotContains(t, tokens, "refresh_token")
+
+	claims, err := p.key.Verify(tokens["access_token"].(string))
+	require.Nil(t, err, "error verifying access token")
+	assert.Equal(t, "worker", claims["sub"])
+	assert.Equal(t, "batch", claims["role"])
+	assert.Equal(t, "payments:read", claims["scope"])
+}
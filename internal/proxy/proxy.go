@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// New creates a reverse proxy forwarding requests to the upstream URL. Any
+// path in the upstream URL is prefixed to the forwarded request's path.
+func New(upstream string, onError func(r *http.Request, err error)) (*httputil.ReverseProxy, error) {
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %s: %s", upstream, err)
+	}
+
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid upstream %s: must include a scheme and host", upstream)
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if onError != nil {
+				onError(r, err)
+			}
+
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}, nil
+}
@@ -0,0 +1,264 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Strategies a Limiter can count requests with.
+const (
+	TokenBucket = "token-bucket"
+	FixedWindow = "fixed-window"
+)
+
+// Keys a Limiter can count requests by. Requests can also be counted by a
+// header with "header:<name>".
+const (
+	KeyGlobal = "global"
+	KeyIP     = "ip"
+
+	headerPrefix = "header:"
+)
+
+// Config is parsed from a rateLimit section.
+//
+//	rateLimit:
+//	  strategy: fixed-window
+//	  limit: 10
+//	  window: 1m
+//	  key: header:X-API-Key
+type Config struct {
+	// Strategy is token-bucket (the default) or fixed-window.
+	Strategy string `yaml:"strategy" json:"strategy,omitempty"`
+
+	// Limit is how many requests are allowed every Window.
+	Limit int `yaml:"limit" json:"limit"`
+
+	// Window defaults to a second.
+	Window time.Duration `yaml:"window" json:"window,omitempty"`
+
+	// Burst is how many requests a token bucket holds. Defaults to Limit.
+	Burst int `yaml:"burst" json:"burst,omitempty"`
+
+	// Key is global (the default), ip or header:<name>.
+	Key string `yaml:"key" json:"key,omitempty"`
+
+	// Response answers requests over the limit.
+	Response Response `yaml:"response" json:"response,omitzero"`
+}
+
+// Response is sent to requests over the limit.
+type Response struct {
+	Status      int    `yaml:"status" json:"status,omitempty"`
+	ContentType string `yaml:"contentType" json:"contentType,omitempty"`
+	Body        string `yaml:"body" json:"body,omitempty"`
+}
+
+// Validate reports settings a Limiter cannot be created with.
+func (c Config) Validate() error {
+	if c.Limit <= 0 {
+		return fmt.Errorf("rate limit must be above zero")
+	}
+
+	if c.Window < 0 || c.Burst < 0 {
+		return fmt.Errorf("rate limit window and burst cannot be negative")
+	}
+
+	switch c.Strategy {
+	case "", TokenBucket, FixedWindow:
+	default:
+		return fmt.Errorf("unknown rate limit strategy: %s", c.Strategy)
+	}
+
+	switch {
+	case c.Key == "", c.Key == KeyGlobal, c.Key == KeyIP:
+	case strings.HasPrefix(c.Key, headerPrefix) && len(c.Key) > len(headerPrefix):
+	default:
+		return fmt.Errorf("unknown rate limit key: %s", c.Key)
+	}
+
+	return nil
+}
+
+// Decision is the outcome of counting a request.
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset is how long until the full limit is available again.
+	Reset time.Duration
+
+	// RetryAfter is how long until a rejected request would be allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter counts requests per key.
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket holds the tokens of a token bucket, or the count of a fixed window.
+type bucket struct {
+	tokens float64
+	count  int
+	at     time.Time
+}
+
+// New creates a Limiter for a valid cfg.
+func New(cfg Config) (*Limiter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Strategy == "" {
+		cfg.Strategy = TokenBucket
+	}
+
+	if cfg.Window == 0 {
+		cfg.Window = time.Second
+	}
+
+	if cfg.Burst == 0 {
+		cfg.Burst = cfg.Limit
+	}
+
+	return &Limiter{cfg: cfg, now: time.Now, buckets: make(map[string]*bucket)}, nil
+}
+
+// Allow counts r against its key.
+func (l *Limiter) Allow(r *http.Request) Decision {
+	key := l.key(r)
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.Strategy == FixedWindow {
+		return l.fixedWindow(key, now)
+	}
+
+	return l.tokenBucket(key, now)
+}
+
+func (l *Limiter) tokenBucket(key string, now time.Time) Decision {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.cfg.Burst), at: now}
+		l.buckets[key] = b
+	}
+
+	// tokens refill continuously at Limit per Window
+	perToken := l.cfg.Window / time.Duration(l.cfg.Limit)
+	b.tokens = min(float64(l.cfg.Burst), b.tokens+float64(now.Sub(b.at))/float64(perToken))
+	b.at = now
+
+	d := Decision{Limit: l.cfg.Burst}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+
+	d.Remaining = int(math.Floor(b.tokens))
+	d.Reset = time.Duration((float64(l.cfg.Burst) - b.tokens) * float64(perToken))
+
+	return d
+}
+
+func (l *Limiter) fixedWindow(key string, now time.Time) Decision {
+	start := now.Truncate(l.cfg.Window)
+
+	b, ok := l.buckets[key]
+	if !ok || !b.at.Equal(start) {
+		b = &bucket{at: start}
+		l.buckets[key] = b
+	}
+
+	d := Decision{Limit: l.cfg.Limit, Reset: start.Add(l.cfg.Window).Sub(now)}
+
+	if b.count < l.cfg.Limit {
+		b.count++
+		d.Allowed = true
+	} else {
+		d.RetryAfter = d.Reset
+	}
+
+	d.Remaining = l.cfg.Limit - b.count
+
+	return d
+}
+
+// key is what r is counted by.
+func (l *Limiter) key(r *http.Request) string {
+	switch {
+	case l.cfg.Key == KeyIP:
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	case strings.HasPrefix(l.cfg.Key, headerPrefix):
+		return r.Header.Get(strings.TrimPrefix(l.cfg.Key, headerPrefix))
+	default:
+		return KeyGlobal
+	}
+}
+
+// WriteHeaders sets the rate limit headers of d, in both the RateLimit-* and
+// the older X-RateLimit-* forms.
+func (d Decision) WriteHeaders(h http.Header) {
+	limit, remaining, reset := strconv.Itoa(d.Limit), strconv.Itoa(d.Remaining), strconv.Itoa(seconds(d.Reset))
+
+	h.Set("RateLimit-Limit", limit)
+	h.Set("RateLimit-Remaining", remaining)
+	h.Set("RateLimit-Reset", reset)
+	h.Set("X-RateLimit-Limit", limit)
+	h.Set("X-RateLimit-Remaining", remaining)
+	h.Set("X-RateLimit-Reset", reset)
+
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(1, seconds(d.RetryAfter))))
+	}
+}
+
+// Reject answers a request over the limit with the configured response.
+func (l *Limiter) Reject(w http.ResponseWriter) {
+	resp := l.cfg.Response
+
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusTooManyRequests
+	}
+
+	body := resp.Body
+	if body == "" {
+		body = `{"error": "too many requests"}`
+	}
+
+	contentType := resp.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
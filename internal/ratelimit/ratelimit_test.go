@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a Limiter's now that only moves when told to.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newLimiter(t *testing.T, cfg Config) (*Limiter, *clock) {
+	l, err := New(cfg)
+	require.Nil(t, err, "error creating limiter")
+
+	c := &clock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l.now = c.now
+
+	return l, c
+}
+
+func TestTokenBucket(t *testing.T) {
+	l, c := newLimiter(t, Config{Limit: 2, Window: time.Second, Burst: 3})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	for i := range 3 {
+		d := l.Allow(r)
+		assert.True(t, d.Allowed, "request %d", i)
+		assert.Equal(t, 2-i, d.Remaining)
+	}
+
+	d := l.Allow(r)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+
+	c.advance(500 * time.Millisecond)
+	assert.True(t, l.Allow(r).Allowed)
+	assert.False(t, l.Allow(r).Allowed)
+}
+
+func TestFixedWindow(t *testing.T) {
+	l, c := newLimiter(t, Config{Strategy: FixedWindow, Limit: 2, Window: time.Minute})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	c.advance(45 * time.Second)
+	assert.True(t, l.Allow(r).Allowed)
+	assert.True(t, l.Allow(r).Allowed)
+
+	d := l.Allow(r)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 15*time.Second, d.RetryAfter)
+
+	w := httptest.NewRecorder()
+	d.WriteHeaders(w.Header())
+	assert.Equal(t, "15", w.Header().Get("Retry-After"))
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	c.advance(15 * time.Second)
+	assert.True(t, l.Allow(r).Allowed)
+}
+
+func TestKeys(t *testing.T) {
+	l, _ := newLimiter(t, Config{Limit: 1, Key: "header:X-API-Key"})
+
+	alice := httptest.NewRequest(http.MethodGet, "/", nil)
+	alice.Header.Set("X-API-Key", "alice")
+	bob := httptest.NewRequest(http.MethodGet, "/", nil)
+	bob.Header.Set("X-API-Key", "bob")
+
+	assert.True(t, l.Allow(alice).Allowed)
+	assert.False(t, l.Allow(alice).Allowed)
+	assert.True(t, l.Allow(bob).Allowed)
+
+	l, _ = newLimiter(t, Config{Limit: 1, Key: KeyIP})
+
+	first := httptest.NewRequest(http.MethodGet, "/", nil)
+	first.RemoteAddr = "10.0.0.1:5000"
+	second := httptest.NewRequest(http.MethodGet, "/", nil)
+	second.RemoteAddr = "10.0.0.1:5001"
+	other := httptest.NewRequest(http.MethodGet, "/", nil)
+	other.RemoteAddr = "10.0.0.2:5000"
+
+	assert.True(t, l.Allow(first).Allowed)
+	assert.False(t, l.Allow(second).Allowed)
+	assert.True(t, l.Allow(other).Allowed)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NotNil(t, Config{}.Validate())
+	assert.NotNil(t, Config{Limit: 1, Strategy: "leaky"}.Validate())
+	assert.NotNil(t, Config{Limit: 1, Key: "cookie"}.Validate())
+	assert.Nil(t, Config{Limit: 1, Key: "header:X-API-Key"}.Validate())
+}
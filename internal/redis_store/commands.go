@@ -0,0 +1,1135 @@
+package redis_store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// command runs a command with its arguments, without its name. Commands that
+// block take the lock themselves.
+type command struct {
+	// arity is the number of arguments including the name, or the minimum
+	// number when negative.
+	arity int
+	run   func(s *Store, args []string) any
+	block func(s *Store, ctx context.Context, args []string) any
+}
+
+// commands the store runs, by name.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		// server and keys
+		"PING":      {arity: -1, run: ping},
+		"ECHO":      {arity: 2, run: func(s *Store, args []string) any { return args[0] }},
+		"TIME":      {arity: 1, run: serverTime},
+		"DBSIZE":    {arity: 1, run: dbSize},
+		"FLUSHDB":   {arity: -1, run: flush},
+		"FLUSHALL":  {arity: -1, run: flush},
+		"DEL":       {arity: -2, run: del},
+		"UNLINK":    {arity: -2, run: del},
+		"EXISTS":    {arity: -2, run: exists},
+		"TYPE":      {arity: 2, run: keyType},
+		"KEYS":      {arity: 2, run: keys},
+		"SCAN":      {arity: -2, run: scan},
+		"RENAME":    {arity: 3, run: rename},
+		"EXPIRE":    {arity: -3, run: expire(time.Second, false)},
+		"PEXPIRE":   {arity: -3, run: expire(time.Millisecond, false)},
+		"EXPIREAT":  {arity: -3, run: expire(time.Second, true)},
+		"PEXPIREAT": {arity: -3, run: expire(time.Millisecond, true)},
+		"TTL":       {arity: 2, run: ttl(time.Second)},
+		"PTTL":      {arity: 2, run: ttl(time.Millisecond)},
+		"PERSIST":   {arity: 2, run: persist},
+
+		// strings
+		"GET":         {arity: 2, run: get},
+		"SET":         {arity: -3, run: set},
+		"SETNX":       {arity: 3, run: setNX},
+		"SETEX":       {arity: 4, run: setEX(time.Second)},
+		"PSETEX":      {arity: 4, run: setEX(time.Millisecond)},
+		"GETSET":      {arity: 3, run: getSet},
+		"GETDEL":      {arity: 2, run: getDel},
+		"MGET":        {arity: -2, run: mget},
+		"MSET":        {arity: -3, run: mset},
+		"INCR":        {arity: 2, run: incr(1, false)},
+		"DECR":        {arity: 2, run: incr(-1, false)},
+		"INCRBY":      {arity: 3, run: incr(1, true)},
+		"DECRBY":      {arity: 3, run: incr(-1, true)},
+		"INCRBYFLOAT": {arity: 3, run: incrByFloat},
+		"APPEND":      {arity: 3, run: appendString},
+		"STRLEN":      {arity: 2, run: strLen},
+
+		// hashes
+		"HSET":         {arity: -4, run: hset(false)},
+		"HMSET":        {arity: -4, run: hset(true)},
+		"HSETNX":       {arity: 4, run: hsetNX},
+		"HGET":         {arity: 3, run: hget},
+		"HMGET":        {arity: -3, run: hmget},
+		"HGETALL":      {arity: 2, run: hgetAll},
+		"HDEL":         {arity: -3, run: hdel},
+		"HEXISTS":      {arity: 3, run: hexists},
+		"HLEN":         {arity: 2, run: hlen},
+		"HKEYS":        {arity: 2, run: hkeys},
+		"HVALS":        {arity: 2, run: hvals},
+		"HINCRBY":      {arity: 4, run: hincrBy},
+		"HINCRBYFLOAT": {arity: 4, run: hincrByFloat},
+
+		// lists
+		"LPUSH":  {arity: -3, run: push(true)},
+		"RPUSH":  {arity: -3, run: push(false)},
+		"LPOP":   {arity: -2, run: pop(true)},
+		"RPOP":   {arity: -2, run: pop(false)},
+		"BLPOP":  {arity: -3, block: blockingPop(true)},
+		"BRPOP":  {arity: -3, block: blockingPop(false)},
+		"LLEN":   {arity: 2, run: llen},
+		"LRANGE": {arity: 4, run: lrange},
+		"LINDEX": {arity: 3, run: lindex},
+		"LSET":   {arity: 4, run: lset},
+		"LREM":   {arity: 4, run: lrem},
+		"LTRIM":  {arity: 4, run: ltrim},
+
+		// pub/sub
+		"PUBLISH": {arity: 3, run: publish},
+		"PUBSUB":  {arity: -2, run: pubsub},
+	}
+}
+
+func ping(s *Store, args []string) any {
+	if len(args) > 0 {
+		return args[0]
+	}
+
+	return Status("PONG")
+}
+
+func serverTime(s *Store, args []string) any {
+	now := s.now()
+	return []string{strconv.FormatInt(now.Unix(), 10), strconv.Itoa(now.Nanosecond() / 1000)}
+}
+
+func dbSize(s *Store, args []string) any {
+	var n int
+	for key := range s.keys {
+		if s.get(key) != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+func flush(s *Store, args []string) any {
+	clear(s.keys)
+	return Status("OK")
+}
+
+func del(s *Store, args []string) any {
+	var n int
+	for _, key := range args {
+		if s.get(key) != nil {
+			delete(s.keys, key)
+			n++
+		}
+	}
+
+	return n
+}
+
+func exists(s *Store, args []string) any {
+	var n int
+	for _, key := range args {
+		if s.get(key) != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+func keyType(s *Store, args []string) any {
+	if e := s.get(args[0]); e != nil {
+		return Status(e.kind)
+	}
+
+	return Status("none")
+}
+
+// sortedKeys lists the keys that have not expired in order.
+func (s *Store) sortedKeys() []string {
+	list := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		if s.get(key) != nil {
+			list = append(list, key)
+		}
+	}
+	slices.Sort(list)
+
+	return list
+}
+
+func keys(s *Store, args []string) any {
+	list := []string{}
+	for _, key := range s.sortedKeys() {
+		if Match(args[0], key) {
+			list = append(list, key)
+		}
+	}
+
+	return list
+}
+
+// scan pages through the keys in order, the cursor being how many keys were
+// already scanned.
+func scan(s *Store, args []string) any {
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		return fmt.Errorf("ERR invalid cursor")
+	}
+
+	pattern, count, kind := "*", 10, ""
+	for opts := args[1:]; len(opts) > 0; opts = opts[2:] {
+		if len(opts) < 2 {
+			return ErrSyntax
+		}
+
+		switch strings.ToUpper(opts[0]) {
+		case "MATCH":
+			pattern = opts[1]
+		case "COUNT":
+			if count, err = strconv.Atoi(opts[1]); err != nil || count < 1 {
+				return ErrSyntax
+			}
+		case "TYPE":
+			kind = strings.ToLower(opts[1])
+		default:
+			return ErrSyntax
+		}
+	}
+
+	all := s.sortedKeys()
+	cursor = min(cursor, len(all))
+	end := min(cursor+count, len(all))
+
+	found := []string{}
+	for _, key := range all[cursor:end] {
+		if Match(pattern, key) && (kind == "" || s.keys[key].kind == kind) {
+			found = append(found, key)
+		}
+	}
+
+	next := "0"
+	if end < len(all) {
+		next = strconv.Itoa(end)
+	}
+
+	return []any{next, found}
+}
+
+func rename(s *Store, args []string) any {
+	e := s.get(args[0])
+	if e == nil {
+		return ErrNoSuchKey
+	}
+
+	delete(s.keys, args[0])
+	s.keys[args[1]] = e
+	if e.kind == kindList {
+		s.wake()
+	}
+
+	return Status("OK")
+}
+
+// expire sets the ttl of a key in units, or its expiry time as a timestamp in
+// units with at. NX, XX, GT and LT set it only without a ttl, with one, with
+// a later or an earlier one.
+func expire(unit time.Duration, at bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return ErrNotInt
+		}
+
+		expires := s.now().Add(time.Duration(n) * unit)
+		if at {
+			expires = time.UnixMilli(n * int64(unit/time.Millisecond))
+		}
+
+		e := s.get(args[0])
+		if e == nil {
+			return 0
+		}
+
+		for _, opt := range args[2:] {
+			var ok bool
+			switch strings.ToUpper(opt) {
+			case "NX":
+				ok = e.expires.IsZero()
+			case "XX":
+				ok = !e.expires.IsZero()
+			case "GT":
+				ok = !e.expires.IsZero() && expires.After(e.expires)
+			case "LT":
+				ok = e.expires.IsZero() || expires.Before(e.expires)
+			default:
+				return fmt.Errorf("ERR Unsupported option %s", opt)
+			}
+
+			if !ok {
+				return 0
+			}
+		}
+
+		if !expires.After(s.now()) {
+			delete(s.keys, args[0])
+			return 1
+		}
+
+		e.expires = expires
+
+		return 1
+	}
+}
+
+// ttl replies with the ttl of a key in units, -1 without one and -2 when
+// the key is missing.
+func ttl(unit time.Duration) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		e := s.get(args[0])
+		switch {
+		case e == nil:
+			return -2
+		case e.expires.IsZero():
+			return -1
+		}
+
+		left := e.expires.Sub(s.now())
+
+		return int64((left + unit/2) / unit)
+	}
+}
+
+func persist(s *Store, args []string) any {
+	e := s.get(args[0])
+	if e == nil || e.expires.IsZero() {
+		return 0
+	}
+
+	e.expires = time.Time{}
+
+	return 1
+}
+
+func get(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindString)
+	switch {
+	case err != nil:
+		return err
+	case e == nil:
+		return nil
+	}
+
+	return e.str
+}
+
+// set handles SET with its EX, PX, EXAT, PXAT, KEEPTTL, NX, XX and GET
+// options.
+func set(s *Store, args []string) any {
+	key, value := args[0], args[1]
+
+	var expires time.Time
+	var nx, xx, keep, reply bool
+
+	for opts := args[2:]; len(opts) > 0; opts = opts[1:] {
+		opt := strings.ToUpper(opts[0])
+
+		switch opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keep = true
+		case "GET":
+			reply = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if len(opts) < 2 || !expires.IsZero() {
+				return ErrSyntax
+			}
+
+			n, err := strconv.ParseInt(opts[1], 10, 64)
+			if err != nil {
+				return ErrNotInt
+			}
+			if n <= 0 {
+				return fmt.Errorf("ERR invalid expire time in 'set' command")
+			}
+
+			switch opt {
+			case "EX":
+				expires = s.now().Add(time.Duration(n) * time.Second)
+			case "PX":
+				expires = s.now().Add(time.Duration(n) * time.Millisecond)
+			case "EXAT":
+				expires = time.Unix(n, 0)
+			case "PXAT":
+				expires = time.UnixMilli(n)
+			}
+			opts = opts[1:]
+		default:
+			return ErrSyntax
+		}
+	}
+
+	if (nx && xx) || (keep && !expires.IsZero()) {
+		return ErrSyntax
+	}
+
+	old := s.get(key)
+
+	var previous any
+	if reply && old != nil {
+		if old.kind != kindString {
+			return ErrWrongType
+		}
+		previous = old.str
+	}
+
+	if (nx && old != nil) || (xx && old == nil) {
+		if reply {
+			return previous
+		}
+		return nil
+	}
+
+	if keep && old != nil {
+		expires = old.expires
+	}
+
+	s.keys[key] = &entry{kind: kindString, str: value, expires: expires}
+
+	if reply {
+		return previous
+	}
+
+	return Status("OK")
+}
+
+func setNX(s *Store, args []string) any {
+	if s.get(args[0]) != nil {
+		return 0
+	}
+
+	s.keys[args[0]] = &entry{kind: kindString, str: args[1]}
+
+	return 1
+}
+
+func setEX(unit time.Duration) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return ErrNotInt
+		}
+		if n <= 0 {
+			return fmt.Errorf("ERR invalid expire time in '%s' command", map[time.Duration]string{time.Second: "setex", time.Millisecond: "psetex"}[unit])
+		}
+
+		s.keys[args[0]] = &entry{kind: kindString, str: args[2], expires: s.now().Add(time.Duration(n) * unit)}
+
+		return Status("OK")
+	}
+}
+
+func getSet(s *Store, args []string) any {
+	previous := get(s, args[:1])
+	if err, ok := previous.(error); ok {
+		return err
+	}
+
+	s.keys[args[0]] = &entry{kind: kindString, str: args[1]}
+
+	return previous
+}
+
+func getDel(s *Store, args []string) any {
+	value := get(s, args)
+	if value != nil {
+		if _, ok := value.(error); !ok {
+			delete(s.keys, args[0])
+		}
+	}
+
+	return value
+}
+
+func mget(s *Store, args []string) any {
+	values := make([]any, 0, len(args))
+	for _, key := range args {
+		// other kinds read as missing
+		if e := s.get(key); e != nil && e.kind == kindString {
+			values = append(values, e.str)
+		} else {
+			values = append(values, nil)
+		}
+	}
+
+	return values
+}
+
+func mset(s *Store, args []string) any {
+	if len(args)%2 != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for 'mset' command")
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		s.keys[args[i]] = &entry{kind: kindString, str: args[i+1]}
+	}
+
+	return Status("OK")
+}
+
+// incr adds sign, or sign times the argument with by, to the number in a
+// string.
+func incr(sign int64, by bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		delta := sign
+		if by {
+			n, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return ErrNotInt
+			}
+			delta *= n
+		}
+
+		e, err := s.create(args[0], kindString)
+		if err != nil {
+			return err
+		}
+
+		n, err := addInt(e.str, delta)
+		if err != nil {
+			return err
+		}
+		e.str = strconv.FormatInt(n, 10)
+
+		return n
+	}
+}
+
+// addInt adds delta to the number in value, which is 0 when empty.
+func addInt(value string, delta int64) (int64, error) {
+	var n int64
+	if value != "" {
+		var err error
+		if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, ErrNotInt
+		}
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, fmt.Errorf("ERR increment or decrement would overflow")
+	}
+
+	return n + delta, nil
+}
+
+// addFloat adds delta to the number in value, which is 0 when empty.
+func addFloat(value, delta string) (string, error) {
+	d, err := strconv.ParseFloat(delta, 64)
+	if err != nil || math.IsNaN(d) || math.IsInf(d, 0) {
+		return "", ErrNotFloat
+	}
+
+	var n float64
+	if value != "" {
+		if n, err = strconv.ParseFloat(value, 64); err != nil {
+			return "", ErrNotFloat
+		}
+	}
+
+	return strconv.FormatFloat(n+d, 'f', -1, 64), nil
+}
+
+func incrByFloat(s *Store, args []string) any {
+	e, err := s.create(args[0], kindString)
+	if err != nil {
+		return err
+	}
+
+	value, err := addFloat(e.str, args[1])
+	if err != nil {
+		return err
+	}
+	e.str = value
+
+	return value
+}
+
+func appendString(s *Store, args []string) any {
+	e, err := s.create(args[0], kindString)
+	if err != nil {
+		return err
+	}
+
+	e.str += args[1]
+
+	return len(e.str)
+}
+
+func strLen(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindString)
+	switch {
+	case err != nil:
+		return err
+	case e == nil:
+		return 0
+	}
+
+	return len(e.str)
+}
+
+// hset sets fields of a hash, replying with how many were added, or OK for
+// the older HMSET.
+func hset(ok bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		if len(args)%2 != 1 {
+			return fmt.Errorf("ERR wrong number of arguments for '%s' command", map[bool]string{false: "hset", true: "hmset"}[ok])
+		}
+
+		e, err := s.create(args[0], kindHash)
+		if err != nil {
+			return err
+		}
+
+		var added int
+		for i := 1; i < len(args); i += 2 {
+			if _, exists := e.hash[args[i]]; !exists {
+				added++
+			}
+			e.hash[args[i]] = args[i+1]
+		}
+
+		if ok {
+			return Status("OK")
+		}
+
+		return added
+	}
+}
+
+func hsetNX(s *Store, args []string) any {
+	e, err := s.create(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := e.hash[args[1]]; exists {
+		return 0
+	}
+	e.hash[args[1]] = args[2]
+
+	return 1
+}
+
+func hget(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	if e != nil {
+		if value, ok := e.hash[args[1]]; ok {
+			return value
+		}
+	}
+
+	return nil
+}
+
+func hmget(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	values := make([]any, 0, len(args)-1)
+	for _, field := range args[1:] {
+		if value, ok := e.fields()[field]; ok {
+			values = append(values, value)
+		} else {
+			values = append(values, nil)
+		}
+	}
+
+	return values
+}
+
+// fields returns the hash of an entry that may be missing.
+func (e *entry) fields() map[string]string {
+	if e == nil {
+		return nil
+	}
+
+	return e.hash
+}
+
+func hgetAll(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	list := []string{}
+	for _, field := range slices.Sorted(maps.Keys(e.fields())) {
+		list = append(list, field, e.hash[field])
+	}
+
+	return list
+}
+
+func hdel(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindHash)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+
+	var n int
+	for _, field := range args[1:] {
+		if _, ok := e.hash[field]; ok {
+			delete(e.hash, field)
+			n++
+		}
+	}
+	s.drop(args[0], e)
+
+	return n
+}
+
+func hexists(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := e.fields()[args[1]]; ok {
+		return 1
+	}
+
+	return 0
+}
+
+func hlen(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	return len(e.fields())
+}
+
+func hkeys(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	return append([]string{}, slices.Sorted(maps.Keys(e.fields()))...)
+}
+
+func hvals(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	values := []string{}
+	for _, field := range slices.Sorted(maps.Keys(e.fields())) {
+		values = append(values, e.hash[field])
+	}
+
+	return values
+}
+
+func hincrBy(s *Store, args []string) any {
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return ErrNotInt
+	}
+
+	e, err := s.create(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	n, err := addInt(e.hash[args[1]], delta)
+	if err != nil {
+		s.drop(args[0], e)
+		return err
+	}
+	e.hash[args[1]] = strconv.FormatInt(n, 10)
+
+	return n
+}
+
+func hincrByFloat(s *Store, args []string) any {
+	e, err := s.create(args[0], kindHash)
+	if err != nil {
+		return err
+	}
+
+	value, err := addFloat(e.hash[args[1]], args[2])
+	if err != nil {
+		s.drop(args[0], e)
+		return err
+	}
+	e.hash[args[1]] = value
+
+	return value
+}
+
+// push adds values to the head or tail of a list, waking blocking pops.
+func push(head bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		e, err := s.create(args[0], kindList)
+		if err != nil {
+			return err
+		}
+
+		for _, value := range args[1:] {
+			if head {
+				e.list = slices.Insert(e.list, 0, value)
+			} else {
+				e.list = append(e.list, value)
+			}
+		}
+		s.wake()
+
+		return len(e.list)
+	}
+}
+
+// pop removes a value, or as many as a count, from the head or tail of a
+// list.
+func pop(head bool) func(s *Store, args []string) any {
+	return func(s *Store, args []string) any {
+		count := -1
+		if len(args) > 2 {
+			return ErrSyntax
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 0 {
+				return fmt.Errorf("ERR value is out of range, must be positive")
+			}
+			count = n
+		}
+
+		e, err := s.typed(args[0], kindList)
+		switch {
+		case err != nil:
+			return err
+		case e == nil && count >= 0:
+			return NullArray
+		case e == nil:
+			return nil
+		}
+
+		if count < 0 {
+			return s.popOne(args[0], e, head)
+		}
+
+		values := []string{}
+		for range min(count, len(e.list)) {
+			values = append(values, s.popOne(args[0], e, head))
+		}
+
+		return values
+	}
+}
+
+// popOne removes a value from the head or tail of a list that has one.
+// Callers must hold s.mu.
+func (s *Store) popOne(key string, e *entry, head bool) string {
+	var value string
+	if head {
+		value, e.list = e.list[0], e.list[1:]
+	} else {
+		value, e.list = e.list[len(e.list)-1], e.list[:len(e.list)-1]
+	}
+	s.drop(key, e)
+
+	return value
+}
+
+// blockingPop pops from the first of the lists that has a value, waiting
+// for one up to the timeout in seconds, forever for 0.
+func blockingPop(head bool) func(s *Store, ctx context.Context, args []string) any {
+	return func(s *Store, ctx context.Context, args []string) any {
+		keys := args[:len(args)-1]
+
+		seconds, err := strconv.ParseFloat(args[len(args)-1], 64)
+		if err != nil || seconds < 0 || math.IsInf(seconds, 0) {
+			return fmt.Errorf("ERR timeout is not a float or out of range")
+		}
+
+		var timeout <-chan time.Time
+		if seconds > 0 {
+			timer := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		for {
+			s.mu.Lock()
+			for _, key := range keys {
+				e, err := s.typed(key, kindList)
+				if err != nil {
+					s.mu.Unlock()
+					return err
+				}
+
+				if e != nil {
+					value := s.popOne(key, e, head)
+					s.mu.Unlock()
+					return []string{key, value}
+				}
+			}
+			pushed := s.pushed
+			s.mu.Unlock()
+
+			select {
+			case <-pushed:
+			case <-timeout:
+				return NullArray
+			case <-ctx.Done():
+				return NullArray
+			}
+		}
+	}
+}
+
+func llen(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindList)
+	switch {
+	case err != nil:
+		return err
+	case e == nil:
+		return 0
+	}
+
+	return len(e.list)
+}
+
+// span turns start and stop indexes, which count from the end when
+// negative, into a slice of n values. It reports false when the slice is
+// empty.
+func span(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+
+	return start, stop + 1, true
+}
+
+// indexes parses the start and stop arguments of a list command.
+func indexes(args []string) (int, int, error) {
+	start, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, 0, ErrNotInt
+	}
+
+	stop, err := strconv.Atoi(args[1])
+	if err != nil {
+		return 0, 0, ErrNotInt
+	}
+
+	return start, stop, nil
+}
+
+func lrange(s *Store, args []string) any {
+	start, stop, err := indexes(args[1:])
+	if err != nil {
+		return err
+	}
+
+	e, err := s.typed(args[0], kindList)
+	switch {
+	case err != nil:
+		return err
+	case e == nil:
+		return []string{}
+	}
+
+	from, to, ok := span(start, stop, len(e.list))
+	if !ok {
+		return []string{}
+	}
+
+	return slices.Clone(e.list[from:to])
+}
+
+// index resolves an index, counting from the end when negative. It reports
+// false when it is out of range.
+func index(arg string, n int) (int, bool, error) {
+	i, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, false, ErrNotInt
+	}
+
+	if i < 0 {
+		i += n
+	}
+
+	return i, i >= 0 && i < n, nil
+}
+
+func lindex(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindList)
+	switch {
+	case err != nil:
+		return err
+	case e == nil:
+		return nil
+	}
+
+	i, ok, err := index(args[1], len(e.list))
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		return nil
+	}
+
+	return e.list[i]
+}
+
+func lset(s *Store, args []string) any {
+	e, err := s.typed(args[0], kindList)
+	switch {
+	case err != nil:
+		return err
+	case e == nil:
+		return ErrNoSuchKey
+	}
+
+	i, ok, err := index(args[1], len(e.list))
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		return ErrRange
+	}
+	e.list[i] = args[2]
+
+	return Status("OK")
+}
+
+// lrem removes values equal to the argument: count of them from the head,
+// from the tail when negative, or all of them for 0.
+func lrem(s *Store, args []string) any {
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return ErrNotInt
+	}
+
+	e, err := s.typed(args[0], kindList)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+		slices.Reverse(e.list)
+	}
+
+	var removed int
+	e.list = slices.DeleteFunc(e.list, func(value string) bool {
+		if value != args[2] || (limit > 0 && removed == limit) {
+			return false
+		}
+		removed++
+		return true
+	})
+
+	if count < 0 {
+		slices.Reverse(e.list)
+	}
+	s.drop(args[0], e)
+
+	return removed
+}
+
+func ltrim(s *Store, args []string) any {
+	start, stop, err := indexes(args[1:])
+	if err != nil {
+		return err
+	}
+
+	e, err := s.typed(args[0], kindList)
+	switch {
+	case err != nil:
+		return err
+	case e == nil:
+		return Status("OK")
+	}
+
+	from, to, ok := span(start, stop, len(e.list))
+	if !ok {
+		from, to = 0, 0
+	}
+	e.list = slices.Clone(e.list[from:to])
+	s.drop(args[0], e)
+
+	return Status("OK")
+}
+
+func publish(s *Store, args []string) any {
+	return s.Broker.Publish(args[0], args[1])
+}
+
+func pubsub(s *Store, args []string) any {
+	switch strings.ToUpper(args[0]) {
+	case "CHANNELS":
+		var pattern string
+		if len(args) > 1 {
+			pattern = args[1]
+		}
+		return append([]string{}, s.Broker.Channels(pattern)...)
+	case "NUMSUB":
+		counts := []any{}
+		for _, channel := range args[1:] {
+			counts = append(counts, channel, s.Broker.NumSub(channel))
+		}
+		return counts
+	case "NUMPAT":
+		return s.Broker.NumPat()
+	default:
+		return fmt.Errorf("ERR unknown subcommand '%s'", args[0])
+	}
+}
+
+// orZero replies with err, or 0 without one.
+func orZero(err error) any {
+	if err != nil {
+		return err
+	}
+
+	return 0
+}
@@ -0,0 +1,198 @@
+package redis_store
+
+import (
+	"slices"
+	"sync"
+)
+
+// subscriberBuffer is how many messages wait for a slow subscriber before
+// newer ones are dropped.
+const subscriberBuffer = 1024
+
+// Broker delivers messages published to channels to their subscribers.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+}
+
+// NewBroker creates a Broker without subscribers.
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[*Subscriber]struct{})}
+}
+
+// Subscriber is a client subscribed to channels and patterns.
+type Subscriber struct {
+	// Messages receives message and pmessage replies to send to the client.
+	Messages chan []any
+
+	broker   *Broker
+	channels map[string]bool
+	patterns map[string]bool
+}
+
+// Subscriber creates a Subscriber, subscribed to nothing yet.
+func (b *Broker) Subscriber() *Subscriber {
+	return &Subscriber{
+		Messages: make(chan []any, subscriberBuffer),
+		broker:   b,
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+	}
+}
+
+// Publish sends message to the subscribers of channel and of patterns
+// matching it, returning how many received it.
+func (b *Broker) Publish(channel, message string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var received int
+	send := func(s *Subscriber, reply []any) {
+		select {
+		case s.Messages <- reply:
+			received++
+		default:
+			// the subscriber is not keeping up
+		}
+	}
+
+	for s := range b.subscribers {
+		if s.channels[channel] {
+			send(s, []any{"message", channel, message})
+		}
+
+		for pattern := range s.patterns {
+			if Match(pattern, channel) {
+				send(s, []any{"pmessage", pattern, channel, message})
+			}
+		}
+	}
+
+	return received
+}
+
+// Channels lists the channels with subscribers matching pattern, or all of
+// them when pattern is empty.
+func (b *Broker) Channels(pattern string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var channels []string
+	for s := range b.subscribers {
+		for channel := range s.channels {
+			if (pattern == "" || Match(pattern, channel)) && !slices.Contains(channels, channel) {
+				channels = append(channels, channel)
+			}
+		}
+	}
+
+	slices.Sort(channels)
+
+	return channels
+}
+
+// NumSub counts the subscribers of channel, not counting patterns.
+func (b *Broker) NumSub(channel string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var n int
+	for s := range b.subscribers {
+		if s.channels[channel] {
+			n++
+		}
+	}
+
+	return n
+}
+
+// NumPat counts the patterns subscribed to.
+func (b *Broker) NumPat() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var n int
+	for s := range b.subscribers {
+		n += len(s.patterns)
+	}
+
+	return n
+}
+
+// Count is how many channels and patterns the subscriber is subscribed to.
+// A client with subscriptions can only subscribe, unsubscribe and ping.
+func (s *Subscriber) Count() int {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	return len(s.channels) + len(s.patterns)
+}
+
+// Subscribe subscribes to channels, returning a reply for each.
+func (s *Subscriber) Subscribe(channels []string) []any {
+	return s.change("subscribe", s.channels, channels, true)
+}
+
+// Unsubscribe unsubscribes from channels, or from every channel when none
+// are given, returning a reply for each.
+func (s *Subscriber) Unsubscribe(channels []string) []any {
+	return s.change("unsubscribe", s.channels, channels, false)
+}
+
+// PSubscribe subscribes to patterns, returning a reply for each.
+func (s *Subscriber) PSubscribe(patterns []string) []any {
+	return s.change("psubscribe", s.patterns, patterns, true)
+}
+
+// PUnsubscribe unsubscribes from patterns, or from every pattern when none
+// are given, returning a reply for each.
+func (s *Subscriber) PUnsubscribe(patterns []string) []any {
+	return s.change("punsubscribe", s.patterns, patterns, false)
+}
+
+// Close unsubscribes from everything.
+func (s *Subscriber) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	clear(s.channels)
+	clear(s.patterns)
+	delete(s.broker.subscribers, s)
+}
+
+// change adds names to or removes them from set, replying like Redis does
+// with the kind of change, the name and the subscriptions left.
+func (s *Subscriber) change(kind string, set map[string]bool, names []string, add bool) []any {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	if !add && len(names) == 0 {
+		for name := range set {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		if len(names) == 0 {
+			return []any{[]any{kind, nil, len(s.channels) + len(s.patterns)}}
+		}
+	}
+
+	replies := make([]any, 0, len(names))
+	for _, name := range names {
+		if add {
+			set[name] = true
+		} else {
+			delete(set, name)
+		}
+
+		replies = append(replies, []any{kind, name, len(s.channels) + len(s.patterns)})
+	}
+
+	if len(s.channels)+len(s.patterns) > 0 {
+		s.broker.subscribers[s] = struct{}{}
+	} else {
+		delete(s.broker.subscribers, s)
+	}
+
+	return replies
+}
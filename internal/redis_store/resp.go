@@ -0,0 +1,134 @@
+package redis_store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Limits on commands read from clients.
+const (
+	maxArgs     = 1 << 20
+	maxBulkSize = 512 << 20
+)
+
+// Status is a simple string reply, like OK.
+type Status string
+
+// nullArray is the reply of a blocking command that timed out.
+type nullArray struct{}
+
+// NullArray replies with a null array instead of a null bulk string.
+var NullArray = nullArray{}
+
+// ErrProtocol is returned when a client sends something that is not RESP.
+var ErrProtocol = errors.New("protocol error")
+
+// ReadCommand reads the next command of a client: an array of bulk strings,
+// or an inline command like the ones typed into telnet.
+func ReadCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", ErrProtocol)
+	}
+
+	args := make([]string, 0, max(n, 0))
+	for range n {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", ErrProtocol, line)
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, fmt.Errorf("%w: invalid bulk length", ErrProtocol)
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+// readLine reads a line without its line ending.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// WriteReply writes a reply: a Status, an error, a number, a string as a bulk
+// string, nil as a null bulk string, NullArray, or a slice of any of them as
+// an array.
+func WriteReply(w *bufio.Writer, reply any) error {
+	if err := writeReply(w, reply); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// writeReply writes a reply without flushing it.
+func writeReply(w *bufio.Writer, reply any) error {
+	switch r := reply.(type) {
+	case Status:
+		_, _ = fmt.Fprintf(w, "+%s\r\n", r)
+	case error:
+		// errors start with their code, ERR unless they say otherwise
+		msg := strings.ReplaceAll(r.Error(), "\n", " ")
+		if code, _, _ := strings.Cut(msg, " "); code != strings.ToUpper(code) || code == "" {
+			msg = "ERR " + msg
+		}
+		_, _ = fmt.Fprintf(w, "-%s\r\n", msg)
+	case int:
+		_, _ = fmt.Fprintf(w, ":%d\r\n", r)
+	case int64:
+		_, _ = fmt.Fprintf(w, ":%d\r\n", r)
+	case string:
+		_, _ = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(r), r)
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case nullArray:
+		_, _ = w.WriteString("*-1\r\n")
+	case []string:
+		_, _ = fmt.Fprintf(w, "*%d\r\n", len(r))
+		for _, s := range r {
+			_ = writeReply(w, s)
+		}
+	case []any:
+		_, _ = fmt.Fprintf(w, "*%d\r\n", len(r))
+		for _, item := range r {
+			if err := writeReply(w, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported reply %T", reply)
+	}
+
+	return nil
+}
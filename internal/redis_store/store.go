@@ -0,0 +1,357 @@
+package redis_store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSeed is the seed file in the service's results folder used when
+// none is configured.
+const DefaultSeed = "seed.yaml"
+
+// Config is parsed from the redis section of a service yaml file.
+type Config struct {
+	// Seed is a yaml file with the keys the service starts with, relative to
+	// the service's results folder. Defaults to DefaultSeed when it exists.
+	Seed string `yaml:"seed"`
+}
+
+// Seed is the content of a seed file.
+//
+//	keys:
+//	  feature:checkout: "on"
+//	  user:1: {name: Ada, email: ada@example.com}
+//	  queue:emails: [welcome, reset-password]
+//	expire:
+//	  feature:checkout: 1h
+type Seed struct {
+	// Keys are strings, or hashes for mappings and lists for sequences.
+	Keys map[string]any `yaml:"keys"`
+
+	// Expire sets the ttl of keys, from when the seed is loaded.
+	Expire map[string]time.Duration `yaml:"expire"`
+}
+
+// Errors replied to commands.
+var (
+	ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrSyntax    = errors.New("ERR syntax error")
+	ErrNotInt    = errors.New("ERR value is not an integer or out of range")
+	ErrNotFloat  = errors.New("ERR value is not a valid float")
+	ErrNoSuchKey = errors.New("ERR no such key")
+	ErrRange     = errors.New("ERR index out of range")
+)
+
+// Kinds of values.
+const (
+	kindString = "string"
+	kindHash   = "hash"
+	kindList   = "list"
+)
+
+// entry is the value of a key.
+type entry struct {
+	kind    string
+	str     string
+	hash    map[string]string
+	list    []string
+	expires time.Time // zero without a ttl
+}
+
+// Store keeps keys in memory and runs commands on them, like a Redis with a
+// single database.
+type Store struct {
+	mu     sync.Mutex
+	keys   map[string]*entry
+	pushed chan struct{} // closed when lists get values, for blocking pops
+	seed   []byte
+	loaded bool
+
+	// Broker delivers messages published to channels.
+	Broker *Broker
+
+	now func() time.Time
+}
+
+// New creates an empty Store.
+func New() *Store {
+	return &Store{
+		keys:   make(map[string]*entry),
+		pushed: make(chan struct{}),
+		Broker: NewBroker(),
+		now:    time.Now,
+	}
+}
+
+// Load replaces the keys of the store with the ones in a seed file. Loading
+// the seed already loaded does nothing, keeping changes made since.
+func (s *Store) Load(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loaded && bytes.Equal(data, s.seed) {
+		return nil
+	}
+
+	keys, err := s.parseSeed(data)
+	if err != nil {
+		return err
+	}
+
+	s.keys, s.seed, s.loaded = keys, data, true
+	s.wake()
+
+	return nil
+}
+
+// Reset returns the store to its seed, or empties it without one.
+func (s *Store) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.parseSeed(s.seed)
+	if err != nil {
+		return err
+	}
+
+	s.keys = keys
+	s.wake()
+
+	return nil
+}
+
+// parseSeed reads the keys of a seed file.
+func (s *Store) parseSeed(data []byte) (map[string]*entry, error) {
+	var seed Seed
+	if err := yaml.Unmarshal(data, &seed); err != nil {
+		return nil, fmt.Errorf("failed to parse seed: %s", err)
+	}
+
+	keys := make(map[string]*entry, len(seed.Keys))
+	for key, value := range seed.Keys {
+		invalid := fmt.Errorf("unsupported value of key %s in seed", key)
+
+		switch v := value.(type) {
+		case map[string]any:
+			e := &entry{kind: kindHash, hash: make(map[string]string, len(v))}
+			for field, value := range v {
+				str, ok := scalar(value)
+				if !ok {
+					return nil, invalid
+				}
+				e.hash[field] = str
+			}
+			keys[key] = e
+		case []any:
+			e := &entry{kind: kindList}
+			for _, value := range v {
+				str, ok := scalar(value)
+				if !ok {
+					return nil, invalid
+				}
+				e.list = append(e.list, str)
+			}
+			keys[key] = e
+		default:
+			str, ok := scalar(value)
+			if !ok {
+				return nil, invalid
+			}
+			keys[key] = &entry{kind: kindString, str: str}
+		}
+	}
+
+	for key, ttl := range seed.Expire {
+		e, ok := keys[key]
+		if !ok {
+			return nil, fmt.Errorf("expire of key %s not in seed", key)
+		}
+		e.expires = s.now().Add(ttl)
+	}
+
+	return keys, nil
+}
+
+// scalar turns a string, number or boolean of a seed file into a string.
+func scalar(value any) (string, bool) {
+	switch value.(type) {
+	case string, int, float64, bool:
+		return fmt.Sprint(value), true
+	default:
+		return "", false
+	}
+}
+
+// Do runs a command, returning its reply for WriteReply. Blocking commands
+// give up when ctx is done.
+func (s *Store) Do(ctx context.Context, args []string) any {
+	if len(args) == 0 {
+		return errors.New("ERR empty command")
+	}
+
+	cmd, ok := commands[strings.ToUpper(args[0])]
+	if !ok {
+		return fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0]))
+	}
+
+	if cmd.block != nil {
+		return cmd.block(s, ctx, args[1:])
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return cmd.run(s, args[1:])
+}
+
+// get returns the entry of key, nil when it is missing or expired. Callers
+// must hold s.mu.
+func (s *Store) get(key string) *entry {
+	e, ok := s.keys[key]
+	if !ok {
+		return nil
+	}
+
+	if !e.expires.IsZero() && !s.now().Before(e.expires) {
+		delete(s.keys, key)
+		return nil
+	}
+
+	return e
+}
+
+// typed returns the entry of key when it holds kind, nil when it is
+// missing. Callers must hold s.mu.
+func (s *Store) typed(key, kind string) (*entry, error) {
+	e := s.get(key)
+	if e != nil && e.kind != kind {
+		return nil, ErrWrongType
+	}
+
+	return e, nil
+}
+
+// create returns the entry of key, adding an empty one of kind when it is
+// missing. Callers must hold s.mu.
+func (s *Store) create(key, kind string) (*entry, error) {
+	e, err := s.typed(key, kind)
+	if err != nil || e != nil {
+		return e, err
+	}
+
+	e = &entry{kind: kind}
+	if kind == kindHash {
+		e.hash = make(map[string]string)
+	}
+	s.keys[key] = e
+
+	return e, nil
+}
+
+// drop removes key when its hash or list is empty. Callers must hold s.mu.
+func (s *Store) drop(key string, e *entry) {
+	if (e.kind == kindHash && len(e.hash) == 0) || (e.kind == kindList && len(e.list) == 0) {
+		delete(s.keys, key)
+	}
+}
+
+// wake wakes blocking pops waiting for lists. Callers must hold s.mu.
+func (s *Store) wake() {
+	close(s.pushed)
+	s.pushed = make(chan struct{})
+}
+
+// Match reports whether s matches a glob-style pattern like Redis uses for
+// KEYS and PSUBSCRIBE: * and ? wildcards, [abc], [^a] and [a-z] classes and
+// \ escapes.
+func Match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range len(s) + 1 {
+				if Match(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// an unterminated class is a literal [
+				if s[0] != '[' {
+					return false
+				}
+				pattern, s = pattern[1:], s[1:]
+				continue
+			}
+
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+
+			var matched bool
+			for i := 0; i < len(class); i++ {
+				switch {
+				case class[i] == '\\' && i+1 < len(class):
+					i++
+					matched = matched || class[i] == s[0]
+				case i+2 < len(class) && class[i+1] == '-':
+					lo, hi := min(class[i], class[i+2]), max(class[i], class[i+2])
+					matched = matched || (lo <= s[0] && s[0] <= hi)
+					i += 2
+				default:
+					matched = matched || class[i] == s[0]
+				}
+			}
+
+			if matched == negate {
+				return false
+			}
+			pattern, s = pattern[end+2:], s[1:]
+
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+
+	return len(s) == 0
+}
@@ -0,0 +1,184 @@
+package redis_store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommands(t *testing.T) {
+	s := New()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	do := func(args ...string) any {
+		return s.Do(context.Background(), args)
+	}
+
+	assert.Equal(t, Status("PONG"), do("ping"))
+	assert.Equal(t, Status("OK"), do("SET", "greeting", "hello"))
+	assert.Equal(t, "hello", do("GET", "greeting"))
+	assert.Nil(t, do("GET", "missing"))
+	assert.Equal(t, 11, do("APPEND", "greeting", " world"))
+
+	// locks are taken with SET NX PX
+	assert.Equal(t, Status("OK"), do("SET", "lock", "a", "NX", "PX", "1500"))
+	assert.Nil(t, do("SET", "lock", "b", "NX", "PX", "1500"), "lock already taken")
+	assert.Equal(t, int64(2), do("TTL", "lock"))
+	assert.Equal(t, int64(1500), do("PTTL", "lock"))
+
+	now = now.Add(2 * time.Second)
+	assert.Nil(t, do("GET", "lock"), "lock expired")
+	assert.Equal(t, -2, do("TTL", "lock"))
+	assert.Equal(t, -1, do("TTL", "greeting"))
+
+	assert.Equal(t, int64(1), do("INCR", "visits"))
+	assert.Equal(t, int64(11), do("INCRBY", "visits", "10"))
+	assert.Equal(t, "11.5", do("INCRBYFLOAT", "visits", "0.5"))
+	assert.Equal(t, ErrNotInt, do("INCR", "greeting"))
+
+	assert.Equal(t, 2, do("HSET", "user:1", "name", "Ada", "email", "ada@example.com"))
+	assert.Equal(t, "Ada", do("HGET", "user:1", "name"))
+	assert.Equal(t, []string{"email", "ada@example.com", "name", "Ada"}, do("HGETALL", "user:1"))
+	assert.Equal(t, []any{"Ada", nil}, do("HMGET", "user:1", "name", "phone"))
+	assert.Equal(t, int64(3), do("HINCRBY", "user:1", "logins", "3"))
+	assert.Equal(t, ErrWrongType, do("GET", "user:1"))
+
+	assert.Equal(t, 3, do("RPUSH", "queue", "a", "b", "c"))
+	assert.Equal(t, 4, do("LPUSH", "queue", "z"))
+	assert.Equal(t, []string{"z", "a", "b", "c"}, do("LRANGE", "queue", "0", "-1"))
+	assert.Equal(t, []string{"b", "c"}, do("LRANGE", "queue", "-2", "10"))
+	assert.Equal(t, "z", do("LPOP", "queue"))
+	assert.Equal(t, []string{"c", "b"}, do("RPOP", "queue", "2"))
+	assert.Equal(t, "a", do("LINDEX", "queue", "0"))
+	assert.Equal(t, "a", do("LPOP", "queue"))
+	assert.Equal(t, 0, do("EXISTS", "queue"), "empty lists are removed")
+
+	assert.Equal(t, []string{"greeting", "user:1", "visits"}, do("KEYS", "*"))
+	assert.Equal(t, []string{"user:1"}, do("KEYS", "user:[0-9]"))
+	assert.Equal(t, []any{"2", []string{"greeting"}}, do("SCAN", "0", "COUNT", "2", "MATCH", "g*"))
+	assert.Equal(t, []any{"0", []string{"visits"}}, do("SCAN", "2", "COUNT", "2"))
+	assert.Equal(t, Status("hash"), do("TYPE", "user:1"))
+
+	assert.Equal(t, 1, do("EXPIRE", "visits", "10"))
+	assert.Equal(t, 1, do("PERSIST", "visits"))
+	assert.Equal(t, 2, do("DEL", "visits", "greeting", "missing"))
+
+	err, _ := do("NOPE").(error)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown command")
+	err, _ = do("GET").(error)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "wrong number of arguments for 'get'")
+}
+
+func TestBlockingPop(t *testing.T) {
+	s := New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.Do(ctx, []string{"RPUSH", "jobs", "build"})
+	}()
+
+	assert.Equal(t, []string{"jobs", "build"}, s.Do(ctx, []string{"BLPOP", "other", "jobs", "0"}))
+	assert.Equal(t, NullArray, s.Do(ctx, []string{"BRPOP", "jobs", "0.05"}), "timed out")
+}
+
+func TestSeed(t *testing.T) {
+	s := New()
+
+	seed := []byte(`
+keys:
+  feature:checkout: "on"
+  retries: 3
+  user:1: {name: Ada}
+  queue:emails: [welcome, reset]
+expire:
+  feature:checkout: 1h
+`)
+
+	require.Nil(t, s.Load(seed), "error loading seed")
+	do := func(args ...string) any {
+		return s.Do(context.Background(), args)
+	}
+
+	assert.Equal(t, "on", do("GET", "feature:checkout"))
+	assert.Equal(t, int64(4), do("INCR", "retries"))
+	assert.Equal(t, "Ada", do("HGET", "user:1", "name"))
+	assert.Equal(t, []string{"welcome", "reset"}, do("LRANGE", "queue:emails", "0", "-1"))
+	assert.Equal(t, int64(3600), do("TTL", "feature:checkout"))
+
+	require.Nil(t, s.Load(seed))
+	assert.Equal(t, "4", do("GET", "retries"), "loading the same seed keeps changes")
+
+	require.Nil(t, s.Reset())
+	assert.Equal(t, "3", do("GET", "retries"), "reset returns to the seed")
+
+	assert.NotNil(t, s.Load([]byte("keys:\n  bad: {nested: {deep: 1}}\n  worse: [[1]]\n")), "nested values")
+	assert.NotNil(t, s.Load([]byte("expire:\n  missing: 1s\n")))
+	assert.Equal(t, "3", do("GET", "retries"), "a failed load keeps the keys")
+}
+
+func TestPubSub(t *testing.T) {
+	s := New()
+
+	orders := s.Broker.Subscriber()
+	assert.Equal(t, []any{[]any{"subscribe", "orders", 1}}, orders.Subscribe([]string{"orders"}))
+	assert.Equal(t, []any{[]any{"psubscribe", "order*", 2}}, orders.PSubscribe([]string{"order*"}))
+
+	assert.Equal(t, 2, s.Do(context.Background(), []string{"PUBLISH", "orders", "created"}))
+	assert.Equal(t, []any{"message", "orders", "created"}, <-orders.Messages)
+	assert.Equal(t, []any{"pmessage", "order*", "orders", "created"}, <-orders.Messages)
+
+	assert.Equal(t, []string{"orders"}, s.Do(context.Background(), []string{"PUBSUB", "CHANNELS"}))
+	assert.Equal(t, []any{[]any{"unsubscribe", "orders", 1}}, orders.Unsubscribe(nil))
+
+	orders.Close()
+	assert.Equal(t, 0, s.Do(context.Background(), []string{"PUBLISH", "orders", "shipped"}))
+}
+
+func TestRESP(t *testing.T) {
+	args, err := ReadCommand(bufio.NewReader(strings.NewReader("*3\r\n$3\r\nSET\r\n$4\r\nname\r\n$8\r\nAda\r\nLov\r\n")))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"SET", "name", "Ada\r\nLov"}, args)
+
+	args, err = ReadCommand(bufio.NewReader(strings.NewReader("GET name\r\n")))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"GET", "name"}, args, "inline command")
+
+	_, err = ReadCommand(bufio.NewReader(strings.NewReader("*1\r\n:1\r\n")))
+	assert.ErrorIs(t, err, ErrProtocol)
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	require.Nil(t, WriteReply(w, []any{Status("OK"), ErrWrongType, 3, "hi", nil, NullArray}))
+	assert.Equal(t, "*6\r\n+OK\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n:3\r\n$2\r\nhi\r\n$-1\r\n*-1\r\n", buf.String())
+}
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users", false},
+		{"h?llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[a-c]llo", "hbllo", true},
+		{`a\*b`, "a*b", true},
+		{`a\*b`, "axb", false},
+	} {
+		assert.Equal(t, c.want, Match(c.pattern, c.s), "%s ~ %s", c.pattern, c.s)
+	}
+}
@@ -0,0 +1,673 @@
+package s3_store
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// stateDir holds what the store keeps besides buckets and objects. Bucket
+// names cannot start with a dot, so it never clashes with one.
+const stateDir = ".fake-ops"
+
+// Config is parsed from the s3 section of a service yaml file.
+type Config struct {
+	// Dir holds a folder per bucket with its objects as files. Defaults to
+	// the service's results folder.
+	Dir string `yaml:"dir"`
+
+	// Buckets are created when the service starts.
+	Buckets []string `yaml:"buckets"`
+
+	// Region is reported as the location of every bucket. Defaults to
+	// DefaultRegion.
+	Region string `yaml:"region"`
+
+	// Domain enables virtual-hosted style requests to <bucket>.<Domain>.
+	// Defaults to DefaultDomain.
+	Domain string `yaml:"domain"`
+}
+
+// DefaultRegion is the region buckets are in when none is configured.
+const DefaultRegion = "us-east-1"
+
+// DefaultDomain is the domain of virtual-hosted style requests when none is
+// configured.
+const DefaultDomain = "localhost"
+
+// Errors returned by a Store.
+var (
+	ErrNoSuchBucket      = errors.New("the bucket does not exist")
+	ErrNoSuchKey         = errors.New("the key does not exist")
+	ErrNoSuchUpload      = errors.New("the upload does not exist")
+	ErrBucketNotEmpty    = errors.New("the bucket is not empty")
+	ErrInvalidBucketName = errors.New("invalid bucket name")
+	ErrInvalidKey        = errors.New("invalid key")
+	ErrInvalidPart       = errors.New("a part is missing or its etag does not match")
+	ErrInvalidPartOrder  = errors.New("parts are not in ascending order")
+)
+
+// Info is what is stored with an object besides its content.
+type Info struct {
+	ContentType string            `json:"contentType"`
+	Headers     map[string]string `json:"headers,omitempty"`  // like Content-Disposition and Cache-Control
+	Metadata    map[string]string `json:"metadata,omitempty"` // x-amz-meta-* headers without the prefix
+	ETag        string            `json:"etag"`
+}
+
+// Object describes a stored object.
+type Object struct {
+	Bucket       string
+	Key          string
+	Size         int64
+	LastModified time.Time
+	Info
+
+	path string
+}
+
+// Open opens the content of the object.
+func (o *Object) Open() (*os.File, error) {
+	return os.Open(o.path)
+}
+
+// Bucket describes a bucket.
+type Bucket struct {
+	Name    string
+	Created time.Time
+}
+
+// Store keeps buckets and objects in a directory.
+type Store struct {
+	Dir string
+}
+
+// New creates a Store keeping its buckets in dir.
+func New(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// bucketPath checks the name of a bucket and returns its folder.
+func (s *Store) bucketPath(bucket string) (string, error) {
+	if !bucketName.MatchString(bucket) || strings.Contains(bucket, "..") {
+		return "", ErrInvalidBucketName
+	}
+
+	return filepath.Join(s.Dir, bucket), nil
+}
+
+// existingBucket returns the folder of a bucket that exists.
+func (s *Store) existingBucket(bucket string) (string, error) {
+	dir, err := s.bucketPath(bucket)
+	if err != nil {
+		return "", err
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", ErrNoSuchBucket
+	}
+
+	return dir, nil
+}
+
+// objectPath checks a key and returns the file of the object. Keys are
+// stored as paths, so they cannot have empty, . or .. segments. A key ending
+// with a slash is a folder.
+func (s *Store) objectPath(bucket, key string) (string, error) {
+	dir, err := s.existingBucket(bucket)
+	if err != nil {
+		return "", err
+	}
+
+	if key == "" || len(key) > 1024 {
+		return "", ErrInvalidKey
+	}
+
+	for _, segment := range strings.Split(strings.TrimSuffix(key, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(key)), nil
+}
+
+// metaPath is where the Info of an object is stored.
+func (s *Store) metaPath(bucket, key string) string {
+	return filepath.Join(s.Dir, stateDir, "meta", bucket, filepath.FromSlash(strings.TrimSuffix(key, "/"))+".json")
+}
+
+// Buckets lists the buckets by name.
+func (s *Store) Buckets() ([]Bucket, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	buckets := []Bucket{}
+	for _, e := range entries {
+		if !e.IsDir() || !bucketName.MatchString(e.Name()) {
+			continue
+		}
+
+		b := Bucket{Name: e.Name()}
+		if info, err := e.Info(); err == nil {
+			b.Created = info.ModTime()
+		}
+		buckets = append(buckets, b)
+	}
+
+	return buckets, nil
+}
+
+// CreateBucket creates a bucket. Creating one that exists does nothing.
+func (s *Store) CreateBucket(bucket string) error {
+	dir, err := s.bucketPath(bucket)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(dir, 0755)
+}
+
+// HasBucket returns ErrNoSuchBucket when the bucket does not exist.
+func (s *Store) HasBucket(bucket string) error {
+	_, err := s.existingBucket(bucket)
+	return err
+}
+
+// DeleteBucket deletes an empty bucket.
+func (s *Store) DeleteBucket(bucket string) error {
+	dir, err := s.existingBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > 0 {
+		return ErrBucketNotEmpty
+	}
+
+	_ = os.RemoveAll(filepath.Join(s.Dir, stateDir, "meta", bucket))
+
+	return os.Remove(dir)
+}
+
+// Put stores an object, replacing any object with the same key.
+func (s *Store) Put(bucket, key string, body io.Reader, info Info) (*Object, error) {
+	path, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(key, "/") {
+		// a folder, written by consoles to show empty folders
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return nil, err
+		}
+
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, err
+		}
+
+		info.ETag = fmt.Sprintf("%x", md5.Sum(nil))
+
+		return s.finish(bucket, key, path, info)
+	}
+
+	tmp, err := s.tempFile()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info.ETag = hex.EncodeToString(hash.Sum(nil))
+
+	if err := s.place(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	return s.finish(bucket, key, path, info)
+}
+
+// tempFile creates a file in the state folder, on the same file system as
+// the buckets so it can be renamed into one.
+func (s *Store) tempFile() (*os.File, error) {
+	dir := filepath.Join(s.Dir, stateDir, "tmp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return os.CreateTemp(dir, "object-")
+}
+
+// place moves a written file to the path of an object.
+func (s *Store) place(tmp, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("%w: a parent of the key is an object", ErrInvalidKey)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("%w: the key is a folder of other objects", ErrInvalidKey)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// finish stores the info of a written object and describes it.
+func (s *Store) finish(bucket, key, path string, info Info) (*Object, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := s.metaPath(bucket, key)
+	if err := os.MkdirAll(filepath.Dir(meta), 0755); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(meta, data, 0644); err != nil {
+		return nil, err
+	}
+
+	return s.Head(bucket, key)
+}
+
+// Head describes an object. Objects put in the folder by hand get their
+// content type from their extension and their ETag from their content.
+func (s *Store) Head(bucket, key string) (*Object, error) {
+	path, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil || stat.IsDir() != strings.HasSuffix(key, "/") {
+		return nil, ErrNoSuchKey
+	}
+
+	o := &Object{Bucket: bucket, Key: key, LastModified: stat.ModTime(), path: path}
+	if !stat.IsDir() {
+		o.Size = stat.Size()
+	}
+
+	if data, err := os.ReadFile(s.metaPath(bucket, key)); err == nil {
+		_ = json.Unmarshal(data, &o.Info)
+	}
+
+	if o.ContentType == "" {
+		o.ContentType = mime.TypeByExtension(filepath.Ext(key))
+	}
+	if o.ContentType == "" {
+		o.ContentType = "application/octet-stream"
+	}
+
+	if o.ETag == "" {
+		if o.ETag, err = fileMD5(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// fileMD5 returns the hex MD5 of a file, or of nothing for a folder.
+func fileMD5(path string) (string, error) {
+	hash := md5.New()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && !info.IsDir() {
+		if _, err := io.Copy(hash, f); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Copy stores a copy of an object. Without info the copy keeps the info of
+// the source.
+func (s *Store) Copy(srcBucket, srcKey, bucket, key string, info *Info) (*Object, error) {
+	src, err := s.Head(srcBucket, srcKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if info == nil {
+		info = &src.Info
+	}
+
+	f, err := src.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return s.Put(bucket, key, f, *info)
+}
+
+// Delete deletes an object. Deleting one that does not exist does nothing.
+// Folders left empty are removed.
+func (s *Store) Delete(bucket, key string) error {
+	path, err := s.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if stat, err := os.Stat(path); err != nil || stat.IsDir() != strings.HasSuffix(key, "/") {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		// a folder that still has objects stays
+		if strings.HasSuffix(key, "/") {
+			return nil
+		}
+		return err
+	}
+
+	_ = os.Remove(s.metaPath(bucket, key))
+
+	// remove the folders the object was the last one in, up to the bucket
+	root, _ := s.existingBucket(bucket)
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// ListQuery filters the objects of a bucket like ListObjectsV2.
+type ListQuery struct {
+	Prefix     string
+	Delimiter  string
+	StartAfter string // lists keys after this one
+	MaxKeys    int    // defaults to 1000
+}
+
+// ListResult is a page of the objects of a bucket.
+type ListResult struct {
+	Objects        []*Object
+	CommonPrefixes []string
+
+	// Truncated is set when there is more to list after NextStartAfter.
+	Truncated      bool
+	NextStartAfter string
+}
+
+// List lists the objects of a bucket by key, rolling keys up to the next
+// Delimiter after Prefix into CommonPrefixes.
+func (s *Store) List(bucket string, q ListQuery) (*ListResult, error) {
+	root, err := s.existingBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.MaxKeys <= 0 || q.MaxKeys > 1000 {
+		q.MaxKeys = 1000
+	}
+
+	var keys []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+
+		key := filepath.ToSlash(path[len(root)+1:])
+
+		if d.IsDir() {
+			// only empty folders are objects of their own
+			if entries, err := os.ReadDir(path); err == nil && len(entries) == 0 {
+				keys = append(keys, key+"/")
+			}
+			return nil
+		}
+
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(keys)
+
+	res := &ListResult{Objects: []*Object{}, CommonPrefixes: []string{}}
+	count := 0
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, q.Prefix) || key <= q.StartAfter {
+			continue
+		}
+
+		var prefix string
+		if q.Delimiter != "" {
+			if i := strings.Index(key[len(q.Prefix):], q.Delimiter); i >= 0 {
+				prefix = key[:len(q.Prefix)+i+len(q.Delimiter)]
+			}
+		}
+
+		// a prefix is listed once, continuing after it skips its keys
+		if prefix != "" && (prefix <= q.StartAfter || slices.Contains(res.CommonPrefixes, prefix)) {
+			continue
+		}
+
+		if count == q.MaxKeys {
+			res.Truncated = true
+			break
+		}
+		count++
+
+		if prefix != "" {
+			res.CommonPrefixes = append(res.CommonPrefixes, prefix)
+			res.NextStartAfter = prefix + string(rune(0x10FFFF))
+			continue
+		}
+
+		o, err := s.Head(bucket, key)
+		if err != nil {
+			continue
+		}
+
+		res.Objects = append(res.Objects, o)
+		res.NextStartAfter = key
+	}
+
+	return res, nil
+}
+
+// upload is stored with the parts of a multipart upload.
+type upload struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Info   Info   `json:"info"`
+}
+
+// Part names a part of a multipart upload when completing it.
+type Part struct {
+	Number int
+	ETag   string
+}
+
+// uploadPath is the folder holding the parts of an upload.
+func (s *Store) uploadPath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", ErrNoSuchUpload
+	}
+
+	dir := filepath.Join(s.Dir, stateDir, "uploads", id)
+	if _, err := os.Stat(dir); err != nil {
+		return "", ErrNoSuchUpload
+	}
+
+	return dir, nil
+}
+
+// CreateUpload starts a multipart upload of an object, returning its id.
+func (s *Store) CreateUpload(bucket, key string, info Info) (string, error) {
+	if _, err := s.objectPath(bucket, key); err != nil {
+		return "", err
+	}
+
+	id := rand.Text()
+	dir := filepath.Join(s.Dir, stateDir, "uploads", id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(upload{Bucket: bucket, Key: key, Info: info})
+	if err != nil {
+		return "", err
+	}
+
+	return id, os.WriteFile(filepath.Join(dir, "upload.json"), data, 0644)
+}
+
+// UploadPart stores a part of a multipart upload, returning its ETag.
+// Uploading a part again replaces it.
+func (s *Store) UploadPart(id string, number int, body io.Reader) (string, error) {
+	dir, err := s.uploadPath(id)
+	if err != nil {
+		return "", err
+	}
+
+	if number < 1 || number > 10000 {
+		return "", ErrInvalidPart
+	}
+
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%05d.part", number)))
+	if err != nil {
+		return "", err
+	}
+
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), err
+}
+
+// CompleteUpload joins the listed parts, in order, into the object. Its ETag
+// is the MD5 of the parts' MD5s followed by the number of parts, like S3's.
+func (s *Store) CompleteUpload(id string, parts []Part) (*Object, error) {
+	dir, err := s.uploadPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "upload.json"))
+	if err != nil {
+		return nil, ErrNoSuchUpload
+	}
+
+	var u upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+
+	path, err := s.objectPath(u.Bucket, u.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parts) == 0 {
+		return nil, ErrInvalidPart
+	}
+
+	tmp, err := s.tempFile()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var sums []byte
+	for i, part := range parts {
+		if i > 0 && part.Number <= parts[i-1].Number {
+			return nil, ErrInvalidPartOrder
+		}
+
+		sum, err := appendPart(tmp, filepath.Join(dir, fmt.Sprintf("%05d.part", part.Number)))
+		if err != nil || hex.EncodeToString(sum) != strings.Trim(part.ETag, `"`) {
+			return nil, ErrInvalidPart
+		}
+
+		sums = append(sums, sum...)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	u.Info.ETag = fmt.Sprintf("%x-%d", md5.Sum(sums), len(parts))
+
+	if err := s.place(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	_ = os.RemoveAll(dir)
+
+	return s.finish(u.Bucket, u.Key, path, u.Info)
+}
+
+// appendPart copies a part to w, returning its MD5.
+func appendPart(w io.Writer, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), f); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// AbortUpload drops a multipart upload and its parts.
+func (s *Store) AbortUpload(id string) error {
+	dir, err := s.uploadPath(id)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,146 @@
+package s3_store
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjects(t *testing.T) {
+	s := New(t.TempDir())
+
+	_, err := s.Put("uploads", "a.txt", strings.NewReader("hi"), Info{})
+	assert.ErrorIs(t, err, ErrNoSuchBucket)
+	assert.ErrorIs(t, s.CreateBucket("Uploads"), ErrInvalidBucketName)
+
+	require.Nil(t, s.CreateBucket("uploads"))
+	require.Nil(t, s.CreateBucket("uploads"), "creating a bucket again")
+
+	o, err := s.Put("uploads", "docs/a.txt", strings.NewReader("hello"), Info{Metadata: map[string]string{"owner": "ada"}})
+	require.Nil(t, err, "error putting object")
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", o.ETag)
+	assert.Equal(t, int64(5), o.Size)
+	assert.Equal(t, "ada", o.Metadata["owner"])
+	assert.True(t, strings.HasPrefix(o.ContentType, "text/plain"), "content type from the extension")
+	assert.FileExists(t, filepath.Join(s.Dir, "uploads", "docs", "a.txt"), "objects are files")
+
+	f, err := o.Open()
+	require.Nil(t, err)
+	content, _ := io.ReadAll(f)
+	f.Close()
+	assert.Equal(t, "hello", string(content))
+
+	// files put in the folder by hand are objects too
+	require.Nil(t, os.WriteFile(filepath.Join(s.Dir, "uploads", "seed.json"), []byte("{}"), 0644))
+	o, err = s.Head("uploads", "seed.json")
+	require.Nil(t, err, "error reading seeded object")
+	assert.Equal(t, "application/json", o.ContentType)
+	assert.Equal(t, "99914b932bd37a50b983c5e7c90ae93b", o.ETag)
+
+	_, err = s.Head("uploads", "docs")
+	assert.ErrorIs(t, err, ErrNoSuchKey, "a folder is not an object")
+	_, err = s.Head("uploads", "../secret")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	copied, err := s.Copy("uploads", "docs/a.txt", "uploads", "docs/b.txt", nil)
+	require.Nil(t, err, "error copying")
+	assert.Equal(t, "ada", copied.Metadata["owner"], "copy keeps the info")
+
+	assert.ErrorIs(t, s.DeleteBucket("uploads"), ErrBucketNotEmpty)
+
+	require.Nil(t, s.Delete("uploads", "docs/a.txt"))
+	require.Nil(t, s.Delete("uploads", "docs/b.txt"))
+	require.Nil(t, s.Delete("uploads", "missing"), "deleting a missing object")
+	assert.NoDirExists(t, filepath.Join(s.Dir, "uploads", "docs"), "empty folders are removed")
+
+	require.Nil(t, s.Delete("uploads", "seed.json"))
+	require.Nil(t, s.DeleteBucket("uploads"))
+
+	buckets, err := s.Buckets()
+	require.Nil(t, err)
+	assert.Empty(t, buckets)
+}
+
+func TestList(t *testing.T) {
+	s := New(t.TempDir())
+	require.Nil(t, s.CreateBucket("photos"))
+
+	for _, key := range []string{"2024/jan/a.jpg", "2024/jan/b.jpg", "2024/feb/c.jpg", "2025/d.jpg", "index.html", "empty/"} {
+		_, err := s.Put("photos", key, strings.NewReader(key), Info{})
+		require.Nil(t, err, "error putting %s", key)
+	}
+
+	keys := func(res *ListResult) []string {
+		var list []string
+		for _, o := range res.Objects {
+			list = append(list, o.Key)
+		}
+		return list
+	}
+
+	res, err := s.List("photos", ListQuery{})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"2024/feb/c.jpg", "2024/jan/a.jpg", "2024/jan/b.jpg", "2025/d.jpg", "empty/", "index.html"}, keys(res))
+
+	res, _ = s.List("photos", ListQuery{Prefix: "2024/", Delimiter: "/"})
+	assert.Empty(t, res.Objects)
+	assert.Equal(t, []string{"2024/feb/", "2024/jan/"}, res.CommonPrefixes)
+
+	res, _ = s.List("photos", ListQuery{Delimiter: "/"})
+	assert.Equal(t, []string{"index.html"}, keys(res))
+	assert.Equal(t, []string{"2024/", "2025/", "empty/"}, res.CommonPrefixes)
+
+	// page through two at a time
+	var pages [][]string
+	q := ListQuery{Delimiter: "/", MaxKeys: 2}
+	for {
+		res, err := s.List("photos", q)
+		require.Nil(t, err)
+		pages = append(pages, append(res.CommonPrefixes, keys(res)...))
+		if !res.Truncated {
+			break
+		}
+		q.StartAfter = res.NextStartAfter
+	}
+	assert.Equal(t, [][]string{{"2024/", "2025/"}, {"empty/", "index.html"}}, pages)
+
+	_, err = s.List("missing", ListQuery{})
+	assert.ErrorIs(t, err, ErrNoSuchBucket)
+}
+
+func TestMultipartUpload(t *testing.T) {
+	s := New(t.TempDir())
+	require.Nil(t, s.CreateBucket("backups"))
+
+	id, err := s.CreateUpload("backups", "db.dump", Info{ContentType: "application/x-dump"})
+	require.Nil(t, err, "error creating upload")
+
+	first, err := s.UploadPart(id, 1, strings.NewReader("hello "))
+	require.Nil(t, err)
+	second, err := s.UploadPart(id, 2, strings.NewReader("world"))
+	require.Nil(t, err)
+
+	_, err = s.CompleteUpload(id, []Part{{2, second}, {1, first}})
+	assert.ErrorIs(t, err, ErrInvalidPartOrder)
+	_, err = s.CompleteUpload(id, []Part{{1, first}, {2, "nope"}})
+	assert.ErrorIs(t, err, ErrInvalidPart)
+
+	o, err := s.CompleteUpload(id, []Part{{1, `"` + first + `"`}, {2, second}})
+	require.Nil(t, err, "error completing upload")
+	assert.Equal(t, int64(11), o.Size)
+	assert.Equal(t, "application/x-dump", o.ContentType)
+	assert.True(t, strings.HasSuffix(o.ETag, "-2"), "multipart etag")
+
+	_, err = s.UploadPart(id, 3, strings.NewReader("late"))
+	assert.ErrorIs(t, err, ErrNoSuchUpload, "completed upload is dropped")
+
+	id, err = s.CreateUpload("backups", "other", Info{})
+	require.Nil(t, err)
+	require.Nil(t, s.AbortUpload(id))
+	assert.ErrorIs(t, s.AbortUpload(id), ErrNoSuchUpload)
+}
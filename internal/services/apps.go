@@ -14,11 +14,6 @@ import (
 
 // StartApp executes a service and manages it's lifecycle.
 func StartApp(svc Service, ctx *app.Context) {
-	if svc.Skip {
-		ctx.PublishInfo("skipping %s", svc.Name)
-		return
-	}
-
 	ctx.PublishInfo("starting service %s:%d", svc.Name, svc.Port)
 	svc.Exec = strings.ReplaceAll(svc.Exec, "{port}", fmt.Sprintf("%d", svc.Port))
 
@@ -43,17 +38,19 @@ func StartApp(svc Service, ctx *app.Context) {
 		ctx.PublishServiceOnline(svc.Name)
 	}
 
-	go func(ctx *app.Context) {
-		<-ctx.Done()
+	// wait for termination
+	<-ctx.Done()
 
-		ctx.PublishServiceOffline(svc.Name)
-		ctx.PublishInfo("stopping service %s", svc.Name)
+	ctx.PublishServiceOffline(svc.Name)
+	ctx.PublishInfo("stopping service %s", svc.Name)
 
-		if err := e.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
-			ctx.PublishServiceError(svc.Name)
-			ctx.PublishError("error killing process %s: %s", svc.Name, err)
-		}
-	}(ctx)
+	if err := e.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("error killing process %s: %s", svc.Name, err)
+	}
+
+	// release the process so its port is free for a restart
+	_ = e.Wait()
 }
 
 func capture(r io.ReadCloser, svc Service, publish func(msg string, args ...any), errStatus func(name string)) {
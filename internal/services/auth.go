@@ -0,0 +1,256 @@
+package services
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/crit/fake-ops/internal/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// claimsKey is set on the gin.Context to the claims of an authorized request.
+const claimsKey = "fake-ops.claims"
+
+// DefaultJWKSPath is where a service requiring bearer tokens publishes the
+// keys that verify them.
+const DefaultJWKSPath = "/.well-known/jwks.json"
+
+// AuthConfig is parsed from the auth section of a service yaml file. Requests
+// must pass one of the configured schemes.
+type AuthConfig struct {
+	APIKey *APIKeyAuth `yaml:"apiKey"`
+	Basic  *BasicAuth  `yaml:"basic"`
+	Bearer *BearerAuth `yaml:"bearer"`
+
+	// Public lists paths that need no credentials. A trailing * matches any
+	// path starting with what comes before it.
+	Public []string `yaml:"public"`
+
+	// Unauthorized answers requests without valid credentials.
+	Unauthorized AuthResponse `yaml:"unauthorized"`
+
+	// Forbidden answers requests with valid credentials that lack a required
+	// scope.
+	Forbidden AuthResponse `yaml:"forbidden"`
+}
+
+// APIKeyAuth accepts requests sending one of Keys in a header or query
+// parameter.
+type APIKeyAuth struct {
+	Header string   `yaml:"header"`
+	Query  string   `yaml:"query"`
+	Keys   []string `yaml:"keys"`
+}
+
+// BasicAuth accepts requests using HTTP basic auth with one of Users, a map of
+// user name to password.
+type BasicAuth struct {
+	Users map[string]string `yaml:"users"`
+}
+
+// BearerAuth accepts requests with a JWT signed by the key fake-ops generates.
+type BearerAuth struct {
+	Issuer   string   `yaml:"issuer"`
+	Audience string   `yaml:"audience"`
+	Scopes   []string `yaml:"scopes"`
+	JWKS     string   `yaml:"jwks"`
+}
+
+// AuthResponse is sent to rejected requests.
+type AuthResponse struct {
+	Status      int    `yaml:"status"`
+	ContentType string `yaml:"contentType"`
+	Body        string `yaml:"body"`
+}
+
+// authResult is the outcome of checking a request's credentials.
+type authResult int
+
+const (
+	authUnauthorized authResult = iota
+	authForbidden
+	authOK
+)
+
+// jwksPath is where the service publishes its JWKS.
+func (a *AuthConfig) jwksPath() string {
+	if a.Bearer == nil {
+		return ""
+	}
+
+	if a.Bearer.JWKS != "" {
+		return a.Bearer.JWKS
+	}
+
+	return DefaultJWKSPath
+}
+
+// authenticate is gin middleware rejecting requests without the credentials
+// the service requires. key verifies bearer tokens.
+func authenticate(name string, a *AuthConfig, key *jwt.Key) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if path == a.jwksPath() || a.public(path) {
+			c.Next()
+			return
+		}
+
+		result, claims := a.check(c.Request, key)
+
+		switch result {
+		case authOK:
+			if claims != nil {
+				c.Set(claimsKey, claims)
+			}
+			c.Next()
+
+		case authForbidden:
+			c.Set(sourceKey, sourceFake)
+			a.Forbidden.write(c, http.StatusForbidden, `{"error": "forbidden"}`)
+
+		default:
+			for _, challenge := range a.challenges(name) {
+				c.Writer.Header().Add("WWW-Authenticate", challenge)
+			}
+
+			c.Set(sourceKey, sourceFake)
+			a.Unauthorized.write(c, http.StatusUnauthorized, `{"error": "unauthorized"}`)
+		}
+	}
+}
+
+// public reports whether path needs no credentials.
+func (a *AuthConfig) public(path string) bool {
+	for _, p := range a.Public {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if p == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check tries every configured scheme, returning the best outcome.
+func (a *AuthConfig) check(r *http.Request, key *jwt.Key) (authResult, jwt.Claims) {
+	best := authUnauthorized
+
+	if a.Bearer != nil {
+		result, claims := a.Bearer.check(r, key)
+		if result == authOK {
+			return result, claims
+		}
+		best = max(best, result)
+	}
+
+	if a.Basic != nil {
+		if user, ok := a.Basic.check(r); ok {
+			return authOK, jwt.Claims{"sub": user}
+		}
+	}
+
+	if a.APIKey != nil && a.APIKey.check(r) {
+		return authOK, nil
+	}
+
+	return best, nil
+}
+
+// challenges are the WWW-Authenticate values for the configured schemes.
+func (a *AuthConfig) challenges(realm string) []string {
+	var list []string
+
+	if a.Bearer != nil {
+		list = append(list, `Bearer realm="`+realm+`"`)
+	}
+
+	if a.Basic != nil {
+		list = append(list, `Basic realm="`+realm+`"`)
+	}
+
+	return list
+}
+
+func (b *BearerAuth) check(r *http.Request, key *jwt.Key) (authResult, jwt.Claims) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || key == nil {
+		return authUnauthorized, nil
+	}
+
+	claims, err := key.Verify(strings.TrimSpace(token))
+	if err != nil {
+		return authUnauthorized, nil
+	}
+
+	if b.Issuer != "" && claims["iss"] != b.Issuer {
+		return authUnauthorized, nil
+	}
+
+	if b.Audience != "" && !slices.Contains(claims.Strings("aud"), b.Audience) {
+		return authUnauthorized, nil
+	}
+
+	scopes := append(claims.Strings("scope"), claims.Strings("scp")...)
+	for _, scope := range b.Scopes {
+		if !slices.Contains(scopes, scope) {
+			return authForbidden, claims
+		}
+	}
+
+	return authOK, claims
+}
+
+func (b *BasicAuth) check(r *http.Request) (string, bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+
+	want, ok := b.Users[user]
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(want)) != 1 {
+		return "", false
+	}
+
+	return user, true
+}
+
+func (k *APIKeyAuth) check(r *http.Request) bool {
+	header := k.Header
+	if header == "" && k.Query == "" {
+		header = "X-API-Key"
+	}
+
+	var sent string
+	if header != "" {
+		sent = r.Header.Get(header)
+	}
+	if sent == "" && k.Query != "" {
+		sent = r.URL.Query().Get(k.Query)
+	}
+
+	return sent != "" && slices.Contains(k.Keys, sent)
+}
+
+// write sends the response, falling back to the status and JSON body given.
+func (resp AuthResponse) write(c *gin.Context, status int, body string) {
+	if resp.Status != 0 {
+		status = resp.Status
+	}
+
+	if resp.Body != "" {
+		body = resp.Body
+	}
+
+	contentType := resp.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	c.Data(status, contentType, []byte(body))
+	c.Abort()
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/dns_zone"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxUDPSize is the largest answer sent over UDP, larger ones are truncated
+// so the client asks again over TCP.
+const maxUDPSize = 512
+
+// StartDNS runs a DNS server answering from the service's zone file and with
+// records for every running service. Nothing is forwarded, names it does not
+// know are not resolved.
+func StartDNS(svc Service, ctx *app.Context) {
+	var config dns_zone.Config
+	if svc.DNS != nil {
+		config = *svc.DNS
+	}
+
+	if config.Domain == "" {
+		config.Domain = dns_zone.DefaultDomain
+	}
+
+	if config.TTL == 0 {
+		config.TTL = dns_zone.DefaultTTL
+	}
+
+	if len(config.Addresses) == 0 {
+		config.Addresses = []string{"127.0.0.1", "::1"}
+	}
+
+	var addresses []net.IP
+	for _, a := range config.Addresses {
+		ip := net.ParseIP(a)
+		if ip == nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("invalid address %s for service %s", a, svc.Name)
+			return
+		}
+		addresses = append(addresses, ip)
+	}
+
+	// without a zone the service's own zone file is used when there is one
+	zoneFile, explicit := config.Zone, config.Zone != ""
+	if !explicit {
+		zoneFile = svc.Name + dns_zone.Extension
+	}
+	if !filepath.IsAbs(zoneFile) {
+		zoneFile = filepath.Join(ctx.Flags.Services, zoneFile)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("failed to create watcher for service %s: %s", svc.Name, err)
+		return
+	}
+	defer watcher.Close()
+
+	// the services directory holds the zone file and the services named in it
+	for _, dir := range []string{ctx.Flags.Services, filepath.Dir(zoneFile)} {
+		if err := watcher.Add(dir); err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to watch directory %s: %s", dir, err)
+		}
+	}
+
+	var mu sync.Mutex // guards reloads
+	var zone atomic.Pointer[dns_zone.Zone]
+	var others atomic.Pointer[[]Service]
+
+	var bmu sync.Mutex // guards builds
+	var served atomic.Pointer[dns_zone.Zone]
+	failed := make(map[string]bool) // services already reported without records
+
+	// build makes up the records of the services running right now on top of
+	// the zone, for lookups to answer from until the next build.
+	build := func() {
+		bmu.Lock()
+		defer bmu.Unlock()
+
+		// nothing to build on before the first load
+		if zone.Load() == nil || others.Load() == nil {
+			return
+		}
+
+		z := zone.Load().Clone()
+
+		for _, other := range *others.Load() {
+			if status := ctx.Status(other.Name); status != "online" && status != "error" {
+				continue
+			}
+
+			// the zone file wins over the records made up for a service
+			if z.Has(other.Name + "." + z.Origin) {
+				continue
+			}
+
+			network := "tcp"
+			if other.Type == ServiceUDP || other.Type == ServiceDNS {
+				network = "udp"
+			}
+
+			if err := z.AddService(other.Name, string(other.Type), network, other.Port, addresses, config.TTL); err != nil {
+				if !failed[other.Name] {
+					ctx.PublishError("%s: no records for service %s: %s", svc.Name, other.Name, err)
+				}
+				failed[other.Name] = true
+				continue
+			}
+			delete(failed, other.Name)
+		}
+
+		served.Store(z)
+	}
+
+	// reload reads the zone file and the services again. A zone file that
+	// fails to parse keeps the previous zone.
+	reload := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		healthy := true
+		problem := func(format string, args ...any) {
+			healthy = false
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError(format, args...)
+		}
+
+		data, err := os.ReadFile(zoneFile)
+		switch {
+		case errors.Is(err, os.ErrNotExist) && !explicit:
+			svc.Files = nil
+			zone.Store(dns_zone.New(config.Domain))
+		case err != nil:
+			problem("failed to read file %s: %s", zoneFile, err)
+		default:
+			svc.Files = []string{zoneFile}
+
+			z, err := dns_zone.Parse(data, config.Domain, config.TTL)
+			if err != nil {
+				problem("failed to parse file %s, keeping the previous zone: %s", zoneFile, err)
+				break
+			}
+			zone.Store(z)
+		}
+
+		list, err := List(ctx)
+		if err != nil {
+			problem("failed to list services for service %s: %s", svc.Name, err)
+		} else {
+			// ports can be changed by the active scenario
+			scenario, err := LoadScenario(ctx.Flags.Results, ctx.Scenario())
+			if err != nil {
+				problem("failed to load scenario: %s", err)
+				scenario = &Scenario{}
+			}
+
+			for i := range list {
+				list[i], _ = scenario.Apply(list[i])
+			}
+			others.Store(&list)
+		}
+
+		// nothing to answer with when the first load fails
+		zone.CompareAndSwap(nil, dns_zone.New(config.Domain))
+		others.CompareAndSwap(nil, &[]Service{})
+
+		build()
+
+		if healthy {
+			ctx.PublishServiceOnline(svc.Name)
+		}
+	}
+
+	// services coming and going change the records made up for them
+	stopStatus := ctx.OnStatus(func(string, string) { build() })
+	defer stopStatus()
+
+	reload()
+
+	lookup := func(name string, t dnsmessage.Type) ([]dnsmessage.Resource, dnsmessage.RCode) {
+		return served.Load().Lookup(name, t)
+	}
+
+	var closers []io.Closer
+	for _, address := range listenAddresses(svc) {
+		udp, err := serveDNSUDP(ctx, svc, address, lookup)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("server error: %s", err)
+			continue
+		}
+		closers = append(closers, udp)
+
+		tcp, err := serveDNSTCP(ctx, svc, address, lookup)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("server error: %s", err)
+			continue
+		}
+		closers = append(closers, tcp)
+
+		ctx.PublishInfo("starting service %s on %s (dns)", svc.Name, address)
+	}
+
+	go watchChanges(ctx, svc.Name, watcher, func() {
+		reload()
+		ctx.PublishInfo("reloaded service %s", svc.Name)
+	})
+
+	// wait for termination
+	<-ctx.Done()
+
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	for _, c := range closers {
+		_ = c.Close()
+	}
+
+	ctx.PublishServiceOffline(svc.Name)
+}
+
+// dnsLookup answers a question with its records and response code.
+type dnsLookup func(name string, t dnsmessage.Type) ([]dnsmessage.Resource, dnsmessage.RCode)
+
+// answerDNS answers a query, logging the question. It reports false when the
+// query cannot be answered at all.
+func answerDNS(ctx *app.Context, svc Service, lookup dnsLookup, query []byte, udp bool) ([]byte, bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, false
+	}
+
+	res := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               h.ID,
+			Response:         true,
+			OpCode:           h.OpCode,
+			Authoritative:    true,
+			RecursionDesired: h.RecursionDesired,
+		},
+	}
+
+	q, err := p.Question()
+	switch {
+	case err != nil:
+		res.RCode = dnsmessage.RCodeFormatError
+	case h.OpCode != 0:
+		res.RCode = dnsmessage.RCodeNotImplemented
+	default:
+		res.Questions = []dnsmessage.Question{q}
+		res.Answers, res.RCode = lookup(q.Name.String(), q.Type)
+
+		kind := strings.TrimPrefix(q.Type.String(), "Type")
+
+		switch {
+		case len(res.Answers) > 0:
+			values := make([]string, 0, len(res.Answers))
+			for _, a := range res.Answers {
+				values = append(values, dns_zone.Value(a.Body))
+			}
+			ctx.PublishFake("%s: %s %s %s", svc.Name, kind, q.Name, strings.Join(values, ", "))
+		case res.RCode == dnsmessage.RCodeSuccess:
+			ctx.PublishInfo("%s: %s %s no records", svc.Name, kind, q.Name)
+		case res.RCode == dnsmessage.RCodeNameError:
+			ctx.PublishInfo("%s: %s %s unmatched NXDOMAIN", svc.Name, kind, q.Name)
+		default:
+			ctx.PublishInfo("%s: %s %s unmatched REFUSED", svc.Name, kind, q.Name)
+		}
+	}
+
+	data, err := res.Pack()
+	if err != nil {
+		ctx.PublishError("%s: failed to answer %s: %s", svc.Name, q.Name, err)
+		return nil, false
+	}
+
+	if udp && len(data) > maxUDPSize {
+		res.Truncated, res.Answers = true, nil
+		if data, err = res.Pack(); err != nil {
+			return nil, false
+		}
+	}
+
+	return data, true
+}
+
+// serveDNSUDP answers queries sent as datagrams on address.
+func serveDNSUDP(ctx *app.Context, svc Service, address string, lookup dnsLookup) (io.Closer, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		buf := make([]byte, 65535)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					ctx.PublishServiceError(svc.Name)
+					ctx.PublishError("server error: %s", err)
+				}
+				return
+			}
+
+			if data, ok := answerDNS(ctx, svc, lookup, buf[:n], true); ok {
+				_, _ = conn.WriteTo(data, addr)
+			}
+		}
+	}()
+
+	return conn, nil
+}
+
+// serveDNSTCP answers queries sent over connections on address, each
+// prefixed with its length.
+func serveDNSTCP(ctx *app.Context, svc Service, address string, lookup dnsLookup) (io.Closer, error) {
+	l, err := listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					ctx.PublishServiceError(svc.Name)
+					ctx.PublishError("server error: %s", err)
+				}
+				return
+			}
+
+			// stop with the service
+			stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+
+			go func() {
+				defer stop()
+				defer conn.Close()
+
+				for {
+					var size uint16
+					if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+						return
+					}
+
+					query := make([]byte, size)
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+
+					data, ok := answerDNS(ctx, svc, lookup, query, false)
+					if !ok {
+						return
+					}
+
+					if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(data)))); err != nil {
+						return
+					}
+					if _, err := conn.Write(data); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return l, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestAnswerDNS(t *testing.T) {
+	ctx, cancel := app.NewContext(func(tea.Msg) {})
+	defer cancel()
+
+	svc := Service{Name: "dns", Type: ServiceDNS}
+
+	// records returns a lookup answering with n A records
+	records := func(n int) dnsLookup {
+		return func(name string, t dnsmessage.Type) ([]dnsmessage.Resource, dnsmessage.RCode) {
+			var answers []dnsmessage.Resource
+			for i := range n {
+				answers = append(answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, byte(i)}},
+				})
+			}
+			return answers, dnsmessage.RCodeSuccess
+		}
+	}
+
+	query := func(opCode dnsmessage.OpCode) []byte {
+		q := dnsmessage.Message{
+			Header: dnsmessage.Header{ID: 7, OpCode: opCode, RecursionDesired: true},
+			Questions: []dnsmessage.Question{{
+				Name:  dnsmessage.MustNewName("payments.internal."),
+				Type:  dnsmessage.TypeA,
+				Class: dnsmessage.ClassINET,
+			}},
+		}
+		data, err := q.Pack()
+		require.Nil(t, err, "error packing query")
+		return data
+	}
+
+	tests := map[string]struct {
+		lookup    dnsLookup
+		query     []byte
+		udp       bool
+		answers   int
+		truncated bool
+		rcode     dnsmessage.RCode
+	}{
+		"udp":              {lookup: records(2), query: query(0), udp: true, answers: 2},
+		"udp too large":    {lookup: records(40), query: query(0), udp: true, truncated: true},
+		"tcp large":        {lookup: records(40), query: query(0), answers: 40},
+		"unsupported code": {lookup: records(2), query: query(2), udp: true, rcode: dnsmessage.RCodeNotImplemented},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, ok := answerDNS(ctx, svc, tc.lookup, tc.query, tc.udp)
+			require.True(t, ok)
+
+			if tc.udp {
+				assert.LessOrEqual(t, len(data), maxUDPSize)
+			}
+
+			var res dnsmessage.Message
+			require.Nil(t, res.Unpack(data), "error unpacking answer")
+
+			assert.Equal(t, uint16(7), res.Header.ID)
+			assert.True(t, res.Header.Response)
+			assert.Equal(t, tc.truncated, res.Header.Truncated)
+			assert.Equal(t, tc.rcode, res.Header.RCode)
+			assert.Len(t, res.Answers, tc.answers)
+		})
+	}
+
+	_, ok := answerDNS(ctx, svc, records(1), []byte{1, 2, 3}, true)
+	assert.False(t, ok, "malformed query")
+}
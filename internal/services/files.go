@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/http_results"
+	"github.com/fsnotify/fsnotify"
+)
+
+// responseFiles lists the response files in dir and every folder below it,
+// calling watch with each folder so files added later are noticed.
+func responseFiles(dir string, watch func(dir string)) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != dir && hidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			watch(path)
+			return nil
+		}
+
+		if d.Name() != http_results.FolderFile {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// watchChanges calls reload once a burst of events from watcher has passed,
+// until the watcher is closed.
+func watchChanges(ctx *app.Context, name string, watcher *fsnotify.Watcher, reload func()) {
+	var timer *time.Timer // debounce timer
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			// Chmod alone changes nothing served
+			if event.Op == fsnotify.Chmod || hidden(filepath.Base(event.Name)) {
+				continue
+			}
+
+			if timer != nil {
+				timer.Stop()
+			}
+
+			// Rescan once the burst of events has passed, which also watches
+			// new folders and forgets deleted files
+			timer = time.AfterFunc(300*time.Millisecond, func() {
+				// The service may have stopped while waiting
+				if ctx.Err() != nil {
+					return
+				}
+
+				reload()
+			})
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			ctx.PublishServiceError(name)
+			ctx.PublishError("file watcher error: %s", err)
+		}
+	}
+}
+
+// hidden reports whether a file or folder is left alone, like dot files and
+// the backups and swap files of editors.
+func hidden(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~")
+}
+
+// folders reads the folder files of a reload, reporting each one that fails
+// once.
+type folders struct {
+	read    map[string]http_results.Folder
+	onError func(file string, err error)
+}
+
+func newFolders(onError func(file string, err error)) *folders {
+	return &folders{read: make(map[string]http_results.Folder), onError: onError}
+}
+
+// of returns the settings of the folder file in dir, if it has one.
+func (f *folders) of(dir string) http_results.Folder {
+	if folder, ok := f.read[dir]; ok {
+		return folder
+	}
+
+	file := filepath.Join(dir, http_results.FolderFile)
+
+	var folder http_results.Folder
+	data, err := os.ReadFile(file)
+	if err == nil {
+		folder, err = http_results.ParseFolder(data)
+	}
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		f.onError(file, err)
+		folder = http_results.Folder{}
+	}
+
+	f.read[dir] = folder
+	return folder
+}
+
+// defaults returns the settings for response files in the folder rel below
+// roots. Each folder inherits from the one it is in. A folder in a later root,
+// like a scenario, overrides the same folder in the earlier ones.
+func (f *folders) defaults(roots []string, rel string) http_results.Folder {
+	levels := []string{"."}
+	if rel != "." {
+		parts := strings.Split(rel, string(filepath.Separator))
+		for i := range parts {
+			levels = append(levels, filepath.Join(parts[:i+1]...))
+		}
+	}
+
+	var merged http_results.Folder
+	for _, level := range levels {
+		var own http_results.Folder
+		for _, root := range roots {
+			over := f.of(filepath.Join(root, level))
+			if over.Prefix != "" {
+				own.Prefix = ""
+			}
+			own = over.Inherit(own)
+		}
+
+		merged = own.Inherit(merged)
+	}
+
+	return merged
+}
+
+// loadedFile is the last version of a response file that parsed.
+type loadedFile struct {
+	result *http_results.Result
+	data   []byte
+}
+
+// routeChanges are the differences between two route tables.
+type routeChanges struct {
+	added, changed, removed []string
+}
+
+// diffRoutes compares the results served before and after a reload. Results
+// from files in modified are changed.
+func diffRoutes(root string, before, after []*http_results.Result, modified map[string]bool) routeChanges {
+	label := func(r *http_results.Result) string {
+		file, err := filepath.Rel(root, r.File)
+		if err != nil {
+			file = r.File
+		}
+
+		return fmt.Sprintf("%s %s (%s)", r.Method, r.Path, file)
+	}
+
+	var changes routeChanges
+
+	old := make(map[string]bool, len(before))
+	for _, r := range before {
+		old[label(r)] = true
+	}
+
+	for _, r := range after {
+		switch l := label(r); {
+		case !old[l]:
+			changes.added = append(changes.added, l)
+		case modified[r.File]:
+			changes.changed = append(changes.changed, l)
+		}
+
+		delete(old, label(r))
+	}
+
+	for _, r := range before {
+		if old[label(r)] {
+			changes.removed = append(changes.removed, label(r))
+		}
+	}
+
+	return changes
+}
+
+// publish logs every changed route and a summary.
+func (c routeChanges) publish(ctx *app.Context, name string) {
+	for _, route := range c.added {
+		ctx.PublishInfo("%s: added route %s", name, route)
+	}
+
+	for _, route := range c.changed {
+		ctx.PublishInfo("%s: changed route %s", name, route)
+	}
+
+	for _, route := range c.removed {
+		ctx.PublishInfo("%s: removed route %s", name, route)
+	}
+
+	ctx.PublishInfo("reloaded service %s: %d added, %d changed, %d removed", name, len(c.added), len(c.changed), len(c.removed))
+}
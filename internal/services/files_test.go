@@ -0,0 +1,108 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crit/fake-ops/internal/http_results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffRoutes(t *testing.T) {
+	users := &http_results.Result{Method: "GET", Path: "/users", File: "/results/users.txt"}
+	user := &http_results.Result{Method: "GET", Path: "/users/:id", File: "/results/user.txt"}
+	create := &http_results.Result{Method: "POST", Path: "/users", File: "/results/create.txt"}
+	moved := &http_results.Result{Method: "GET", Path: "/people", File: "/results/users.txt"}
+
+	tests := map[string]struct {
+		before, after []*http_results.Result
+		modified      map[string]bool
+		want          routeChanges
+	}{
+		"unchanged": {
+			before: []*http_results.Result{users, user},
+			after:  []*http_results.Result{users, user},
+		},
+		"added": {
+			before: []*http_results.Result{users},
+			after:  []*http_results.Result{users, create},
+			want:   routeChanges{added: []string{"POST /users (create.txt)"}},
+		},
+		"removed": {
+			before: []*http_results.Result{users, user},
+			after:  []*http_results.Result{users},
+			want:   routeChanges{removed: []string{"GET /users/:id (user.txt)"}},
+		},
+		"modified file": {
+			before:   []*http_results.Result{users, user},
+			after:    []*http_results.Result{users, user},
+			modified: map[string]bool{"/results/user.txt": true},
+			want:     routeChanges{changed: []string{"GET /users/:id (user.txt)"}},
+		},
+		"path moved": {
+			before:   []*http_results.Result{users},
+			after:    []*http_results.Result{moved},
+			modified: map[string]bool{"/results/users.txt": true},
+			want: routeChanges{
+				added:   []string{"GET /people (users.txt)"},
+				removed: []string{"GET /users (users.txt)"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, diffRoutes("/results", tc.before, tc.after, tc.modified))
+		})
+	}
+}
+
+func TestFolderDefaults(t *testing.T) {
+	base, scenario := t.TempDir(), t.TempDir()
+
+	files := map[string]string{
+		filepath.Join(base, "_folder.yaml"):           "prefix: /api\nheaders: {x-env: base}\ndelay: 1s",
+		filepath.Join(base, "v1", "_folder.yaml"):     "prefix: /v1\ncontentType: text/plain",
+		filepath.Join(base, "v2", "_folder.yaml"):     "prefix: /v2",
+		filepath.Join(base, "broken", "_folder.yaml"): "prefix: nope",
+		filepath.Join(scenario, "v1", "_folder.yaml"): "delay: 2s\nheaders: {x-scenario: slow}",
+		filepath.Join(scenario, "v2", "_folder.yaml"): "prefix: /two",
+	}
+	for file, data := range files {
+		require.Nil(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.Nil(t, os.WriteFile(file, []byte(data), 0644))
+	}
+
+	root := http_results.Folder{Prefix: "/api", Headers: map[string]string{"x-env": "base"}, Delay: time.Second}
+	v1 := http_results.Folder{
+		Prefix:      "/api/v1",
+		Headers:     map[string]string{"x-env": "base", "x-scenario": "slow"},
+		Delay:       2 * time.Second,
+		ContentType: "text/plain",
+	}
+
+	tests := map[string]struct {
+		rel    string
+		want   http_results.Folder
+		failed []string
+	}{
+		"root":                    {rel: ".", want: root},
+		"scenario adds":           {rel: "v1", want: v1},
+		"scenario prefix wins":    {rel: "v2", want: http_results.Folder{Prefix: "/api/two", Headers: root.Headers, Delay: time.Second}},
+		"inherited without files": {rel: filepath.Join("v1", "deep"), want: v1},
+		"invalid file":            {rel: "broken", want: root, failed: []string{filepath.Join(base, "broken", "_folder.yaml")}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var failed []string
+			f := newFolders(func(file string, err error) { failed = append(failed, file) })
+
+			assert.Equal(t, tc.want, f.defaults([]string{base, scenario}, tc.rel))
+			assert.Equal(t, tc.failed, failed)
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/graphql"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// StartGraphQL runs a fake GraphQL API. The schema and the operation response
+// files are read from the service's results folder and reloaded as they
+// change.
+func StartGraphQL(svc Service, ctx *app.Context) {
+	var cfg graphql.Config
+	if svc.GraphQL != nil {
+		cfg = *svc.GraphQL
+	}
+
+	if cfg.Path == "" {
+		cfg.Path = graphql.DefaultPath
+	}
+
+	var tlsConfig *tls.Config
+	if svc.TLS != nil {
+		var err error
+		tlsConfig, err = svc.TLS.serverConfig(ctx)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to configure tls for service %s: %s", svc.Name, err)
+			return
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("failed to create watcher for service %s: %s", svc.Name, err)
+		return
+	}
+	defer watcher.Close()
+
+	watch := func(dir string) {
+		if err := watcher.Add(dir); err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to watch directory %s: %s", dir, err)
+		}
+	}
+
+	// The active scenario's operations win over the base ones
+	roots := []string{filepath.Join(ctx.Flags.Results, svc.Name)}
+	if scenario := ctx.Scenario(); scenario != "" {
+		roots = slices.Insert(roots, 0, ScenarioResultsPath(ctx.Flags.Results, scenario, svc.Name))
+	}
+
+	var mu sync.Mutex // guards reloads
+	var server atomic.Pointer[graphql.Server]
+
+	// reload reads the schema and operations again. A schema that does not
+	// load keeps the previous one serving, as does a broken operation file.
+	lastGood := make(map[string]*graphql.Operation)
+	reload := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		healthy := true
+		problem := func(format string, args ...any) {
+			healthy = false
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError(format, args...)
+		}
+
+		var files []string
+		for _, root := range roots {
+			found, err := responseFiles(root, watch)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				problem("failed to read directory %s: %s", root, err)
+			}
+
+			files = append(files, found...)
+		}
+
+		var sources []*ast.Source
+		var operations []*graphql.Operation
+		current := make(map[string]*graphql.Operation)
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				problem("failed to read file %s: %s", file, err)
+				continue
+			}
+
+			if slices.Contains(graphql.SchemaExtensions, filepath.Ext(file)) {
+				sources = append(sources, &ast.Source{Name: file, Input: string(data)})
+				continue
+			}
+
+			op, err := graphql.ParseOperation(data)
+			if err != nil {
+				problem("failed to parse file %s: %s", file, err)
+				if op = lastGood[file]; op == nil {
+					continue
+				}
+			} else {
+				op.File = file
+			}
+
+			current[file] = op
+			operations = append(operations, op)
+		}
+
+		lastGood = current
+
+		if len(sources) == 0 {
+			problem("no schema for service %s, add a .graphql file to %s", svc.Name, roots[len(roots)-1])
+			return
+		}
+
+		schema, err := graphql.LoadSchema(sources...)
+		if err != nil {
+			problem("failed to load schema for service %s, keeping the previous one: %s", svc.Name, err)
+			return
+		}
+
+		svc.Files = files
+		server.Store(&graphql.Server{Schema: schema, Operations: operations, Mock: cfg.Mock})
+
+		if healthy {
+			ctx.PublishServiceOnline(svc.Name)
+		}
+	}
+
+	reload()
+
+	g := gin.New()
+	g.Use(logRequests(ctx, svc.Name), journalRequests(svc.Runtime.Journal))
+
+	answer := func(c *gin.Context) {
+		// give up when the client goes away or the service stops
+		if !wait(c.Request.Context().Done(), svc.Delay) {
+			return
+		}
+
+		s := server.Load()
+		if s == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"errors": []gin.H{{"message": "no schema loaded"}}})
+			return
+		}
+
+		req, err := graphql.ParseRequest(c.Request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": err.Error()}}})
+			return
+		}
+
+		res := s.Execute(req)
+		c.Set(sourceKey, sourceFake)
+		c.Set(resultFileKey, res.File)
+		c.Data(http.StatusOK, "application/json", res.Body)
+	}
+	g.GET(cfg.Path, answer)
+	g.POST(cfg.Path, answer)
+
+	httpServer := &http.Server{
+		Handler:   g,
+		TLSConfig: tlsConfig,
+		Protocols: protocols(svc),
+	}
+
+	ctx.PublishInfo("%s answers graphql at %s", svc.Name, cfg.Path)
+	serveHTTP(ctx, svc, httpServer)
+
+	go watchChanges(ctx, svc.Name, watcher, func() {
+		reload()
+		ctx.PublishInfo("reloaded service %s", svc.Name)
+	})
+
+	// wait for termination
+	<-ctx.Done()
+
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	if err := httpServer.Close(); err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("error stopping server: %s", err)
+	} else {
+		ctx.PublishServiceOffline(svc.Name)
+	}
+}
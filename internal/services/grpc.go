@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/grpc_results"
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// grpcState is what a grpc service answers calls with, swapped on reload.
+type grpcState struct {
+	registry *grpc_results.Registry
+	results  []*grpc_results.Result
+}
+
+// StartGRPC runs a fake gRPC server. The services come from the descriptor
+// sets in the service's results folder, the responses from the response files
+// next to them. Both are reloaded as they change.
+func StartGRPC(svc Service, ctx *app.Context) {
+	var opts []grpc.ServerOption
+	if svc.TLS != nil {
+		tlsConfig, err := svc.TLS.serverConfig(ctx)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to configure tls for service %s: %s", svc.Name, err)
+			return
+		}
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("failed to create watcher for service %s: %s", svc.Name, err)
+		return
+	}
+	defer watcher.Close()
+
+	watch := func(dir string) {
+		if err := watcher.Add(dir); err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to watch directory %s: %s", dir, err)
+		}
+	}
+
+	// The active scenario's responses win over the base ones
+	roots := []string{filepath.Join(ctx.Flags.Results, svc.Name)}
+	if scenario := ctx.Scenario(); scenario != "" {
+		roots = slices.Insert(roots, 0, ScenarioResultsPath(ctx.Flags.Results, scenario, svc.Name))
+	}
+
+	var mu sync.Mutex // guards reloads
+	var state atomic.Pointer[grpcState]
+
+	// reload reads the descriptor sets and responses again. Descriptor sets
+	// that do not load keep the previous ones serving, as does a broken
+	// response file.
+	lastGood := make(map[string]*grpc_results.Result)
+	reload := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		healthy := true
+		problem := func(format string, args ...any) {
+			healthy = false
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError(format, args...)
+		}
+
+		var files []string
+		for _, root := range roots {
+			found, err := responseFiles(root, watch)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				problem("failed to read directory %s: %s", root, err)
+			}
+
+			files = append(files, found...)
+		}
+
+		var sets [][]byte
+		var results []*grpc_results.Result
+		current := make(map[string]*grpc_results.Result)
+
+		for _, file := range files {
+			// the .proto sources of the sets may be kept next to them
+			if filepath.Ext(file) == ".proto" {
+				continue
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				problem("failed to read file %s: %s", file, err)
+				continue
+			}
+
+			if filepath.Ext(file) == grpc_results.DescriptorExtension {
+				sets = append(sets, data)
+				continue
+			}
+
+			result, err := grpc_results.Parse(data)
+			if err != nil {
+				problem("failed to parse file %s: %s", file, err)
+				if result = lastGood[file]; result == nil {
+					continue
+				}
+			} else {
+				result.File = file
+			}
+
+			current[file] = result
+			results = append(results, result)
+		}
+
+		lastGood = current
+
+		if len(sets) == 0 {
+			problem("no descriptor set for service %s, add a %s file to %s", svc.Name, grpc_results.DescriptorExtension, roots[len(roots)-1])
+			return
+		}
+
+		registry, err := grpc_results.LoadDescriptorSets(sets...)
+		if err != nil {
+			problem("failed to load descriptor sets for service %s, keeping the previous ones: %s", svc.Name, err)
+			return
+		}
+
+		// catch responses that do not fit their method now instead of on a call
+		for _, result := range results {
+			md, err := registry.Method(result.Method)
+			if err == nil {
+				_, err = registry.Responses(md, result)
+			}
+
+			if err != nil {
+				problem("invalid response file %s: %s", result.File, err)
+			}
+		}
+
+		svc.Files = files
+		state.Store(&grpcState{registry: registry, results: results})
+
+		if healthy {
+			ctx.PublishServiceOnline(svc.Name)
+		}
+	}
+
+	reload()
+
+	opts = append(opts, grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+
+		result, err := answerGRPC(svc, state.Load(), method, stream)
+		code := status.Code(err)
+
+		if result == nil {
+			ctx.PublishInfo("%s: %s %s grpc unmatched", svc.Name, method, code)
+		} else {
+			ctx.PublishFake("%s: %s %s grpc", svc.Name, method, code)
+		}
+
+		return err
+	}))
+
+	server := grpc.NewServer(opts...)
+
+	// reflection follows the descriptor sets as they are reloaded
+	live := liveRegistry{state: &state}
+	reflectionOpts := reflection.ServerOptions{Services: live, DescriptorResolver: live, ExtensionResolver: live}
+	reflectionv1.RegisterServerReflectionServer(server, reflection.NewServerV1(reflectionOpts))
+	reflectionv1alpha.RegisterServerReflectionServer(server, reflection.NewServer(reflectionOpts))
+
+	for _, address := range listenAddresses(svc) {
+		go func(address string) {
+			l, err := listen(address)
+			if err != nil {
+				ctx.PublishServiceError(svc.Name)
+				ctx.PublishError("server error: %s", err)
+				return
+			}
+
+			ctx.PublishInfo("starting service %s on %s (grpc)", svc.Name, address)
+
+			if err := server.Serve(l); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+				ctx.PublishServiceError(svc.Name)
+				ctx.PublishError("server error: %s", err)
+			}
+		}(address)
+	}
+
+	go watchChanges(ctx, svc.Name, watcher, func() {
+		reload()
+		ctx.PublishInfo("reloaded service %s", svc.Name)
+	})
+
+	// wait for termination
+	<-ctx.Done()
+
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	server.Stop()
+	ctx.PublishServiceOffline(svc.Name)
+}
+
+// answerGRPC answers a call to method with the first response file that
+// matches it, returning the file used.
+func answerGRPC(svc Service, state *grpcState, method string, stream grpc.ServerStream) (*grpc_results.Result, error) {
+	if state == nil {
+		return nil, status.Error(codes.Unavailable, "no descriptor sets loaded")
+	}
+
+	md, err := state.registry.Method(method)
+	if err != nil {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+
+	if md.IsStreamingClient() {
+		return nil, status.Errorf(codes.Unimplemented, "client streaming is not supported: %s", method)
+	}
+
+	req := state.registry.NewRequest(md)
+	if err := stream.RecvMsg(req); err != nil {
+		return nil, err
+	}
+
+	fields := state.registry.Fields(req)
+	incoming, _ := metadata.FromIncomingContext(stream.Context())
+
+	result := findGRPC(state.results, method, fields, incoming)
+	if result == nil {
+		return nil, status.Errorf(codes.Unimplemented, "no response file for method %s", method)
+	}
+
+	responses, err := state.registry.Responses(md, result)
+	if err != nil {
+		return result, status.Error(codes.Internal, err.Error())
+	}
+
+	delay := svc.Delay
+	if result.Delay > 0 {
+		delay = result.Delay
+	}
+
+	if !wait(stream.Context().Done(), delay) {
+		return result, stream.Context().Err()
+	}
+
+	if len(result.Metadata) > 0 {
+		if err := stream.SetHeader(metadata.New(result.Metadata)); err != nil {
+			return result, err
+		}
+	}
+
+	if !md.IsStreamingServer() {
+		if result.Code != codes.OK {
+			return result, status.Error(result.Code, result.Message)
+		}
+
+		// an empty message when the file has none
+		if len(responses) == 0 {
+			return result, stream.SendMsg(state.registry.NewResponse(md))
+		}
+
+		return result, stream.SendMsg(responses[0])
+	}
+
+	for i, msg := range responses {
+		if i > 0 && !wait(stream.Context().Done(), result.Interval) {
+			return result, stream.Context().Err()
+		}
+
+		if err := stream.SendMsg(msg); err != nil {
+			return result, err
+		}
+	}
+
+	if result.Code != codes.OK {
+		return result, status.Error(result.Code, result.Message)
+	}
+
+	return result, nil
+}
+
+// findGRPC returns the first result for method whose match is satisfied,
+// else the first one without a match.
+func findGRPC(results []*grpc_results.Result, method string, fields map[string]any, md metadata.MD) *grpc_results.Result {
+	var fallback *grpc_results.Result
+
+	for _, result := range results {
+		switch {
+		case result.Method != method:
+		case result.Match == nil:
+			if fallback == nil {
+				fallback = result
+			}
+		case result.Match.Matches(fields, md):
+			return result
+		}
+	}
+
+	return fallback
+}
+
+// liveRegistry answers server reflection from the current descriptor sets.
+type liveRegistry struct {
+	state *atomic.Pointer[grpcState]
+}
+
+func (l liveRegistry) registry() *grpc_results.Registry {
+	if s := l.state.Load(); s != nil {
+		return s.registry
+	}
+
+	return nil
+}
+
+func (l liveRegistry) GetServiceInfo() map[string]grpc.ServiceInfo {
+	if r := l.registry(); r != nil {
+		return r.GetServiceInfo()
+	}
+
+	return nil
+}
+
+func (l liveRegistry) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if r := l.registry(); r != nil {
+		return r.FindFileByPath(path)
+	}
+
+	return nil, protoregistry.NotFound
+}
+
+func (l liveRegistry) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if r := l.registry(); r != nil {
+		return r.FindDescriptorByName(name)
+	}
+
+	return nil, protoregistry.NotFound
+}
+
+func (l liveRegistry) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	if r := l.registry(); r != nil {
+		return r.FindExtensionByName(name)
+	}
+
+	return nil, protoregistry.NotFound
+}
+
+func (l liveRegistry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	if r := l.registry(); r != nil {
+		return r.FindExtensionByNumber(message, field)
+	}
+
+	return nil, protoregistry.NotFound
+}
+
+func (l liveRegistry) RangeExtensionsByMessage(message protoreflect.FullName, f func(protoreflect.ExtensionType) bool) {
+	if r := l.registry(); r != nil {
+		r.RangeExtensionsByMessage(message, f)
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/crit/fake-ops/internal/grpc_results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestFindGRPC(t *testing.T) {
+	parse := func(file string) *grpc_results.Result {
+		result, err := grpc_results.Parse([]byte(file))
+		require.Nil(t, err, "error parsing result")
+		return result
+	}
+
+	fallback := parse("# inventory.v1.Inventory/GetItem\n{}")
+	mug := parse("# inventory.v1.Inventory/GetItem\n## match: {fields: {sku: ^MUG-}}\n{}")
+	admin := parse("# inventory.v1.Inventory/GetItem\n## match: {metadata: {x-role: admin}}\n{}")
+	list := parse("# inventory.v1.Inventory/ListItems\n{}")
+
+	results := []*grpc_results.Result{list, fallback, mug, admin}
+
+	tests := map[string]struct {
+		method string
+		fields map[string]any
+		md     metadata.MD
+		want   *grpc_results.Result
+	}{
+		"matched field":    {method: "/inventory.v1.Inventory/GetItem", fields: map[string]any{"sku": "MUG-1"}, want: mug},
+		"matched metadata": {method: "/inventory.v1.Inventory/GetItem", md: metadata.Pairs("x-role", "admin"), want: admin},
+		"fallback":         {method: "/inventory.v1.Inventory/GetItem", fields: map[string]any{"sku": "TEE-1"}, want: fallback},
+		"other method":     {method: "/inventory.v1.Inventory/ListItems", fields: map[string]any{"sku": "MUG-1"}, want: list},
+		"unknown method":   {method: "/inventory.v1.Inventory/DeleteItem"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Same(t, tc.want, findGRPC(results, tc.method, tc.fields, tc.md))
+		})
+	}
+
+	assert.Nil(t, findGRPC([]*grpc_results.Result{mug}, "/inventory.v1.Inventory/GetItem", nil, nil), "no fallback")
+}
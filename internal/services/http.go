@@ -1,27 +1,34 @@
 package services
 
 import (
+	"bytes"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
+	"slices"
+	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/crit/fake-ops/internal/app"
 	"github.com/crit/fake-ops/internal/http_results"
+	"github.com/crit/fake-ops/internal/jwt"
+	"github.com/crit/fake-ops/internal/ratelimit"
 	"github.com/fsnotify/fsnotify"
 	"github.com/gin-gonic/gin"
 )
 
+// routeMethods are the methods response files can answer.
+var routeMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
 // StartHTTP creates a new HTTP server and manages it's lifecycle.
 func StartHTTP(svc Service, ctx *app.Context) {
-	if svc.Skip {
-		ctx.PublishInfo("skipping %s", svc.Name)
-		return
-	}
-
 	resultsPath := ctx.Flags.Results
 
 	watcher, err := fsnotify.NewWatcher()
@@ -32,8 +39,7 @@ func StartHTTP(svc Service, ctx *app.Context) {
 	}
 	defer watcher.Close()
 
-	var mu sync.Mutex
-	var server *http.Server
+	var mu sync.Mutex // guards svc.Files and svc.Responses
 
 	// watch the directory for the service
 	dirPath := filepath.Join(resultsPath, svc.Name)
@@ -44,197 +50,540 @@ func StartHTTP(svc Service, ctx *app.Context) {
 		return
 	}
 
-	// Watch all existing files in the directory
-	files, err := os.ReadDir(dirPath)
-	if err != nil {
-		ctx.PublishServiceError(svc.Name)
-		ctx.PublishError("failed to read directory %s: %s", dirPath, err)
-		return
+	// Files listed in the service file are watched on their own
+	extra := slices.Clone(svc.Files)
+	for _, file := range extra {
+		if err := watcher.Add(file); err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to watch file %s: %s", file, err)
+		}
+	}
+
+	// The active scenario's files for this service overlay the base ones
+	var scenarioPath string
+	if scenario := ctx.Scenario(); scenario != "" {
+		scenarioPath = ScenarioResultsPath(resultsPath, scenario, svc.Name)
+	}
+
+	watch := func(dir string) {
+		if err := watcher.Add(dir); err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to watch directory %s: %s", dir, err)
+		}
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
+	// scan finds the response files of the service, in nested folders too
+	scan := func() error {
+		files, err := responseFiles(dirPath, watch)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
 		}
 
-		filePath := filepath.Join(dirPath, file.Name())
-		svc.Files = append(svc.Files, filePath)
+		if scenarioPath != "" {
+			over, err := responseFiles(scenarioPath, watch)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
 
-		// Add the file to the watcher
-		err = watcher.Add(filePath)
-		if err != nil {
-			ctx.PublishServiceError(svc.Name)
-			ctx.PublishError("failed to watch file %s: %s", filePath, err)
+			files = append(files, over...)
 		}
+
+		svc.Files = append(slices.Clone(extra), files...)
+		return nil
 	}
 
-	// Parse the initial responses based on current files
-	parseResponses := func() {
-		svc.Responses = nil // Clear previous responses
+	// healthy is cleared by every problem found while reloading
+	var healthy bool
+	problem := func(format string, args ...any) {
+		healthy = false
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError(format, args...)
+	}
+
+	// last version of every file that parsed, and the folder settings it was
+	// served with
+	lastGood := make(map[string]loadedFile)
+	lastFolder := make(map[string]string)
+
+	// Parse the responses from the current files, noting the files that
+	// changed since they were last loaded
+	parseResponses := func() ([]*http_results.Result, map[string]bool) {
+		var base, over []*http_results.Result
+		modified := make(map[string]bool)
+
+		current := make(map[string]bool, len(svc.Files))
+		for _, file := range svc.Files {
+			current[file] = true
+		}
+
+		// forget deleted files
+		for file := range lastGood {
+			if !current[file] {
+				delete(lastGood, file)
+				delete(lastFolder, file)
+			}
+		}
+
+		folders := newFolders(func(file string, err error) {
+			problem("failed to load folder settings %s: %s", file, err)
+		})
 
 		for _, file := range svc.Files {
 			data, err := os.ReadFile(file)
-			if err != nil {
-				if errors.Is(err, os.ErrNotExist) {
-					continue
+			if errors.Is(err, os.ErrNotExist) {
+				delete(lastGood, file)
+				continue
+			}
+
+			var result *http_results.Result
+			if err == nil {
+				if loaded, ok := lastGood[file]; ok && bytes.Equal(loaded.data, data) {
+					result = loaded.result
+				} else {
+					result, err = http_results.Parse(data)
 				}
+			}
 
-				ctx.PublishServiceError(svc.Name)
-				ctx.PublishError("failed to read file %s: %s", file, err)
+			switch {
+			case err == nil:
+				result.File = file
+				modified[file] = lastGood[file].result != result
+				lastGood[file] = loadedFile{result: result, data: data}
+			case lastGood[file].result != nil:
+				problem("failed to load file %s, keeping the last good version: %s", file, err)
+				result = lastGood[file].result
+			default:
+				problem("failed to load file %s: %s", file, err)
 				continue
 			}
 
-			result, err := http_results.Parse(data)
-			if err != nil {
-				ctx.PublishServiceError(svc.Name)
-				ctx.PublishError("failed to parse file %s: %s", file, err)
-				continue
+			// Apply the settings of the folders the file is in
+			var roots []string
+			isOver := scenarioPath != "" && strings.HasPrefix(file, scenarioPath+string(filepath.Separator))
+			switch {
+			case isOver:
+				roots = []string{dirPath, scenarioPath}
+			case strings.HasPrefix(file, dirPath+string(filepath.Separator)):
+				roots = []string{dirPath}
+			}
+
+			if roots != nil {
+				rel, _ := filepath.Rel(roots[len(roots)-1], filepath.Dir(file))
+				folder := folders.defaults(roots, rel)
+
+				settings := fmt.Sprint(folder)
+				if settings != lastFolder[file] {
+					modified[file] = true
+					lastFolder[file] = settings
+				}
+
+				result = folder.Apply(result)
 			}
 
-			svc.Responses = append(svc.Responses, result)
+			if isOver {
+				over = append(over, result)
+			} else {
+				base = append(base, result)
+			}
 		}
+
+		return overlay(base, over), modified
 	}
 
-	parseResponses()
+	// Load the certificate once, it does not change when files do
+	var tlsConfig *tls.Config
+	if svc.TLS != nil {
+		tlsConfig, err = svc.TLS.serverConfig(ctx)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to configure tls for service %s: %s", svc.Name, err)
+			return
+		}
+	}
 
-	// Function to start the server
-	startServer := func() {
-		mu.Lock()
-		defer mu.Unlock()
+	// Load the key verifying bearer tokens once
+	var jwtKey *jwt.Key
+	if svc.Auth != nil && svc.Auth.Bearer != nil {
+		jwtKey, err = jwt.LoadKey(ctx.Flags.Certs)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to load jwt key for service %s: %s", svc.Name, err)
+			return
+		}
+	}
+
+	// Counts of the service-wide limit carry over reloads
+	var limiter *ratelimit.Limiter
+	if svc.RateLimit != nil {
+		limiter, err = ratelimit.New(*svc.RateLimit)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to configure rate limit for service %s: %s", svc.Name, err)
+			return
+		}
+	}
+
+	// newEngine routes requests to responses. gin panics on routes that
+	// conflict, which is returned as an error.
+	newEngine := func(responses []*http_results.Result) (g *gin.Engine, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+
+		g = gin.New()
+		g.Use(logRequests(ctx, svc.Name), journalRequests(svc.Runtime.Journal))
+
+		if limiter != nil {
+			g.Use(limitRequests(limiter))
+		}
+
+		if svc.Auth != nil {
+			g.Use(authenticate(svc.Name, svc.Auth, jwtKey))
+
+			if path := svc.Auth.jwksPath(); path != "" {
+				g.GET(path, func(c *gin.Context) {
+					c.Set(sourceKey, sourceFake)
+					c.JSON(http.StatusOK, jwtKey.JWKS())
+				})
+			}
+		}
+
+		// answers requests no response file does
+		var fallback gin.HandlerFunc
+
+		switch {
+		case svc.Record:
+			handler, err := recordHandler(ctx, svc, dirPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to record: %s", err)
+			}
 
-		// Create a new Gin instance
-		g := gin.New()
-		g.GET("/", func(c *gin.Context) { c.String(http.StatusOK, svc.Name) })
+			g.NoRoute(handler)
+
+		case svc.Upstream != "":
+			handler, err := passthroughHandler(ctx, svc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to proxy: %s", err)
+			}
+
+			fallback = handler
+			g.NoRoute(handler)
+		}
+
+		for _, route := range groupRoutes(responses) {
+			// response files limit on their own, counting anew after reloads
+			limiters := make(map[*http_results.Result]*ratelimit.Limiter)
+			for _, result := range route.results {
+				if result.RateLimit != nil {
+					limiters[result], _ = ratelimit.New(*result.RateLimit) // validated when parsed
+				}
+			}
 
-		for _, result := range svc.Responses {
 			handler := func(c *gin.Context) {
-				c.Data(result.Code, result.ContentType, http_results.FillUUID(result.Data, len(c.Params)))
+				params := make(map[string]string, len(c.Params))
+				for _, p := range c.Params {
+					params[p.Key] = p.Value
+				}
+
+				req := http_results.NewRequest(c.Request, params)
+				if claims, ok := c.Get(claimsKey); ok {
+					req.Claims = claims.(jwt.Claims)
+				}
+
+				result := route.pick(req)
+				if result == nil {
+					// no response file matches, let the upstream answer if there is one
+					if fallback != nil {
+						fallback(c)
+					} else {
+						c.Status(http.StatusNotFound)
+					}
+					return
+				}
+
+				if l := limiters[result]; l != nil && !allow(c, l) {
+					c.Set(resultFileKey, result.File)
+					return
+				}
+
+				delay := svc.Delay
+				if result.Delay > 0 {
+					delay = result.Delay
+				}
+
+				// give up when the client goes away or the service stops
+				if !wait(c.Request.Context().Done(), delay) {
+					return
+				}
+
+				data, err := result.Render(req)
+				if err != nil {
+					ctx.PublishServiceError(svc.Name)
+					ctx.PublishError("%s: %s", result.File, err)
+					c.Status(http.StatusInternalServerError)
+					return
+				}
+
+				data = http_results.FillUUID(data, len(c.Params))
+
+				contentType := result.ContentType
+				if contentType == "" {
+					contentType = http.DetectContentType(data)
+				}
+
+				for name, value := range result.Headers {
+					c.Header(name, value)
+				}
+
+				c.Set(resultFileKey, result.File)
+				c.Set(sourceKey, sourceFake)
+				c.Data(result.Code, contentType, data)
+
+				if len(result.Webhooks) > 0 {
+					sendWebhooks(ctx, svc.Name, result, http_results.NewWebhookData(req, data))
+				}
+			}
+
+			for _, dup := range route.duplicates {
+				problem("route already exists: %s %s (%s)", dup.Method, dup.Path, dup.File)
 			}
 
 			// Check if the route already exists
-			existingRoutes := g.Routes()
-			routeExists := false
-			for _, r := range existingRoutes {
-				if r.Method == result.Method && r.Path == result.Path {
-					routeExists = true
-					break
-				}
+			if hasRoute(g, route.method, route.path) {
+				problem("route already exists: %s %s", route.method, route.path)
+				continue
 			}
 
-			if routeExists {
-				ctx.PublishServiceError(svc.Name)
-				ctx.PublishError("route already exists: %s %s", result.Method, result.Path)
+			// every method a recording can write is served
+			if !slices.Contains(routeMethods, route.method) {
+				problem("%s unsupported method: %s", route.path, route.method)
 				continue
 			}
 
-			switch result.Method {
-			case "GET":
-				g.GET(result.Path, handler)
-			case "POST":
-				g.POST(result.Path, handler)
-			case "DELETE":
-				g.DELETE(result.Path, handler)
-			case "PUT":
-				g.PUT(result.Path, handler)
-			default:
-				ctx.PublishServiceError(svc.Name)
-				ctx.PublishError("%s unsupported method: %s", result.Path, result.Method)
+			g.Handle(route.method, route.path, handler)
+		}
+
+		// Answer the root with the service name unless a response file or the
+		// upstream does
+		if svc.Upstream == "" && !hasRoute(g, http.MethodGet, "/") {
+			g.GET("/", func(c *gin.Context) {
+				c.Set(sourceKey, sourceFake)
+				c.String(http.StatusOK, svc.Name)
+			})
+		}
+
+		return g, nil
+	}
+
+	// The server lives as long as the service. Reloads swap the engine it
+	// routes with, so requests in flight finish on the routes they started on.
+	var engine atomic.Pointer[gin.Engine]
+
+	// reload finds and loads the response files and swaps in their routes,
+	// reporting how they changed and whether it did. When the routes cannot
+	// be built, the previous ones keep serving.
+	reload := func() (routeChanges, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		healthy = true
+
+		// Recording serves nothing from the response files, it writes them
+		var responses []*http_results.Result
+		var modified map[string]bool
+		if !svc.Record {
+			if err := scan(); err != nil {
+				problem("failed to read directory %s: %s", dirPath, err)
 			}
+
+			responses, modified = parseResponses()
 		}
 
-		// Start HTTP server in a goroutine
-		go func() {
+		g, err := newEngine(responses)
+		if err != nil {
+			problem("failed to load routes for service %s, keeping the previous ones: %s", svc.Name, err)
+			return routeChanges{}, false
+		}
+
+		changes := diffRoutes(resultsPath, svc.Responses, responses, modified)
+
+		svc.Responses = responses
+		svc.Runtime.SetRoutes(responses)
+		engine.Store(g)
+
+		if healthy {
 			ctx.PublishServiceOnline(svc.Name)
-			ctx.PublishInfo("starting service %s:%d", svc.Name, svc.Port)
+		}
 
-			server = &http.Server{
-				Addr:    ":" + strconv.Itoa(svc.Port),
-				Handler: g,
-			}
+		return changes, true
+	}
 
-			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-				ctx.PublishServiceError(svc.Name)
-				ctx.PublishError("server error: %s", err)
+	reload()
+
+	// nothing to keep serving when the first load fails
+	if engine.Load() == nil {
+		engine.Store(gin.New())
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			engine.Load().ServeHTTP(w, r)
+		}),
+		TLSConfig: tlsConfig,
+		Protocols: protocols(svc),
+	}
+
+	serveHTTP(ctx, svc, server)
+
+	// Watch for files and folders being added, changed, renamed and deleted.
+	// Recording writes files of its own that must not reload the routes.
+	if !svc.Record {
+		go watchChanges(ctx, svc.Name, watcher, func() {
+			if changes, ok := reload(); ok {
+				changes.publish(ctx, svc.Name)
 			}
-		}()
+		})
 	}
 
-	// Function to gracefully stop the server
-	stopCurrentServer := func() {
-		mu.Lock()
-		defer mu.Unlock()
-		if server != nil {
-			ctx.PublishInfo("stopping service %s", svc.Name)
+	// wait for termination
+	<-ctx.Done()
 
-			if err := server.Close(); err != nil {
-				ctx.PublishServiceError(svc.Name)
-				ctx.PublishError("error stopping server: %s", err)
-			} else {
-				ctx.PublishServiceOffline(svc.Name)
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	if err := server.Close(); err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("error stopping server: %s", err)
+	} else {
+		ctx.PublishServiceOffline(svc.Name)
+	}
+}
+
+// hasRoute reports whether g already serves method and path.
+func hasRoute(g *gin.Engine, method, path string) bool {
+	for _, r := range g.Routes() {
+		if r.Method == method && r.Path == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// route is every Result answering the same method and path.
+type route struct {
+	method     string
+	path       string
+	results    []*http_results.Result
+	duplicates []*http_results.Result
+}
+
+// pick returns the first Result matching req, or nil when none do.
+func (r *route) pick(req http_results.Request) *http_results.Result {
+	for _, result := range r.results {
+		if result.Match.Matches(req) {
+			return result
+		}
+	}
+
+	return nil
+}
+
+// groupRoutes collects results by method and path, keeping the order routes
+// first appear in. Results with a match come before the one without, which
+// answers everything else. Only one Result per route may be without a match.
+func groupRoutes(results []*http_results.Result) []*route {
+	var routes []*route
+	index := make(map[string]*route)
+
+	for _, result := range results {
+		key := result.Method + " " + result.Path
+
+		r, ok := index[key]
+		if !ok {
+			r = &route{method: result.Method, path: result.Path}
+			index[key] = r
+			routes = append(routes, r)
+		}
+
+		r.results = append(r.results, result)
+	}
+
+	for _, r := range routes {
+		var matched []*http_results.Result
+		var fallback *http_results.Result
+
+		for _, result := range r.results {
+			switch {
+			case result.Match != nil:
+				matched = append(matched, result)
+			case fallback == nil:
+				fallback = result
+			default:
+				r.duplicates = append(r.duplicates, result)
 			}
+		}
 
-			server = nil
+		r.results = matched
+		if fallback != nil {
+			r.results = append(r.results, fallback)
 		}
 	}
 
-	// Start the server initially
-	startServer()
+	return routes
+}
 
-	// Watch for file changes and new files
-	go func() {
-		var timer *time.Timer // debounce timer
+// protocols are the HTTP versions an HTTP service speaks.
+func protocols(svc Service) *http.Protocols {
+	var p http.Protocols
+	p.SetHTTP1(true)
 
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
+	if svc.HTTP2 {
+		p.SetHTTP2(true)
+		p.SetUnencryptedHTTP2(true)
+	}
 
-				// Handle new files and changes
-				if event.Has(fsnotify.Create | fsnotify.Write | fsnotify.Rename) {
-					ctx.PublishInfo("%s: %s", event.Op, event.Name)
+	return &p
+}
 
-					if timer != nil {
-						timer.Stop()
-					}
+// serveHTTP starts server on every address of svc in the background.
+func serveHTTP(ctx *app.Context, svc Service, server *http.Server) {
+	for _, address := range listenAddresses(svc) {
+		go func(address string) {
+			l, err := listen(address)
+			if err != nil {
+				ctx.PublishServiceError(svc.Name)
+				ctx.PublishError("server error: %s", err)
+				return
+			}
 
-					timer = time.AfterFunc(300*time.Millisecond, func() {
-						// Handle directory changes (e.g., a new file added)
-						if event.Op&fsnotify.Create != 0 {
-							fileInfo, err := os.Stat(event.Name)
-							if err == nil && !fileInfo.IsDir() {
-								// Add the new file to svc.Files and watcher
-								mu.Lock()
-								svc.Files = append(svc.Files, event.Name)
-								mu.Unlock()
-
-								err = watcher.Add(event.Name)
-								if err != nil {
-									ctx.PublishServiceError(svc.Name)
-									ctx.PublishError("failed to watch new file %s: %s", event.Name, err)
-								}
-							}
-						}
-
-						// Stop the current server and reload responses
-						stopCurrentServer()
-						parseResponses()
-						startServer()
-					})
-				}
+			ctx.PublishInfo("starting service %s on %s (%s)", svc.Name, address, protocolNames(svc, server.TLSConfig != nil))
 
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
+			if server.TLSConfig != nil {
+				err = server.ServeTLS(l, "", "")
+			} else {
+				err = server.Serve(l)
+			}
+
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
 				ctx.PublishServiceError(svc.Name)
-				ctx.PublishError("file watcher error: %s", err)
+				ctx.PublishError("server error: %s", err)
 			}
-		}
-	}()
+		}(address)
+	}
+}
 
-	// wait for termination
-	<-ctx.Done()
-	stopCurrentServer()
+// protocolNames describes the protocols an HTTP service speaks for the logs.
+func protocolNames(svc Service, tls bool) string {
+	switch {
+	case svc.HTTP2 && tls:
+		return "tls, http/1.1, h2"
+	case svc.HTTP2:
+		return "http/1.1, h2c"
+	case tls:
+		return "tls, http/1.1"
+	default:
+		return "http/1.1"
+	}
 }
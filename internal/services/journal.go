@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/http_results"
+	"github.com/crit/fake-ops/internal/journal"
+	"github.com/gin-gonic/gin"
+)
+
+// resultFileKey is set on the gin.Context to the response file that answered
+// a request.
+const resultFileKey = "fake-ops.file"
+
+// sourceKey is set on the gin.Context to how a request was answered.
+const sourceKey = "fake-ops.source"
+
+// Sources of a response.
+const (
+	sourceFake   = "fake"
+	sourceProxy  = "proxy"
+	sourceRecord = "record"
+)
+
+// journalRequests is gin middleware recording every request in j.
+func journalRequests(j *journal.Journal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		c.Next()
+
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+
+		var clientCert string
+		if cert := http_results.NewClientCert(c.Request.TLS); cert != nil {
+			clientCert = cert.Subject
+		}
+
+		j.Add(journal.Entry{
+			Time:       start,
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Protocol:   protocol(c.Request),
+			Route:      c.FullPath(),
+			Params:     params,
+			Query:      c.Request.URL.Query(),
+			Headers:    c.Request.Header.Clone(),
+			Body:       string(body),
+			ClientCert: clientCert,
+			File:       c.GetString(resultFileKey),
+			Source:     c.GetString(sourceKey),
+			Status:     c.Writer.Status(),
+			Latency:    time.Since(start),
+		})
+	}
+}
+
+// logRequests is gin middleware publishing every request to the UI, marking
+// whether it was faked or forwarded upstream.
+func logRequests(ctx *app.Context, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		method, path, status, proto := c.Request.Method, c.Request.URL.Path, c.Writer.Status(), protocol(c.Request)
+
+		switch source := c.GetString(sourceKey); source {
+		case sourceFake:
+			ctx.PublishFake("%s: %s %s %d %s", name, method, path, status, proto)
+		case sourceProxy, sourceRecord:
+			ctx.PublishProxy("%s: %s %s %d %s %s", name, method, path, status, proto, source)
+		default:
+			ctx.PublishInfo("%s: %s %s %d %s unmatched", name, method, path, status, proto)
+		}
+	}
+}
+
+// fakeRoutes marks requests to any registered route as faked, for services
+// built in instead of read from response files.
+func fakeRoutes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() != "" {
+			c.Set(sourceKey, sourceFake)
+		}
+
+		c.Next()
+	}
+}
+
+// protocol names the protocol a request was received over: http/1.1, h2 when
+// negotiated over TLS, or h2c over cleartext.
+func protocol(r *http.Request) string {
+	switch {
+	case r.ProtoMajor == 2 && r.TLS != nil:
+		return "h2"
+	case r.ProtoMajor == 2:
+		return "h2c"
+	default:
+		return strings.ToLower(r.Proto)
+	}
+}
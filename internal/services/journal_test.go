@@ -0,0 +1,50 @@
+package services
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crit/fake-ops/internal/journal"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalProtocol(t *testing.T) {
+	tests := map[string]struct {
+		major int
+		tls   bool
+		want  string
+	}{
+		"http/1.1":    {major: 1, want: "http/1.1"},
+		"https/1.1":   {major: 1, tls: true, want: "http/1.1"},
+		"h2 over tls": {major: 2, tls: true, want: "h2"},
+		"h2c":         {major: 2, want: "h2c"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			j := journal.New(10)
+
+			g := gin.New()
+			g.Use(journalRequests(j))
+			g.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tc.major == 2 {
+				req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/2.0", 2, 0
+			}
+			if tc.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			g.ServeHTTP(httptest.NewRecorder(), req)
+
+			entries := j.Entries(journal.Query{})
+			require.Len(t, entries, 1)
+			assert.Equal(t, tc.want, entries[0].Protocol)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unixPrefix marks a listen address as a unix domain socket path.
+const unixPrefix = "unix:"
+
+// listenAddresses returns the addresses a service listens on. Without a
+// listen section it listens on its port on all interfaces. Addresses without
+// a port use the service's port.
+func listenAddresses(svc Service) []string {
+	if len(svc.Listen) == 0 {
+		return []string{":" + strconv.Itoa(svc.Port)}
+	}
+
+	addresses := make([]string, 0, len(svc.Listen))
+	for _, address := range svc.Listen {
+		if !strings.HasPrefix(address, unixPrefix) {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				host := strings.Trim(address, "[]")
+				address = net.JoinHostPort(host, strconv.Itoa(svc.Port))
+			}
+		}
+
+		addresses = append(addresses, address)
+	}
+
+	return addresses
+}
+
+// listen opens a listener for an address from listenAddresses.
+func listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, unixPrefix); ok {
+		// a socket left behind by an earlier run would block listening
+		if info, err := os.Stat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+
+		return net.Listen("unix", path)
+	}
+
+	return net.Listen("tcp", address)
+}
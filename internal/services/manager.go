@@ -0,0 +1,321 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/crit/fake-ops/internal/app"
+)
+
+// ErrUnknownService is returned when a Manager is asked about a service it
+// does not run.
+var ErrUnknownService = errors.New("unknown service")
+
+// Manager runs services and restarts them when the active scenario changes.
+type Manager struct {
+	ctx      *app.Context
+	mu       sync.Mutex
+	services []Service
+	running  map[string]*instance
+	runtimes map[string]*Runtime
+}
+
+// instance is a running service.
+type instance struct {
+	svc    Service // as it was started, with the scenario applied
+	cancel func()
+	done   <-chan struct{}
+}
+
+// stopped reports whether the service routine has returned.
+func (inst *instance) stopped() bool {
+	select {
+	case <-inst.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ServiceInfo describes a service managed by a Manager.
+type ServiceInfo struct {
+	Name    string   `json:"name"`
+	Type    Type     `json:"type"`
+	Port    int      `json:"port"`
+	Listen  []string `json:"listen,omitempty"`
+	Skip    bool     `json:"skip"`
+	TLS     bool     `json:"tls"`
+	HTTP2   bool     `json:"http2"`
+	Status  string   `json:"status"`
+	Running bool     `json:"running"`
+}
+
+// NewManager creates a Manager for the listed services.
+func NewManager(ctx *app.Context, list []Service) *Manager {
+	m := &Manager{
+		ctx:      ctx,
+		services: list,
+		running:  make(map[string]*instance),
+		runtimes: make(map[string]*Runtime),
+	}
+
+	for _, svc := range list {
+		m.runtimes[svc.Name] = NewRuntime(svc)
+	}
+
+	ctx.OnScenario(m.applyScenario)
+
+	return m
+}
+
+// Start runs every service with the active scenario applied.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scenario := m.scenario(m.ctx.Scenario())
+
+	for _, svc := range m.services {
+		m.start(scenario, svc)
+	}
+}
+
+// Services describes every managed service.
+func (m *Manager) Services() []ServiceInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]ServiceInfo, 0, len(m.services))
+	for _, svc := range m.services {
+		list = append(list, m.info(svc))
+	}
+
+	return list
+}
+
+// Service describes the named service.
+func (m *Manager) Service(name string) (ServiceInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	svc, ok := m.find(name)
+	if !ok {
+		return ServiceInfo{}, ErrUnknownService
+	}
+
+	return m.info(svc), nil
+}
+
+// Runtime returns the shared state of the named service.
+func (m *Manager) Runtime(name string) (*Runtime, error) {
+	rt, ok := m.runtimes[name]
+	if !ok {
+		return nil, ErrUnknownService
+	}
+
+	return rt, nil
+}
+
+// StartService starts the named service with the active scenario applied. A
+// service that is skipped in its yaml file is started anyway.
+func (m *Manager) StartService(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	svc, ok := m.find(name)
+	if !ok {
+		return ErrUnknownService
+	}
+
+	m.stop(name)
+
+	scenario := m.scenario(m.ctx.Scenario())
+	svc, err := scenario.Apply(svc)
+	if err != nil {
+		m.ctx.PublishError("%s", err)
+	}
+
+	svc.Skip = false
+	m.run(svc)
+
+	return nil
+}
+
+// StopService stops the named service and waits for it to finish.
+func (m *Manager) StopService(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.find(name); !ok {
+		return ErrUnknownService
+	}
+
+	m.stop(name)
+
+	return nil
+}
+
+// Reset returns every service to how it was on startup, restarting them with
+// the scenario given by the --scenario flag, clearing their journals and
+// mailboxes and returning redis keys to their seeds. Services stopped since
+// start again and skipped ones started since stop. An unknown scenario falls
+// back to the base results, like on startup.
+func (m *Manager) Reset() error {
+	var errs []error
+	for _, rt := range m.runtimes {
+		if err := rt.Reset(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// with nothing running the switch restarts nothing, Start brings back
+	// the services that ran on startup
+	m.mu.Lock()
+	for _, svc := range m.services {
+		m.stop(svc.Name)
+	}
+	m.mu.Unlock()
+
+	scenario := m.ctx.Flags.Scenario
+	if !slices.Contains(m.ctx.Scenarios(), scenario) {
+		scenario = ""
+	}
+
+	if err := m.ctx.SwitchScenario(scenario); err != nil {
+		errs = append(errs, err)
+	}
+
+	m.Start()
+
+	return errors.Join(errs...)
+}
+
+// find looks up a service by name. Callers must hold m.mu.
+func (m *Manager) find(name string) (Service, bool) {
+	for _, svc := range m.services {
+		if svc.Name == name {
+			return svc, true
+		}
+	}
+
+	return Service{}, false
+}
+
+// info describes a service. Callers must hold m.mu.
+func (m *Manager) info(svc Service) ServiceInfo {
+	inst, ok := m.running[svc.Name]
+
+	// every type but app services listens itself
+	var listen []string
+	if svc.Type != ServiceApp {
+		listen = listenAddresses(svc)
+	}
+
+	return ServiceInfo{
+		Name:    svc.Name,
+		Type:    svc.Type,
+		Port:    svc.Port,
+		Listen:  listen,
+		Skip:    svc.Skip,
+		TLS:     svc.TLS != nil,
+		HTTP2:   svc.HTTP2,
+		Status:  m.ctx.Status(svc.Name),
+		Running: ok && !inst.stopped(),
+	}
+}
+
+// scenario loads the named scenario, falling back to an empty one.
+func (m *Manager) scenario(name string) *Scenario {
+	scenario, err := LoadScenario(m.ctx.Flags.Results, name)
+	if err != nil {
+		m.ctx.PublishError("failed to load scenario: %s", err)
+		return &Scenario{}
+	}
+
+	return scenario
+}
+
+// start runs a single service with the scenario applied. Callers must hold
+// m.mu.
+func (m *Manager) start(scenario *Scenario, svc Service) {
+	svc, err := scenario.Apply(svc)
+	if err != nil {
+		m.ctx.PublishError("%s", err)
+	}
+
+	m.run(svc)
+}
+
+// run backgrounds a single service. Callers must hold m.mu.
+func (m *Manager) run(svc Service) {
+	ctx, cancel := m.ctx.WithCancel()
+	inst := &instance{svc: svc, cancel: cancel}
+	svc.Runtime = m.runtimes[svc.Name]
+
+	done, err := Run(ctx, svc)
+	if err != nil {
+		cancel()
+		m.ctx.PublishError("failed to start service %s: %s", svc.Name, err)
+		return
+	}
+
+	inst.done = done
+	m.running[svc.Name] = inst
+}
+
+// stop cancels a single service and waits for it to finish. Callers must
+// hold m.mu.
+func (m *Manager) stop(name string) {
+	inst, ok := m.running[name]
+	if !ok {
+		return
+	}
+
+	inst.cancel()
+	<-inst.done
+	delete(m.running, name)
+}
+
+// applyScenario restarts the running services with the named scenario
+// applied. Stopped services stay stopped and app services only restart when
+// the scenario changes their settings.
+func (m *Manager) applyScenario(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scenario, err := LoadScenario(m.ctx.Flags.Results, name)
+	if err != nil {
+		m.ctx.PublishError("failed to load scenario: %s", err)
+		return
+	}
+
+	if name == "" {
+		m.ctx.PublishInfo("switching to base results")
+	} else {
+		m.ctx.PublishInfo("switching to scenario %s", name)
+	}
+
+	for _, svc := range m.services {
+		inst, ok := m.running[svc.Name]
+		if !ok {
+			continue
+		}
+
+		svc, err := scenario.Apply(svc)
+		if err != nil {
+			m.ctx.PublishError("%s", err)
+		}
+
+		// services started by hand stay started
+		svc.Skip = inst.svc.Skip
+
+		if svc.Type == ServiceApp && reflect.DeepEqual(svc, inst.svc) {
+			continue
+		}
+
+		m.stop(svc.Name)
+		m.run(svc)
+	}
+}
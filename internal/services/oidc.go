@@ -0,0 +1,74 @@
+package services
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/jwt"
+	"github.com/crit/fake-ops/internal/oidc"
+	"github.com/gin-gonic/gin"
+)
+
+// StartOIDC runs a fake OAuth2 and OpenID Connect provider. Tokens are signed
+// with the same key HTTP services verify bearer tokens with.
+func StartOIDC(svc Service, ctx *app.Context) {
+	var cfg oidc.Config
+	if svc.OIDC != nil {
+		cfg = *svc.OIDC
+	}
+
+	var tlsConfig *tls.Config
+	if svc.TLS != nil {
+		var err error
+		tlsConfig, err = svc.TLS.serverConfig(ctx)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to configure tls for service %s: %s", svc.Name, err)
+			return
+		}
+	}
+
+	if cfg.Issuer == "" {
+		scheme := "http"
+		if tlsConfig != nil {
+			scheme = "https"
+		}
+
+		cfg.Issuer = fmt.Sprintf("%s://localhost:%d", scheme, svc.Port)
+	}
+
+	key, err := jwt.LoadKey(ctx.Flags.Certs)
+	if err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("failed to load jwt key for service %s: %s", svc.Name, err)
+		return
+	}
+
+	g := gin.New()
+	g.Use(logRequests(ctx, svc.Name), journalRequests(svc.Runtime.Journal), fakeRoutes())
+	oidc.New(cfg, key).Register(g)
+
+	server := &http.Server{
+		Handler:   g,
+		TLSConfig: tlsConfig,
+		Protocols: protocols(svc),
+	}
+
+	ctx.PublishServiceOnline(svc.Name)
+	ctx.PublishInfo("%s issues tokens as %s", svc.Name, cfg.Issuer)
+	serveHTTP(ctx, svc, server)
+
+	// wait for termination
+	<-ctx.Done()
+
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	if err := server.Close(); err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("error stopping server: %s", err)
+	} else {
+		ctx.PublishServiceOffline(svc.Name)
+	}
+}
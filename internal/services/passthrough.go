@@ -0,0 +1,26 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/proxy"
+	"github.com/gin-gonic/gin"
+)
+
+// passthroughHandler forwards requests no response file answers to the
+// service's upstream.
+func passthroughHandler(ctx *app.Context, svc Service) (gin.HandlerFunc, error) {
+	p, err := proxy.New(svc.Upstream, func(r *http.Request, err error) {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("%s: upstream error for %s %s: %s", svc.Name, r.Method, r.URL.Path, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		c.Set(sourceKey, sourceProxy)
+		p.ServeHTTP(c.Writer, c.Request)
+	}, nil
+}
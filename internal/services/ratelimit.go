@@ -0,0 +1,33 @@
+package services
+
+import (
+	"github.com/crit/fake-ops/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// limitRequests is gin middleware answering requests over the limit of l
+// with its 429 response.
+func limitRequests(l *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !allow(c, l) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// allow counts the request against l, setting the rate limit headers and
+// rejecting it when over the limit.
+func allow(c *gin.Context, l *ratelimit.Limiter) bool {
+	d := l.Allow(c.Request)
+	d.WriteHeaders(c.Writer.Header())
+
+	if !d.Allowed {
+		c.Set(sourceKey, sourceFake)
+		l.Reject(c.Writer)
+	}
+
+	return d.Allowed
+}
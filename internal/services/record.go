@@ -0,0 +1,103 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/http_results"
+	"github.com/crit/fake-ops/internal/proxy"
+	"github.com/gin-gonic/gin"
+)
+
+// recordHandler forwards every request to the service's upstream and writes
+// the responses to response files in dir.
+func recordHandler(ctx *app.Context, svc Service, dir string) (gin.HandlerFunc, error) {
+	p, err := proxy.New(svc.Upstream, func(r *http.Request, err error) {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("%s: upstream error for %s %s: %s", svc.Name, r.Method, r.URL.Path, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex                   // guards recorded
+	recorded := make(map[string]string) // request path written to each file
+
+	p.ModifyResponse = func(res *http.Response) error {
+		// responses to methods response files cannot answer are only proxied
+		if !slices.Contains(routeMethods, res.Request.Method) {
+			return nil
+		}
+
+		result := &http_results.Result{
+			Code:        res.StatusCode,
+			Method:      res.Request.Method,
+			Path:        http_results.GeneralizePath(res.Request.URL.Path),
+			ContentType: res.Header.Get("Content-Type"),
+		}
+
+		file := filepath.Join(dir, recordFileName(result))
+
+		// another path with the same route would overwrite the first one
+		mu.Lock()
+		first, clash := recorded[file]
+		clash = clash && first != res.Request.URL.Path
+		if !clash {
+			recorded[file] = res.Request.URL.Path
+		}
+		mu.Unlock()
+
+		if clash {
+			ctx.PublishInfo("%s: not recording %s %s, %s already holds %s", svc.Name, result.Method, res.Request.URL.Path, filepath.Base(file), first)
+			return nil
+		}
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		result.Data = body
+
+		if err := os.WriteFile(file, http_results.Format(result), 0644); err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to record %s: %s", file, err)
+			return nil
+		}
+
+		ctx.PublishInfo("%s: recorded %s %s %d", svc.Name, result.Method, result.Path, result.Code)
+		return nil
+	}
+
+	return func(c *gin.Context) {
+		// let the transport negotiate compression so recorded bodies are plain
+		c.Request.Header.Del("Accept-Encoding")
+
+		result := &http_results.Result{Method: c.Request.Method, Path: http_results.GeneralizePath(c.Request.URL.Path)}
+		c.Set(resultFileKey, filepath.Join(dir, recordFileName(result)))
+		c.Set(sourceKey, sourceRecord)
+
+		p.ServeHTTP(c.Writer, c.Request)
+	}, nil
+}
+
+// recordFileName names the response file for a recorded result.
+//
+//	GET /payments/:param/refund => get-payments-param-refund.yaml
+func recordFileName(result *http_results.Result) string {
+	name := strings.NewReplacer("/", "-", ":", "", "*", "").Replace(strings.Trim(result.Path, "/"))
+	if name == "" {
+		name = "index"
+	}
+
+	return fmt.Sprintf("%s-%s.yaml", strings.ToLower(result.Method), name)
+}
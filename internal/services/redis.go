@@ -0,0 +1,309 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/redis_store"
+	"github.com/fsnotify/fsnotify"
+)
+
+// redisVersion is the Redis version a redis service claims to be, for
+// clients that check it.
+const redisVersion = "7.2.0"
+
+// subscribedCommands are the commands a client subscribed to channels can
+// still send.
+var subscribedCommands = []string{"SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE", "PING", "QUIT"}
+
+// StartRedis runs a fake Redis keeping its keys in memory, starting from the
+// service's seed file. Keys survive restarts of the service and return to
+// the seed when it changes or the fakes are reset.
+func StartRedis(svc Service, ctx *app.Context) {
+	var config redis_store.Config
+	if svc.Redis != nil {
+		config = *svc.Redis
+	}
+
+	// without a seed the service's seed file is used when there is one
+	seedFile, explicit := config.Seed, config.Seed != ""
+	if !explicit {
+		seedFile = redis_store.DefaultSeed
+	}
+	if !filepath.IsAbs(seedFile) {
+		seedFile = filepath.Join(ctx.Flags.Results, svc.Name, seedFile)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("failed to create watcher for service %s: %s", svc.Name, err)
+		return
+	}
+	defer watcher.Close()
+
+	// a missing folder only matters when the seed was asked for
+	if err := watcher.Add(filepath.Dir(seedFile)); err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("failed to watch directory %s: %s", filepath.Dir(seedFile), err)
+	}
+
+	store := svc.Runtime.Redis
+
+	var mu sync.Mutex // guards reloads
+
+	// reload loads the seed file again. A seed that fails to load keeps the
+	// keys as they are.
+	reload := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		data, err := os.ReadFile(seedFile)
+		switch {
+		case errors.Is(err, os.ErrNotExist) && !explicit:
+			svc.Files = nil
+		case err != nil:
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to read file %s: %s", seedFile, err)
+			return
+		default:
+			svc.Files = []string{seedFile}
+		}
+
+		if err := store.Load(data); err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to load file %s, keeping the keys: %s", seedFile, err)
+			return
+		}
+
+		ctx.PublishServiceOnline(svc.Name)
+	}
+
+	reload()
+
+	var listeners []net.Listener
+	for _, address := range listenAddresses(svc) {
+		l, err := listen(address)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("server error: %s", err)
+			continue
+		}
+
+		ctx.PublishInfo("starting service %s on %s (redis)", svc.Name, address)
+		listeners = append(listeners, l)
+
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					if !errors.Is(err, net.ErrClosed) {
+						ctx.PublishServiceError(svc.Name)
+						ctx.PublishError("server error: %s", err)
+					}
+					return
+				}
+
+				// stop with the service
+				stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+
+				go func() {
+					defer stop()
+					converseRedis(ctx, svc, store, conn)
+				}()
+			}
+		}()
+	}
+
+	go watchChanges(ctx, svc.Name, watcher, func() {
+		reload()
+		ctx.PublishInfo("reloaded service %s", svc.Name)
+	})
+
+	// wait for termination
+	<-ctx.Done()
+
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+
+	ctx.PublishServiceOffline(svc.Name)
+}
+
+// converseRedis answers the commands of one client until it quits or goes
+// away. Any password is accepted and every database is database 0.
+func converseRedis(ctx *app.Context, svc Service, store *redis_store.Store, conn net.Conn) {
+	defer conn.Close()
+
+	// blocking commands give up when the client goes away
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	var wmu sync.Mutex // guards w, shared with published messages
+	write := func(reply any) {
+		wmu.Lock()
+		defer wmu.Unlock()
+
+		if err := redis_store.WriteReply(w, reply); err != nil {
+			cancel()
+		}
+	}
+
+	sub := store.Broker.Subscriber()
+	defer sub.Close()
+
+	go func() {
+		for {
+			select {
+			case m := <-sub.Messages:
+				write(m)
+			case <-connCtx.Done():
+				return
+			}
+		}
+	}()
+
+	var name string // set by CLIENT SETNAME
+
+	for connCtx.Err() == nil {
+		args, err := redis_store.ReadCommand(r)
+		if err != nil {
+			if errors.Is(err, redis_store.ErrProtocol) {
+				write(fmt.Errorf("ERR Protocol error: %s", strings.TrimPrefix(err.Error(), "protocol error: ")))
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		cmd := strings.ToUpper(args[0])
+
+		if sub.Count() > 0 && !slices.Contains(subscribedCommands, cmd) {
+			write(fmt.Errorf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(args[0])))
+			continue
+		}
+
+		switch cmd {
+		case "QUIT":
+			write(redis_store.Status("OK"))
+			return
+
+		case "AUTH":
+			write(redis_store.Status("OK"))
+
+		case "HELLO":
+			// only RESP2 is spoken, clients fall back to it
+			if len(args) > 1 && args[1] != "2" {
+				write(errors.New("NOPROTO unsupported protocol version"))
+				continue
+			}
+			write([]any{"server", "redis", "version", redisVersion, "proto", 2, "id", 1, "mode", "standalone", "role", "master", "modules", []any{}})
+
+		case "SELECT":
+			if len(args) != 2 || args[1] != "0" {
+				write(errors.New("ERR DB index is out of range"))
+				continue
+			}
+			write(redis_store.Status("OK"))
+
+		case "CLIENT":
+			if len(args) < 2 {
+				write(errors.New("ERR wrong number of arguments for 'client' command"))
+				continue
+			}
+
+			// other subcommands, like SETINFO, change nothing
+			switch strings.ToUpper(args[1]) {
+			case "SETNAME":
+				if len(args) == 3 {
+					name = args[2]
+				}
+				write(redis_store.Status("OK"))
+			case "GETNAME":
+				if name == "" {
+					write(nil)
+					continue
+				}
+				write(name)
+			case "ID":
+				write(1)
+			default:
+				write(redis_store.Status("OK"))
+			}
+
+		case "INFO":
+			write(fmt.Sprintf("# Server\r\nredis_version:%s\r\nredis_mode:standalone\r\nexecutable:fake-ops\r\n", redisVersion))
+
+		case "COMMAND":
+			write([]any{})
+
+		case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+			var replies []any
+			switch cmd {
+			case "SUBSCRIBE", "PSUBSCRIBE":
+				if len(args) < 2 {
+					write(fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+					continue
+				}
+
+				if cmd == "SUBSCRIBE" {
+					replies = sub.Subscribe(args[1:])
+				} else {
+					replies = sub.PSubscribe(args[1:])
+				}
+				ctx.PublishFake("%s: %s %s", svc.Name, cmd, strings.Join(args[1:], " "))
+			case "UNSUBSCRIBE":
+				replies = sub.Unsubscribe(args[1:])
+			case "PUNSUBSCRIBE":
+				replies = sub.PUnsubscribe(args[1:])
+			}
+
+			for _, reply := range replies {
+				write(reply)
+			}
+
+		case "PING":
+			if sub.Count() > 0 {
+				message := ""
+				if len(args) > 1 {
+					message = args[1]
+				}
+				write([]any{"pong", message})
+				continue
+			}
+			write(store.Do(connCtx, args))
+
+		default:
+			reply := store.Do(connCtx, args)
+
+			// the key is enough to follow what is going on
+			command := cmd
+			if len(args) > 1 {
+				command += " " + args[1]
+			}
+
+			if err, ok := reply.(error); ok {
+				ctx.PublishInfo("%s: %s: %s", svc.Name, command, err)
+			} else {
+				ctx.PublishFake("%s: %s", svc.Name, command)
+			}
+
+			write(reply)
+		}
+	}
+}
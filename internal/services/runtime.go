@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/crit/fake-ops/internal/http_results"
+	"github.com/crit/fake-ops/internal/journal"
+	"github.com/crit/fake-ops/internal/mailbox"
+	"github.com/crit/fake-ops/internal/ratelimit"
+	"github.com/crit/fake-ops/internal/redis_store"
+)
+
+// Runtime holds the state of a service that is shared with the admin API. It
+// lives as long as the Manager, surviving restarts of the service.
+type Runtime struct {
+	mu     sync.RWMutex
+	routes []Route
+
+	// Journal records requests received by an HTTP service.
+	Journal *journal.Journal
+
+	// Mailbox keeps the messages received by an smtp service.
+	Mailbox *mailbox.Mailbox
+
+	// Redis keeps the keys of a redis service.
+	Redis *redis_store.Store
+}
+
+// NewRuntime creates a Runtime for the service.
+func NewRuntime(svc Service) *Runtime {
+	var size int
+	if svc.SMTP != nil {
+		size = svc.SMTP.Size
+	}
+
+	return &Runtime{
+		Journal: journal.New(svc.Journal),
+		Mailbox: mailbox.New(size),
+		Redis:   redis_store.New(),
+	}
+}
+
+// Reset clears state gathered while the service was running.
+func (rt *Runtime) Reset() error {
+	rt.Journal.Clear()
+
+	return errors.Join(rt.Mailbox.Clear(), rt.Redis.Reset())
+}
+
+// Route describes a response an HTTP service is currently serving.
+type Route struct {
+	Method      string              `json:"method"`
+	Path        string              `json:"path"`
+	Code        int                 `json:"code"`
+	ContentType string              `json:"contentType"`
+	File        string              `json:"file"`
+	Match       *http_results.Match `json:"match,omitempty"`
+	RateLimit   *ratelimit.Config   `json:"rateLimit,omitempty"`
+}
+
+// SetRoutes replaces the route table with the given results.
+func (rt *Runtime) SetRoutes(results []*http_results.Result) {
+	routes := make([]Route, 0, len(results))
+	for _, result := range results {
+		routes = append(routes, Route{
+			Method:      result.Method,
+			Path:        result.Path,
+			Code:        result.Code,
+			ContentType: result.ContentType,
+			File:        result.File,
+			Match:       result.Match,
+			RateLimit:   result.RateLimit,
+		})
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.routes = routes
+}
+
+// Routes returns the route table.
+func (rt *Runtime) Routes() []Route {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	return append([]Route(nil), rt.routes...)
+}
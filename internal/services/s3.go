@@ -0,0 +1,840 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/s3_store"
+	"github.com/gin-gonic/gin"
+)
+
+// s3Namespace is the XML namespace of S3 responses.
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// s3Headers are stored with an object and sent back when it is read.
+var s3Headers = []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Expires"}
+
+// s3Unsupported are subresources of buckets and objects the fake does not
+// implement, answered with NotImplemented instead of a listing or object.
+var s3Unsupported = []string{"acl", "cors", "encryption", "lifecycle", "logging", "notification", "object-lock",
+	"policy", "replication", "tagging", "uploads", "versions", "website", "attributes", "retention", "legal-hold"}
+
+// StartS3 runs a fake S3 API keeping buckets as folders and objects as files,
+// in the service's results folder unless configured otherwise. Any
+// credentials are accepted, presigned URLs until they expire.
+func StartS3(svc Service, ctx *app.Context) {
+	var cfg s3_store.Config
+	if svc.S3 != nil {
+		cfg = *svc.S3
+	}
+
+	if cfg.Dir == "" {
+		cfg.Dir = filepath.Join(ctx.Flags.Results, svc.Name)
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = s3_store.DefaultRegion
+	}
+
+	if cfg.Domain == "" {
+		cfg.Domain = s3_store.DefaultDomain
+	}
+
+	var tlsConfig *tls.Config
+	if svc.TLS != nil {
+		var err error
+		tlsConfig, err = svc.TLS.serverConfig(ctx)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to configure tls for service %s: %s", svc.Name, err)
+			return
+		}
+	}
+
+	store := s3_store.New(cfg.Dir)
+
+	healthy := true
+	problem := func(format string, args ...any) {
+		healthy = false
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError(format, args...)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		problem("failed to create directory %s: %s", cfg.Dir, err)
+	}
+
+	for _, bucket := range cfg.Buckets {
+		if err := store.CreateBucket(bucket); err != nil {
+			problem("failed to create bucket %s for service %s: %s", bucket, svc.Name, err)
+		}
+	}
+
+	h := &s3Handler{ctx: ctx, svc: svc, store: store, cfg: cfg}
+
+	g := gin.New()
+	g.Use(logRequests(ctx, svc.Name))
+	g.NoRoute(h.serve)
+
+	server := &http.Server{
+		Handler:   g,
+		TLSConfig: tlsConfig,
+		Protocols: protocols(svc),
+	}
+
+	ctx.PublishInfo("%s keeps its buckets in %s", svc.Name, cfg.Dir)
+	serveHTTP(ctx, svc, server)
+
+	if healthy {
+		ctx.PublishServiceOnline(svc.Name)
+	}
+
+	// wait for termination
+	<-ctx.Done()
+
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	if err := server.Close(); err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("error stopping server: %s", err)
+	} else {
+		ctx.PublishServiceOffline(svc.Name)
+	}
+}
+
+// s3Handler answers the S3 REST API from a store.
+type s3Handler struct {
+	ctx   *app.Context
+	svc   Service
+	store *s3_store.Store
+	cfg   s3_store.Config
+}
+
+// serve routes a request to the operation it names by method, bucket, key
+// and query.
+func (h *s3Handler) serve(c *gin.Context) {
+	// give up when the client goes away or the service stops
+	if !wait(c.Request.Context().Done(), h.svc.Delay) {
+		return
+	}
+
+	c.Set(sourceKey, sourceFake)
+
+	r := c.Request
+	q := r.URL.Query()
+	bucket, key := h.target(r)
+
+	if presignExpired(q, time.Now()) {
+		h.fail(c, http.StatusForbidden, "AccessDenied", "Request has expired")
+		return
+	}
+
+	for _, sub := range s3Unsupported {
+		if q.Has(sub) && !(sub == "uploads" && r.Method == http.MethodPost) {
+			h.fail(c, http.StatusNotImplemented, "NotImplemented", "?"+sub+" is not implemented by fake-ops")
+			return
+		}
+	}
+
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		h.listBuckets(c)
+
+	case bucket == "":
+		h.fail(c, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+
+	case key == "":
+		switch r.Method {
+		case http.MethodGet:
+			switch {
+			case q.Has("location"):
+				h.getLocation(c, bucket)
+			case q.Has("versioning"):
+				h.getVersioning(c, bucket)
+			default:
+				h.listObjects(c, bucket)
+			}
+		case http.MethodHead:
+			h.result(c, h.store.HasBucket(bucket), http.StatusOK)
+		case http.MethodPut:
+			c.Header("Location", "/"+bucket)
+			h.result(c, h.store.CreateBucket(bucket), http.StatusOK)
+		case http.MethodDelete:
+			h.result(c, h.store.DeleteBucket(bucket), http.StatusNoContent)
+		case http.MethodPost:
+			if q.Has("delete") {
+				h.deleteObjects(c, bucket)
+				return
+			}
+			h.fail(c, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+		default:
+			h.fail(c, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+		}
+
+	default:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.getObject(c, bucket, key)
+		case http.MethodPut:
+			switch {
+			case q.Has("uploadId"):
+				h.uploadPart(c)
+			case r.Header.Get("X-Amz-Copy-Source") != "":
+				h.copyObject(c, bucket, key)
+			default:
+				h.putObject(c, bucket, key)
+			}
+		case http.MethodPost:
+			switch {
+			case q.Has("uploads"):
+				h.createUpload(c, bucket, key)
+			case q.Has("uploadId"):
+				h.completeUpload(c, bucket, key)
+			default:
+				h.fail(c, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+			}
+		case http.MethodDelete:
+			if q.Has("uploadId") {
+				h.result(c, h.store.AbortUpload(q.Get("uploadId")), http.StatusNoContent)
+				return
+			}
+			h.result(c, h.store.Delete(bucket, key), http.StatusNoContent)
+		default:
+			h.fail(c, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+		}
+	}
+}
+
+// target reads the bucket and key of a request, from the host for
+// virtual-hosted style requests or from the path.
+func (h *s3Handler) target(r *http.Request) (string, string) {
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+
+	if bucket, ok := strings.CutSuffix(host, "."+h.cfg.Domain); ok {
+		return bucket, path
+	}
+
+	bucket, key, _ := strings.Cut(path, "/")
+
+	return bucket, key
+}
+
+// presignExpired reports whether a presigned URL, signed with version 4 or
+// 2, has expired. Signatures themselves are not checked.
+func presignExpired(q url.Values, now time.Time) bool {
+	if date := q.Get("X-Amz-Date"); date != "" && q.Has("X-Amz-Expires") {
+		signed, err := time.Parse("20060102T150405Z", date)
+		seconds, err2 := strconv.Atoi(q.Get("X-Amz-Expires"))
+		if err != nil || err2 != nil {
+			return true
+		}
+
+		return now.After(signed.Add(time.Duration(seconds) * time.Second))
+	}
+
+	if expires := q.Get("Expires"); expires != "" && q.Has("Signature") {
+		unix, err := strconv.ParseInt(expires, 10, 64)
+		return err != nil || now.Unix() > unix
+	}
+
+	return false
+}
+
+// s3Error is the body of an error response.
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// fail writes an error response.
+func (h *s3Handler) fail(c *gin.Context, status int, code, message string) {
+	c.XML(status, s3Error{Code: code, Message: message, Resource: c.Request.URL.Path, RequestID: requestID()})
+}
+
+// failWith writes the error response for an error of the store.
+func (h *s3Handler) failWith(c *gin.Context, err error) {
+	codes := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{s3_store.ErrNoSuchBucket, http.StatusNotFound, "NoSuchBucket"},
+		{s3_store.ErrNoSuchKey, http.StatusNotFound, "NoSuchKey"},
+		{s3_store.ErrNoSuchUpload, http.StatusNotFound, "NoSuchUpload"},
+		{s3_store.ErrBucketNotEmpty, http.StatusConflict, "BucketNotEmpty"},
+		{s3_store.ErrInvalidBucketName, http.StatusBadRequest, "InvalidBucketName"},
+		{s3_store.ErrInvalidKey, http.StatusBadRequest, "InvalidArgument"},
+		{s3_store.ErrInvalidPart, http.StatusBadRequest, "InvalidPart"},
+		{s3_store.ErrInvalidPartOrder, http.StatusBadRequest, "InvalidPartOrder"},
+	}
+
+	for _, code := range codes {
+		if errors.Is(err, code.err) {
+			h.fail(c, code.status, code.code, err.Error())
+			return
+		}
+	}
+
+	h.ctx.PublishError("%s: %s %s failed: %s", h.svc.Name, c.Request.Method, c.Request.URL.Path, err)
+	h.fail(c, http.StatusInternalServerError, "InternalError", err.Error())
+}
+
+// result answers with status, or the error response for err.
+func (h *s3Handler) result(c *gin.Context, err error, status int) {
+	if err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	c.Status(status)
+}
+
+// requestID makes up the id of a request, sent back with errors.
+func requestID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// s3Time formats times like S3 listings.
+func s3Time(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// quote wraps an ETag in quotes, like S3 sends them.
+func quote(etag string) string {
+	return `"` + etag + `"`
+}
+
+func (h *s3Handler) listBuckets(c *gin.Context) {
+	buckets, err := h.store.Buckets()
+	if err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	type bucket struct {
+		Name         string `xml:"Name"`
+		CreationDate string `xml:"CreationDate"`
+	}
+
+	res := struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Owner   struct {
+			ID          string `xml:"ID"`
+			DisplayName string `xml:"DisplayName"`
+		} `xml:"Owner"`
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{Xmlns: s3Namespace}
+
+	res.Owner.ID, res.Owner.DisplayName = "fake-ops", "fake-ops"
+	for _, b := range buckets {
+		res.Buckets = append(res.Buckets, bucket{Name: b.Name, CreationDate: s3Time(b.Created)})
+	}
+
+	c.XML(http.StatusOK, res)
+}
+
+func (h *s3Handler) getLocation(c *gin.Context, bucket string) {
+	if err := h.store.HasBucket(bucket); err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	// us-east-1 is reported as no location
+	region := h.cfg.Region
+	if region == "us-east-1" {
+		region = ""
+	}
+
+	c.XML(http.StatusOK, struct {
+		XMLName xml.Name `xml:"LocationConstraint"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Region  string   `xml:",chardata"`
+	}{Xmlns: s3Namespace, Region: region})
+}
+
+func (h *s3Handler) getVersioning(c *gin.Context, bucket string) {
+	if err := h.store.HasBucket(bucket); err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	// buckets are never versioned
+	c.XML(http.StatusOK, struct {
+		XMLName xml.Name `xml:"VersioningConfiguration"`
+		Xmlns   string   `xml:"xmlns,attr"`
+	}{Xmlns: s3Namespace})
+}
+
+// s3Contents describes an object in a listing.
+type s3Contents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// s3Prefix is a common prefix in a listing.
+type s3Prefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listObjects answers ListObjectsV2, or ListObjects without list-type=2.
+// Continuation tokens are the key to continue after.
+func (h *s3Handler) listObjects(c *gin.Context, bucket string) {
+	q := c.Request.URL.Query()
+	v2 := q.Get("list-type") == "2"
+
+	query := s3_store.ListQuery{
+		Prefix:    q.Get("prefix"),
+		Delimiter: q.Get("delimiter"),
+	}
+
+	if maxKeys := q.Get("max-keys"); maxKeys != "" {
+		n, err := strconv.Atoi(maxKeys)
+		if err != nil || n < 0 {
+			h.fail(c, http.StatusBadRequest, "InvalidArgument", "invalid max-keys: "+maxKeys)
+			return
+		}
+
+		// asking for none lists none
+		if query.MaxKeys = n; n == 0 {
+			query.MaxKeys = -1
+		}
+	}
+
+	if v2 {
+		query.StartAfter = q.Get("start-after")
+		if token := q.Get("continuation-token"); token != "" {
+			after, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				h.fail(c, http.StatusBadRequest, "InvalidArgument", "invalid continuation-token")
+				return
+			}
+			query.StartAfter = string(after)
+		}
+	} else {
+		query.StartAfter = q.Get("marker")
+	}
+
+	var res *s3_store.ListResult
+	var err error
+	if query.MaxKeys == -1 {
+		err = h.store.HasBucket(bucket)
+		res = &s3_store.ListResult{}
+	} else {
+		res, err = h.store.List(bucket, query)
+	}
+	if err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	maxKeys := query.MaxKeys
+	switch {
+	case maxKeys == -1:
+		maxKeys = 0
+	case maxKeys == 0:
+		maxKeys = 1000
+	}
+
+	body := struct {
+		XMLName               xml.Name     `xml:"ListBucketResult"`
+		Xmlns                 string       `xml:"xmlns,attr"`
+		Name                  string       `xml:"Name"`
+		Prefix                string       `xml:"Prefix"`
+		Delimiter             string       `xml:"Delimiter,omitempty"`
+		Marker                *string      `xml:"Marker"`
+		NextMarker            string       `xml:"NextMarker,omitempty"`
+		StartAfter            string       `xml:"StartAfter,omitempty"`
+		ContinuationToken     string       `xml:"ContinuationToken,omitempty"`
+		NextContinuationToken string       `xml:"NextContinuationToken,omitempty"`
+		KeyCount              *int         `xml:"KeyCount"`
+		MaxKeys               int          `xml:"MaxKeys"`
+		IsTruncated           bool         `xml:"IsTruncated"`
+		Contents              []s3Contents `xml:"Contents"`
+		CommonPrefixes        []s3Prefix   `xml:"CommonPrefixes"`
+	}{
+		Xmlns:       s3Namespace,
+		Name:        bucket,
+		Prefix:      query.Prefix,
+		Delimiter:   query.Delimiter,
+		MaxKeys:     maxKeys,
+		IsTruncated: res.Truncated,
+	}
+
+	for _, o := range res.Objects {
+		body.Contents = append(body.Contents, s3Contents{
+			Key:          o.Key,
+			LastModified: s3Time(o.LastModified),
+			ETag:         quote(o.ETag),
+			Size:         o.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+
+	for _, p := range res.CommonPrefixes {
+		body.CommonPrefixes = append(body.CommonPrefixes, s3Prefix{Prefix: p})
+	}
+
+	if v2 {
+		count := len(body.Contents) + len(body.CommonPrefixes)
+		body.KeyCount = &count
+		body.StartAfter = q.Get("start-after")
+		body.ContinuationToken = q.Get("continuation-token")
+		if res.Truncated {
+			body.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(res.NextStartAfter))
+		}
+	} else {
+		marker := query.StartAfter
+		body.Marker = &marker
+		if res.Truncated && query.Delimiter != "" {
+			body.NextMarker = res.NextStartAfter
+		}
+	}
+
+	c.XML(http.StatusOK, body)
+}
+
+// objectHeaders writes the headers describing an object.
+func objectHeaders(c *gin.Context, o *s3_store.Object) {
+	c.Header("ETag", quote(o.ETag))
+	c.Header("Content-Type", o.ContentType)
+	c.Header("Accept-Ranges", "bytes")
+
+	for name, value := range o.Headers {
+		c.Header(name, value)
+	}
+
+	for name, value := range o.Metadata {
+		c.Header("X-Amz-Meta-"+name, value)
+	}
+}
+
+// getObject answers GetObject and HeadObject, with ranges and conditions.
+func (h *s3Handler) getObject(c *gin.Context, bucket, key string) {
+	o, err := h.store.Head(bucket, key)
+	if err != nil {
+		if c.Request.Method == http.MethodHead {
+			// HEAD responses have no body to tell what is missing
+			if errors.Is(err, s3_store.ErrNoSuchKey) || errors.Is(err, s3_store.ErrNoSuchBucket) {
+				c.Status(http.StatusNotFound)
+				return
+			}
+		}
+		h.failWith(c, err)
+		return
+	}
+
+	objectHeaders(c, o)
+
+	// presigned URLs can choose some response headers
+	q := c.Request.URL.Query()
+	for _, name := range []string{"Content-Type", "Content-Disposition", "Cache-Control", "Content-Encoding", "Content-Language", "Expires"} {
+		if value := q.Get("response-" + strings.ToLower(name)); value != "" {
+			c.Header(name, value)
+		}
+	}
+
+	var content io.ReadSeeker = bytes.NewReader(nil)
+	if !strings.HasSuffix(key, "/") {
+		f, err := o.Open()
+		if err != nil {
+			h.failWith(c, err)
+			return
+		}
+		defer f.Close()
+		content = f
+	}
+
+	http.ServeContent(c.Writer, c.Request, "", o.LastModified, content)
+}
+
+// objectInfo reads what is stored with an object from the request headers.
+func objectInfo(r *http.Request) s3_store.Info {
+	info := s3_store.Info{
+		ContentType: r.Header.Get("Content-Type"),
+		Headers:     make(map[string]string),
+		Metadata:    make(map[string]string),
+	}
+
+	for _, name := range s3Headers {
+		if value := r.Header.Get(name); value != "" {
+			info.Headers[name] = value
+		}
+	}
+
+	// aws-chunked is how the body was sent, not what it is
+	if encoding := info.Headers["Content-Encoding"]; encoding != "" {
+		var kept []string
+		for _, e := range strings.Split(encoding, ",") {
+			if e = strings.TrimSpace(e); e != "aws-chunked" {
+				kept = append(kept, e)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(info.Headers, "Content-Encoding")
+		} else {
+			info.Headers["Content-Encoding"] = strings.Join(kept, ", ")
+		}
+	}
+
+	for name, values := range r.Header {
+		if meta, ok := strings.CutPrefix(name, "X-Amz-Meta-"); ok && len(values) > 0 {
+			info.Metadata[strings.ToLower(meta)] = values[0]
+		}
+	}
+
+	return info
+}
+
+// objectBody returns the content of an upload, decoding aws-chunked bodies
+// sent by the AWS SDKs.
+func objectBody(r *http.Request) io.Reader {
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") ||
+		strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return &awsChunked{r: bufio.NewReader(r.Body)}
+	}
+
+	return r.Body
+}
+
+// awsChunked reads the content of an aws-chunked body, dropping the chunk
+// sizes, signatures and trailers.
+type awsChunked struct {
+	r    *bufio.Reader
+	left int64
+	done bool
+}
+
+func (a *awsChunked) Read(p []byte) (int, error) {
+	for a.left == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+
+		line, err := a.r.ReadString('\n')
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		// the line ending after a chunk's data
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		if size == "" {
+			continue
+		}
+
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid aws-chunked chunk size %q", size)
+		}
+
+		if n == 0 {
+			a.done = true
+			return 0, io.EOF
+		}
+		a.left = n
+	}
+
+	if int64(len(p)) > a.left {
+		p = p[:a.left]
+	}
+
+	n, err := a.r.Read(p)
+	a.left -= int64(n)
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+func (h *s3Handler) putObject(c *gin.Context, bucket, key string) {
+	o, err := h.store.Put(bucket, key, objectBody(c.Request), objectInfo(c.Request))
+	if err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	c.Header("ETag", quote(o.ETag))
+	c.Status(http.StatusOK)
+}
+
+func (h *s3Handler) copyObject(c *gin.Context, bucket, key string) {
+	source, _, _ := strings.Cut(c.Request.Header.Get("X-Amz-Copy-Source"), "?")
+	if unescaped, err := url.PathUnescape(source); err == nil {
+		source = unescaped
+	}
+
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	// the copy keeps the source's info unless told to replace it
+	var info *s3_store.Info
+	if strings.EqualFold(c.Request.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		replaced := objectInfo(c.Request)
+		info = &replaced
+	}
+
+	o, err := h.store.Copy(srcBucket, srcKey, bucket, key, info)
+	if err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	c.XML(http.StatusOK, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		Xmlns        string   `xml:"xmlns,attr"`
+		LastModified string   `xml:"LastModified"`
+		ETag         string   `xml:"ETag"`
+	}{Xmlns: s3Namespace, LastModified: s3Time(o.LastModified), ETag: quote(o.ETag)})
+}
+
+func (h *s3Handler) deleteObjects(c *gin.Context, bucket string) {
+	var req struct {
+		Quiet   bool `xml:"Quiet"`
+		Objects []struct {
+			Key string `xml:"Key"`
+		} `xml:"Object"`
+	}
+
+	if err := xml.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		h.fail(c, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	type deleted struct {
+		Key string `xml:"Key"`
+	}
+
+	type failed struct {
+		Key     string `xml:"Key"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	res := struct {
+		XMLName xml.Name  `xml:"DeleteResult"`
+		Xmlns   string    `xml:"xmlns,attr"`
+		Deleted []deleted `xml:"Deleted"`
+		Errors  []failed  `xml:"Error"`
+	}{Xmlns: s3Namespace}
+
+	for _, o := range req.Objects {
+		if err := h.store.Delete(bucket, o.Key); err != nil {
+			res.Errors = append(res.Errors, failed{Key: o.Key, Code: "InternalError", Message: err.Error()})
+			continue
+		}
+
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, deleted{Key: o.Key})
+		}
+	}
+
+	c.XML(http.StatusOK, res)
+}
+
+func (h *s3Handler) createUpload(c *gin.Context, bucket, key string) {
+	id, err := h.store.CreateUpload(bucket, key, objectInfo(c.Request))
+	if err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	c.XML(http.StatusOK, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: id})
+}
+
+func (h *s3Handler) uploadPart(c *gin.Context) {
+	q := c.Request.URL.Query()
+
+	number, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, "InvalidArgument", "invalid partNumber: "+q.Get("partNumber"))
+		return
+	}
+
+	etag, err := h.store.UploadPart(q.Get("uploadId"), number, objectBody(c.Request))
+	if err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	c.Header("ETag", quote(etag))
+	c.Status(http.StatusOK)
+}
+
+func (h *s3Handler) completeUpload(c *gin.Context, bucket, key string) {
+	var req struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+
+	if err := xml.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		h.fail(c, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	parts := make([]s3_store.Part, 0, len(req.Parts))
+	for _, p := range req.Parts {
+		parts = append(parts, s3_store.Part{Number: p.PartNumber, ETag: p.ETag})
+	}
+
+	o, err := h.store.CompleteUpload(c.Request.URL.Query().Get("uploadId"), parts)
+	if err != nil {
+		h.failWith(c, err)
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	c.XML(http.StatusOK, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Location string   `xml:"Location"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		ETag     string   `xml:"ETag"`
+	}{
+		Xmlns:    s3Namespace,
+		Location: fmt.Sprintf("%s://%s/%s/%s", scheme, c.Request.Host, bucket, key),
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     quote(o.ETag),
+	})
+}
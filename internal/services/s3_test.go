@@ -0,0 +1,63 @@
+package services
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/crit/fake-ops/internal/s3_store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresignExpired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		query   string
+		expired bool
+	}{
+		"not presigned":        {query: ""},
+		"v4 valid":             {query: "X-Amz-Date=20240501T115500Z&X-Amz-Expires=600"},
+		"v4 expired":           {query: "X-Amz-Date=20240501T114000Z&X-Amz-Expires=600", expired: true},
+		"v4 invalid date":      {query: "X-Amz-Date=yesterday&X-Amz-Expires=600", expired: true},
+		"v4 invalid expires":   {query: "X-Amz-Date=20240501T115500Z&X-Amz-Expires=soon", expired: true},
+		"v4 without expires":   {query: "X-Amz-Date=20240501T000000Z"},
+		"v2 valid":             {query: "Expires=1714568400&Signature=x"},
+		"v2 expired":           {query: "Expires=1714561200&Signature=x", expired: true},
+		"v2 invalid expires":   {query: "Expires=soon&Signature=x", expired: true},
+		"v2 without signature": {query: "Expires=1714561200"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			q, err := url.ParseQuery(tc.query)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expired, presignExpired(q, now))
+		})
+	}
+}
+
+func TestS3Target(t *testing.T) {
+	h := &s3Handler{cfg: s3_store.Config{Domain: s3_store.DefaultDomain}}
+
+	tests := map[string]struct {
+		url         string
+		bucket, key string
+	}{
+		"service":        {url: "http://localhost:9000/"},
+		"path bucket":    {url: "http://localhost:9000/photos", bucket: "photos"},
+		"path object":    {url: "http://localhost:9000/photos/2024/cat.jpg", bucket: "photos", key: "2024/cat.jpg"},
+		"virtual bucket": {url: "http://photos." + s3_store.DefaultDomain + ":9000/", bucket: "photos"},
+		"virtual object": {url: "http://photos." + s3_store.DefaultDomain + "/2024/cat.jpg", bucket: "photos", key: "2024/cat.jpg"},
+		"other domain":   {url: "http://photos.example.com/docs/a.txt", bucket: "docs", key: "a.txt"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			bucket, key := h.target(httptest.NewRequest("GET", tc.url, nil))
+			assert.Equal(t, tc.bucket, bucket)
+			assert.Equal(t, tc.key, key)
+		})
+	}
+}
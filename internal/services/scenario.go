@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/crit/fake-ops/internal/http_results"
+	"gopkg.in/yaml.v3"
+)
+
+// ScenariosDir is the folder inside the results directory holding scenarios.
+const ScenariosDir = "_scenarios"
+
+// Scenario is parsed from the optional scenario.yaml inside a scenario folder.
+// Each entry under services is applied on top of that service's yaml file.
+type Scenario struct {
+	Name     string
+	Services map[string]yaml.Node `yaml:"services"`
+}
+
+// ListScenarios returns the name of every scenario folder in the results
+// directory.
+func ListScenarios(resultsPath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(resultsPath, ScenariosDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// LoadScenario reads the named scenario from the results directory. An empty
+// name loads an empty scenario that changes nothing.
+func LoadScenario(resultsPath, name string) (*Scenario, error) {
+	scenario := Scenario{Name: name}
+	if name == "" {
+		return &scenario, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(resultsPath, ScenariosDir, name, "scenario.yaml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return &scenario, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %s", name, err)
+	}
+
+	return &scenario, nil
+}
+
+// Apply returns a copy of svc with the scenario's settings for it applied.
+// The settings go on top of a fresh decode of the service's yaml file, as
+// decoding into svc would change the maps and pointers it shares with the
+// caller.
+func (s *Scenario) Apply(svc Service) (Service, error) {
+	node, ok := s.Services[svc.Name]
+	if !ok {
+		return svc, nil
+	}
+
+	applied := svc
+	if svc.source != nil {
+		applied = Service{source: svc.source, Runtime: svc.Runtime}
+		if err := yaml.Unmarshal(svc.source, &applied); err != nil {
+			return svc, fmt.Errorf("failed to apply scenario %s to %s: %s", s.Name, svc.Name, err)
+		}
+	}
+
+	if err := node.Decode(&applied); err != nil {
+		return svc, fmt.Errorf("failed to apply scenario %s to %s: %s", s.Name, svc.Name, err)
+	}
+
+	return applied, nil
+}
+
+// ScenarioResultsPath is the folder holding a scenario's response files for
+// a service.
+func ScenarioResultsPath(resultsPath, scenario, service string) string {
+	return filepath.Join(resultsPath, ScenariosDir, scenario, service)
+}
+
+// overlay replaces every result in base serving a method and path that over
+// also serves with the results from over.
+func overlay(base, over []*http_results.Result) []*http_results.Result {
+	replaced := make(map[string]bool, len(over))
+	for _, o := range over {
+		replaced[o.Method+" "+o.Path] = true
+	}
+
+	var merged []*http_results.Result
+	for _, b := range base {
+		if !replaced[b.Method+" "+b.Path] {
+			merged = append(merged, b)
+		}
+	}
+
+	return append(merged, over...)
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScenarioApply(t *testing.T) {
+	svc, err := NewService([]byte(`name: payments
+type: http
+port: 3001
+tls:
+  hosts: [payments.local]
+auth:
+  basic:
+    users: {ada: secret}
+rateLimit:
+  limit: 10
+  window: 1m
+`))
+	require.Nil(t, err, "error parsing service")
+
+	results := t.TempDir()
+	dir := filepath.Join(results, ScenariosDir, "locked")
+	require.Nil(t, os.MkdirAll(dir, 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "scenario.yaml"), []byte(`services:
+  payments:
+    port: 3002
+    tls:
+      hosts: [locked.local]
+    auth:
+      basic:
+        users: {bob: hunter2}
+    rateLimit:
+      limit: 1
+`), 0644))
+
+	locked, err := LoadScenario(results, "locked")
+	require.Nil(t, err, "error loading scenario")
+
+	applied, err := locked.Apply(*svc)
+	require.Nil(t, err, "error applying scenario")
+
+	assert.Equal(t, 3002, applied.Port)
+	assert.Equal(t, []string{"locked.local"}, applied.TLS.Hosts)
+	assert.Equal(t, map[string]string{"ada": "secret", "bob": "hunter2"}, applied.Auth.Basic.Users, "scenario users are added")
+	assert.Equal(t, 1, applied.RateLimit.Limit)
+
+	// the service itself keeps its own settings
+	assert.Equal(t, 3001, svc.Port)
+	assert.Equal(t, []string{"payments.local"}, svc.TLS.Hosts)
+	assert.Equal(t, map[string]string{"ada": "secret"}, svc.Auth.Basic.Users)
+	assert.Equal(t, 10, svc.RateLimit.Limit)
+
+	// switching back to the base results restores them
+	base, err := LoadScenario(results, "")
+	require.Nil(t, err, "error loading base results")
+
+	restored, err := base.Apply(*svc)
+	require.Nil(t, err, "error applying base results")
+	assert.Equal(t, *svc, restored)
+
+	again, err := locked.Apply(restored)
+	require.Nil(t, err, "error applying scenario again")
+	assert.Equal(t, applied, again)
+}
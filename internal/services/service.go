@@ -4,17 +4,35 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/dns_zone"
+	"github.com/crit/fake-ops/internal/graphql"
 	"github.com/crit/fake-ops/internal/http_results"
+	"github.com/crit/fake-ops/internal/mailbox"
+	"github.com/crit/fake-ops/internal/oidc"
+	"github.com/crit/fake-ops/internal/ratelimit"
+	"github.com/crit/fake-ops/internal/redis_store"
+	"github.com/crit/fake-ops/internal/s3_store"
 	"gopkg.in/yaml.v3"
 )
 
 type Type string
 
 const (
-	ServiceHTTP Type = "http"
-	ServiceApp  Type = "app"
+	ServiceHTTP      Type = "http"
+	ServiceApp       Type = "app"
+	ServiceOIDC      Type = "oidc"
+	ServiceGraphQL   Type = "graphql"
+	ServiceGRPC      Type = "grpc"
+	ServiceWebSocket Type = "websocket"
+	ServiceTCP       Type = "tcp"
+	ServiceUDP       Type = "udp"
+	ServiceSMTP      Type = "smtp"
+	ServiceDNS       Type = "dns"
+	ServiceS3        Type = "s3"
+	ServiceRedis     Type = "redis"
 )
 
 // Service is parsed from a service yaml file.
@@ -27,13 +45,69 @@ type Service struct {
 	Stdout bool   `yaml:"stdout"`
 	Stderr bool   `yaml:"stderr"`
 
+	// Listen lists the addresses an HTTP service listens on, such as
+	// 127.0.0.1:3001, [::1]:3001 or unix:/tmp/payments.sock. Defaults to the
+	// port on all interfaces.
+	Listen []string `yaml:"listen"`
+
+	// Delay is how long an HTTP service waits before every response.
+	Delay time.Duration `yaml:"delay"`
+
+	// Journal is how many requests an HTTP service remembers.
+	Journal int `yaml:"journal"`
+
+	// Upstream is the URL of the real service behind an HTTP service.
+	Upstream string `yaml:"upstream"`
+
+	// Record forwards every request to Upstream and writes the responses to
+	// response files instead of serving them.
+	Record bool `yaml:"record"`
+
+	// TLS serves an HTTP service over HTTPS when set.
+	TLS *TLSConfig `yaml:"tls"`
+
+	// Auth requires credentials from requests to an HTTP service when set.
+	Auth *AuthConfig `yaml:"auth"`
+
+	// RateLimit answers requests to an HTTP service over the limit with a 429.
+	RateLimit *ratelimit.Config `yaml:"rateLimit"`
+
+	// HTTP2 serves an HTTP service over HTTP/2 as well as HTTP/1.1: negotiated
+	// over TLS, or with prior knowledge (h2c) over cleartext.
+	HTTP2 bool `yaml:"http2"`
+
+	// OIDC configures the clients and users of an oidc service.
+	OIDC *oidc.Config `yaml:"oidc"`
+
+	// GraphQL configures where a graphql service answers and whether it
+	// mocks operations without a response file.
+	GraphQL *graphql.Config `yaml:"graphql"`
+
+	// SMTP configures where an smtp service stores the messages it receives.
+	SMTP *mailbox.Config `yaml:"smtp"`
+
+	// DNS configures the zone file of a dns service and the records it makes
+	// up for running services.
+	DNS *dns_zone.Config `yaml:"dns"`
+
+	// S3 configures the folder and buckets of an s3 service.
+	S3 *s3_store.Config `yaml:"s3"`
+
+	// Redis configures the seed file of a redis service.
+	Redis *redis_store.Config `yaml:"redis"`
+
 	Files     []string
 	Responses []*http_results.Result
+	Runtime   *Runtime `yaml:"-"`
+
+	// source is the yaml the service was read from, decoded again for every
+	// scenario applied to it.
+	source []byte
 }
 
 // NewService takes in the content of a service yaml file and creates a Service.
 func NewService(data []byte) (*Service, error) {
-	var service Service
+	service := Service{source: data}
 
 	err := yaml.Unmarshal(data, &service)
 	if err != nil {
@@ -43,20 +117,61 @@ func NewService(data []byte) (*Service, error) {
 	return &service, nil
 }
 
-// Run backgrounds an appropriate routine based on the Service type.
-func Run(ctx *app.Context, service Service) error {
+// Run backgrounds an appropriate routine based on the Service type, unless
+// the service is skipped. The returned channel is closed once the routine has
+// stopped.
+func Run(ctx *app.Context, service Service) (<-chan struct{}, error) {
+	var start func(Service, *app.Context)
+
 	switch service.Type {
 	case ServiceHTTP:
-		ctx.PublishService("http", service.Name, service.Port)
-		go StartHTTP(service, ctx)
+		start = StartHTTP
 	case ServiceApp:
-		ctx.PublishService("app", service.Name, service.Port)
-		go StartApp(service, ctx)
+		start = StartApp
+	case ServiceOIDC:
+		start = StartOIDC
+	case ServiceGraphQL:
+		start = StartGraphQL
+	case ServiceGRPC:
+		start = StartGRPC
+	case ServiceWebSocket:
+		start = StartWebSocket
+	case ServiceTCP, ServiceUDP:
+		start = StartSocket
+	case ServiceSMTP:
+		start = StartSMTP
+	case ServiceDNS:
+		start = StartDNS
+	case ServiceS3:
+		start = StartS3
+	case ServiceRedis:
+		start = StartRedis
 	default:
-		return fmt.Errorf("unsupported service type: %s\n", service.Type)
+		return nil, fmt.Errorf("unsupported service type: %s", service.Type)
+	}
+
+	var addresses []string
+	if len(service.Listen) > 0 {
+		addresses = listenAddresses(service)
+	}
+
+	ctx.PublishService(string(service.Type), service.Name, service.Port, addresses...)
+
+	done := make(chan struct{})
+
+	// skipped services are listed without running
+	if service.Skip {
+		ctx.PublishInfo("skipping %s", service.Name)
+		close(done)
+		return done, nil
 	}
 
-	return nil
+	go func() {
+		defer close(done)
+		start(service, ctx)
+	}()
+
+	return done, nil
 }
 
 // List uses app.Context's flags to list all services in the service directory.
@@ -72,7 +187,8 @@ func List(ctx *app.Context) ([]Service, error) {
 	var list []Service
 
 	for _, file := range files {
-		if file.IsDir() {
+		// zone files of dns services sit next to the services
+		if file.IsDir() || filepath.Ext(file.Name()) == dns_zone.Extension {
 			continue
 		}
 
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/mailbox"
+)
+
+// maxMessageSize is the largest message an smtp service accepts.
+const maxMessageSize = 25 << 20
+
+// StartSMTP runs a fake SMTP server accepting every message sent to it into
+// the service's mailbox. Messages are never delivered.
+func StartSMTP(svc Service, ctx *app.Context) {
+	config := svc.SMTP
+	if config == nil {
+		config = &mailbox.Config{}
+	}
+
+	// STARTTLS is offered when the service has tls
+	var tlsConfig *tls.Config
+	if svc.TLS != nil {
+		var err error
+		tlsConfig, err = svc.TLS.serverConfig(ctx)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to configure tls for service %s: %s", svc.Name, err)
+			return
+		}
+	}
+
+	mb := svc.Runtime.Mailbox
+
+	healthy := true
+	if err := mb.Open(config.Dir); err != nil {
+		healthy = false
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("failed to load messages of service %s from %s: %s", svc.Name, config.Dir, err)
+	}
+
+	var listeners []net.Listener
+	for _, address := range listenAddresses(svc) {
+		l, err := listen(address)
+		if err != nil {
+			healthy = false
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("server error: %s", err)
+			continue
+		}
+
+		ctx.PublishInfo("starting service %s on %s (smtp)", svc.Name, address)
+		listeners = append(listeners, l)
+
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					if !errors.Is(err, net.ErrClosed) {
+						ctx.PublishServiceError(svc.Name)
+						ctx.PublishError("server error: %s", err)
+					}
+					return
+				}
+
+				// stop with the service
+				stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+
+				go func() {
+					defer stop()
+					converseSMTP(ctx, svc, mb, conn, tlsConfig)
+				}()
+			}
+		}()
+	}
+
+	if healthy {
+		ctx.PublishServiceOnline(svc.Name)
+	}
+
+	// wait for termination
+	<-ctx.Done()
+
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+
+	ctx.PublishServiceOffline(svc.Name)
+}
+
+// converseSMTP answers the commands of one SMTP client until it quits or
+// goes away. Any credentials are accepted, once the client has said hello
+// and, when the service has tls, started it.
+func converseSMTP(ctx *app.Context, svc Service, mb *mailbox.Mailbox, conn net.Conn, tlsConfig *tls.Config) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	reply := func(code int, text string) {
+		_ = tp.PrintfLine("%d %s", code, text)
+	}
+
+	var hello, secure, mailing bool
+	var from string
+	var to []string
+
+	reset := func() {
+		mailing, from, to = false, "", nil
+	}
+
+	reply(220, svc.Name+" ESMTP fake-ops")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			hello = true
+			reset()
+			reply(250, svc.Name)
+
+		case "EHLO":
+			hello = true
+			reset()
+
+			extensions := []string{svc.Name, "PIPELINING", "8BITMIME", fmt.Sprintf("SIZE %d", maxMessageSize)}
+			if tlsConfig != nil && !secure {
+				// credentials only go over tls when the service has it
+				extensions = append(extensions, "STARTTLS")
+			} else {
+				extensions = append(extensions, "AUTH PLAIN LOGIN")
+			}
+
+			for i, ext := range extensions {
+				sep := "-"
+				if i == len(extensions)-1 {
+					sep = " "
+				}
+				_ = tp.PrintfLine("250%s%s", sep, ext)
+			}
+
+		case "STARTTLS":
+			if tlsConfig == nil || secure {
+				reply(502, "STARTTLS not available")
+				continue
+			}
+
+			reply(220, "ready to start tls")
+
+			tlsConn := tls.Server(conn, tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				ctx.PublishInfo("%s: tls handshake with %s failed: %s", svc.Name, conn.RemoteAddr(), err)
+				return
+			}
+
+			conn, tp = tlsConn, textproto.NewConn(tlsConn)
+			secure, hello = true, false
+			reset()
+
+		case "AUTH":
+			switch {
+			case !hello:
+				reply(503, "send HELO or EHLO first")
+				continue
+			case tlsConfig != nil && !secure:
+				reply(530, "must issue a STARTTLS command first")
+				continue
+			}
+
+			mechanism, initial, _ := strings.Cut(arg, " ")
+
+			var prompts []string
+			switch strings.ToUpper(mechanism) {
+			case "PLAIN":
+				if initial == "" {
+					prompts = []string{""}
+				}
+			case "LOGIN":
+				// base64 of Username: and Password:
+				prompts = []string{"VXNlcm5hbWU6", "UGFzc3dvcmQ6"}
+				if initial != "" {
+					prompts = prompts[1:]
+				}
+			default:
+				reply(504, "unrecognized authentication type")
+				continue
+			}
+
+			for _, prompt := range prompts {
+				reply(334, prompt)
+				if _, err := tp.ReadLine(); err != nil {
+					return
+				}
+			}
+
+			reply(235, "authentication successful")
+
+		case "MAIL":
+			address, ok := pathArg(arg, "FROM:")
+			switch {
+			case !hello:
+				reply(503, "send HELO or EHLO first")
+			case !ok:
+				reply(501, "syntax: MAIL FROM:<address>")
+			default:
+				reset()
+				mailing, from = true, address
+				reply(250, "ok")
+			}
+
+		case "RCPT":
+			address, ok := pathArg(arg, "TO:")
+			switch {
+			case !mailing:
+				reply(503, "send MAIL first")
+			case !ok || address == "":
+				reply(501, "syntax: RCPT TO:<address>")
+			default:
+				to = append(to, address)
+				reply(250, "ok")
+			}
+
+		case "DATA":
+			if len(to) == 0 {
+				reply(503, "send RCPT first")
+				continue
+			}
+
+			reply(354, "end data with <CR><LF>.<CR><LF>")
+
+			// the dot reader turns line endings into LF, messages keep CRLF
+			r := tp.DotReader()
+			data, err := io.ReadAll(io.LimitReader(r, maxMessageSize+1))
+			if err != nil {
+				return
+			}
+
+			if len(data) > maxMessageSize {
+				_, _ = io.Copy(io.Discard, r)
+				reply(552, "message too large")
+				reset()
+				continue
+			}
+
+			raw := mailbox.Delivered(bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n")), from, to)
+			m, err := mb.Add(raw)
+			if err != nil {
+				ctx.PublishInfo("%s: mail from <%s> rejected: %s", svc.Name, from, err)
+				reply(554, err.Error())
+				reset()
+				continue
+			}
+
+			ctx.PublishFake("%s: mail %d from <%s> to %s: %s", svc.Name, m.ID, from, strings.Join(to, ", "), m.Subject)
+			reply(250, fmt.Sprintf("ok: queued as %d", m.ID))
+			reset()
+
+		case "RSET":
+			reset()
+			reply(250, "ok")
+
+		case "NOOP":
+			reply(250, "ok")
+
+		case "VRFY":
+			reply(252, "cannot verify, will accept")
+
+		case "QUIT":
+			reply(221, "bye")
+			return
+
+		default:
+			reply(500, "unrecognized command")
+		}
+	}
+}
+
+// pathArg reads the address of a MAIL FROM:<address> or RCPT TO:<address>
+// argument, ignoring any parameters after it.
+func pathArg(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	path := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(path, "<") {
+		// some clients leave out the brackets
+		address, _, _ := strings.Cut(path, " ")
+		return address, address != ""
+	}
+
+	address, _, ok := strings.Cut(path[1:], ">")
+
+	return address, ok
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"crypto/tls"
+	"net"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathArg(t *testing.T) {
+	tests := map[string]struct {
+		arg, prefix string
+		want        string
+		ok          bool
+	}{
+		"brackets":     {arg: "FROM:<ada@example.com>", prefix: "FROM:", want: "ada@example.com", ok: true},
+		"parameters":   {arg: "FROM:<ada@example.com> SIZE=1024", prefix: "FROM:", want: "ada@example.com", ok: true},
+		"lower case":   {arg: "to:<bob@example.com>", prefix: "TO:", want: "bob@example.com", ok: true},
+		"space":        {arg: "TO: <bob@example.com>", prefix: "TO:", want: "bob@example.com", ok: true},
+		"no brackets":  {arg: "TO:bob@example.com NOTIFY=NEVER", prefix: "TO:", want: "bob@example.com", ok: true},
+		"null sender":  {arg: "FROM:<>", prefix: "FROM:", want: "", ok: true},
+		"wrong prefix": {arg: "TO:<bob@example.com>", prefix: "FROM:"},
+		"short":        {arg: "TO", prefix: "TO:"},
+		"no address":   {arg: "TO:", prefix: "TO:"},
+		"unterminated": {arg: "TO:<bob@example.com", prefix: "TO:"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := pathArg(tc.arg, tc.prefix)
+			assert.Equal(t, tc.ok, ok)
+			if tc.ok {
+				assert.Equal(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestConverseSMTPAuth(t *testing.T) {
+	tests := map[string]struct {
+		tls      bool
+		commands []string
+		want     int
+	}{
+		"before hello":      {commands: []string{"AUTH PLAIN AGFkYQBzZWNyZXQ="}, want: 503},
+		"after hello":       {commands: []string{"HELO client", "AUTH PLAIN AGFkYQBzZWNyZXQ="}, want: 235},
+		"tls not started":   {tls: true, commands: []string{"HELO client", "AUTH PLAIN AGFkYQBzZWNyZXQ="}, want: 530},
+		"unknown mechanism": {commands: []string{"HELO client", "AUTH CRAM-MD5"}, want: 504},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+
+			var tlsConfig *tls.Config
+			if tc.tls {
+				tlsConfig = &tls.Config{}
+			}
+
+			go converseSMTP(nil, Service{Name: "mail"}, nil, server, tlsConfig)
+
+			tp := textproto.NewConn(client)
+			_, _, err := tp.ReadResponse(220)
+			require.NoError(t, err)
+
+			var code int
+			for _, command := range tc.commands {
+				require.NoError(t, tp.PrintfLine("%s", command))
+				code, _, err = tp.ReadResponse(0)
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.want, code)
+		})
+	}
+}
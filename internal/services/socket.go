@@ -0,0 +1,416 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/net_scripts"
+	"github.com/fsnotify/fsnotify"
+)
+
+// errTimeout ends a conversation waiting too long for an expected input.
+var errTimeout = errors.New("timed out")
+
+// StartSocket runs a TCP or UDP server following the script in the service's
+// results folder. The script is reloaded as it changes, conversations already
+// going on keep theirs.
+func StartSocket(svc Service, ctx *app.Context) {
+	protocol := string(svc.Type)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("failed to create watcher for service %s: %s", svc.Name, err)
+		return
+	}
+	defer watcher.Close()
+
+	watch := func(dir string) {
+		if err := watcher.Add(dir); err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to watch directory %s: %s", dir, err)
+		}
+	}
+
+	// The active scenario's script replaces the base one
+	roots := []string{filepath.Join(ctx.Flags.Results, svc.Name)}
+	if scenario := ctx.Scenario(); scenario != "" {
+		roots = append(roots, ScenarioResultsPath(ctx.Flags.Results, scenario, svc.Name))
+	}
+
+	var mu sync.Mutex // guards reloads
+	var script atomic.Pointer[net_scripts.Script]
+
+	// reload reads the script again. A script that fails to parse keeps the
+	// previous one.
+	reload := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		healthy := true
+		problem := func(format string, args ...any) {
+			healthy = false
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError(format, args...)
+		}
+
+		var files []string
+		var file string
+		for _, root := range roots {
+			found, err := responseFiles(root, watch)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				problem("failed to read directory %s: %s", root, err)
+			}
+
+			if len(found) > 1 {
+				problem("%s has more than one script, using %s", root, found[0])
+			}
+
+			if len(found) > 0 {
+				file = found[0]
+			}
+
+			files = append(files, found...)
+		}
+
+		svc.Files = files
+
+		if file == "" {
+			problem("no script for service %s, add one to %s", svc.Name, roots[len(roots)-1])
+			return
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			problem("failed to read file %s: %s", file, err)
+			return
+		}
+
+		s, err := net_scripts.Parse(data)
+		if err != nil {
+			problem("failed to parse file %s, keeping the previous script: %s", file, err)
+			return
+		}
+
+		s.File = file
+		script.Store(s)
+
+		if healthy {
+			ctx.PublishServiceOnline(svc.Name)
+		}
+	}
+
+	reload()
+
+	var closers []io.Closer
+	for _, address := range listenAddresses(svc) {
+		var c io.Closer
+		if protocol == "udp" {
+			c, err = serveUDP(ctx, svc, address, &script)
+		} else {
+			c, err = serveTCP(ctx, svc, address, &script)
+		}
+
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("server error: %s", err)
+			continue
+		}
+
+		ctx.PublishInfo("starting service %s on %s (%s)", svc.Name, address, protocol)
+		closers = append(closers, c)
+	}
+
+	go watchChanges(ctx, svc.Name, watcher, func() {
+		reload()
+		ctx.PublishInfo("reloaded service %s", svc.Name)
+	})
+
+	// wait for termination
+	<-ctx.Done()
+
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	for _, c := range closers {
+		_ = c.Close()
+	}
+
+	ctx.PublishServiceOffline(svc.Name)
+}
+
+// peer is one side of a conversation: a TCP connection or a UDP client.
+type peer interface {
+	// read returns the next line or datagram, waiting at most timeout when it
+	// is set.
+	read(timeout time.Duration) (string, error)
+	write(text string) error
+	close()
+}
+
+// converseScript follows script with p until a step disconnects, the client
+// goes away or the service stops.
+func converseScript(ctx *app.Context, svc Service, script *net_scripts.Script, p peer, remote string) {
+	protocol := string(svc.Type)
+	line := script.Line(protocol)
+	data := net_scripts.Data{Remote: remote}
+
+	ctx.PublishFake("%s: %s connected (%s)", svc.Name, remote, protocol)
+	defer p.close()
+
+	done := ctx.Done()
+
+	for {
+		for _, step := range script.Steps {
+			if !wait(done, step.Delay) {
+				return
+			}
+
+			switch {
+			case step.Disconnect:
+				ctx.PublishFake("%s: %s disconnected by the script", svc.Name, remote)
+				return
+
+			case step.Send != "":
+				text, err := step.Render(data)
+				if err != nil {
+					ctx.PublishServiceError(svc.Name)
+					ctx.PublishError("%s: %s", script.File, err)
+					return
+				}
+
+				if err := p.write(text + line); err != nil {
+					ctx.PublishInfo("%s: %s disconnected: %s", svc.Name, remote, err)
+					return
+				}
+				ctx.PublishFake("%s: %s < %s", svc.Name, remote, text)
+
+			default:
+				for {
+					input, err := p.read(step.Timeout)
+					if err != nil {
+						switch {
+						case errors.Is(err, errTimeout):
+							ctx.PublishInfo("%s: %s timed out expecting %s", svc.Name, remote, step.Expect)
+						case errors.Is(err, io.EOF):
+							ctx.PublishFake("%s: %s disconnected", svc.Name, remote)
+						default:
+							ctx.PublishInfo("%s: %s disconnected: %s", svc.Name, remote, err)
+						}
+						return
+					}
+
+					data.Count++
+					if groups := step.Match(input); groups != nil {
+						data.Input, data.Groups = input, groups
+						ctx.PublishFake("%s: %s > %s", svc.Name, remote, input)
+						break
+					}
+
+					ctx.PublishInfo("%s: %s > %s unmatched, expecting %s", svc.Name, remote, input, step.Expect)
+				}
+			}
+		}
+
+		if !script.Loop {
+			break
+		}
+	}
+
+	// the script is over, keep listening until the client leaves
+	for {
+		input, err := p.read(0)
+		if err != nil {
+			ctx.PublishFake("%s: %s disconnected", svc.Name, remote)
+			return
+		}
+
+		ctx.PublishInfo("%s: %s > %s unmatched, the script is over", svc.Name, remote, input)
+	}
+}
+
+// serveTCP accepts connections on address, each following the current
+// script.
+func serveTCP(ctx *app.Context, svc Service, address string, script *atomic.Pointer[net_scripts.Script]) (io.Closer, error) {
+	l, err := listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					ctx.PublishServiceError(svc.Name)
+					ctx.PublishError("server error: %s", err)
+				}
+				return
+			}
+
+			s := script.Load()
+			if s == nil {
+				_ = conn.Close()
+				continue
+			}
+
+			p := &tcpPeer{conn: conn, reader: bufio.NewReader(conn)}
+
+			// stop with the service
+			stop := context.AfterFunc(ctx, p.close)
+
+			go func() {
+				defer stop()
+				converseScript(ctx, svc, s, p, conn.RemoteAddr().String())
+			}()
+		}
+	}()
+
+	return l, nil
+}
+
+// tcpPeer reads lines from a connection.
+type tcpPeer struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (p *tcpPeer) read(timeout time.Duration) (string, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	_ = p.conn.SetReadDeadline(deadline)
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return "", errTimeout
+		}
+
+		// a last line without a newline still counts
+		if line == "" {
+			return "", err
+		}
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (p *tcpPeer) write(text string) error {
+	_, err := io.WriteString(p.conn, text)
+	return err
+}
+
+func (p *tcpPeer) close() {
+	_ = p.conn.Close()
+}
+
+// serveUDP reads datagrams on address. Every client address gets its own
+// conversation, following the current script.
+func serveUDP(ctx *app.Context, svc Service, address string, script *atomic.Pointer[net_scripts.Script]) (io.Closer, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	peers := make(map[string]*udpPeer)
+
+	go func() {
+		buf := make([]byte, 65535)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					ctx.PublishServiceError(svc.Name)
+					ctx.PublishError("server error: %s", err)
+				}
+				return
+			}
+
+			datagram := strings.TrimRight(string(buf[:n]), "\r\n")
+			remote := addr.String()
+
+			mu.Lock()
+			p, ok := peers[remote]
+			if !ok {
+				if s := script.Load(); s != nil {
+					p = &udpPeer{conn: conn, addr: addr, idle: s.Idle, inbox: make(chan string, 64), done: ctx.Done()}
+					peers[remote] = p
+
+					go func() {
+						converseScript(ctx, svc, s, p, remote)
+
+						mu.Lock()
+						delete(peers, remote)
+						mu.Unlock()
+					}()
+				}
+			}
+			mu.Unlock()
+
+			if p == nil {
+				continue
+			}
+
+			select {
+			case p.inbox <- datagram:
+			default:
+				ctx.PublishInfo("%s: %s > %s dropped, too many waiting", svc.Name, remote, datagram)
+			}
+		}
+	}()
+
+	return conn, nil
+}
+
+// udpPeer receives the datagrams of one client.
+type udpPeer struct {
+	conn  net.PacketConn
+	addr  net.Addr
+	idle  time.Duration
+	inbox chan string
+	done  <-chan struct{}
+}
+
+func (p *udpPeer) read(timeout time.Duration) (string, error) {
+	idle := time.NewTimer(p.idle)
+	defer idle.Stop()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+
+	select {
+	case datagram := <-p.inbox:
+		return datagram, nil
+	case <-expired:
+		return "", errTimeout
+	case <-idle.C:
+		return "", io.EOF
+	case <-p.done:
+		return "", io.EOF
+	}
+}
+
+func (p *udpPeer) write(text string) error {
+	_, err := p.conn.WriteTo([]byte(text), p.addr)
+	return err
+}
+
+func (p *udpPeer) close() {}
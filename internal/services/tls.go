@@ -0,0 +1,119 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/certs"
+)
+
+// TLSConfig is parsed from the tls section of a service yaml file. Without a
+// cert and key, a certificate for Hosts is issued by the local certificate
+// authority.
+type TLSConfig struct {
+	Cert       string            `yaml:"cert"`
+	Key        string            `yaml:"key"`
+	Hosts      []string          `yaml:"hosts"`
+	ClientAuth *ClientAuthConfig `yaml:"clientAuth"`
+}
+
+// ClientAuthConfig is parsed from the clientAuth section of a service's tls
+// section. It requires clients to present a certificate signed by CA, or by
+// the local certificate authority when CA is empty.
+type ClientAuthConfig struct {
+	// CA is a PEM file of the authorities client certificates must be signed by.
+	CA string `yaml:"ca"`
+
+	// Optional accepts connections without a client certificate. Any
+	// certificate that is presented must still verify.
+	Optional bool `yaml:"optional"`
+
+	// Issue names client certificates to issue from the local certificate
+	// authority.
+	Issue []string `yaml:"issue"`
+}
+
+// serverConfig creates the tls.Config an HTTP service listens with.
+func (t *TLSConfig) serverConfig(ctx *app.Context) (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if t.Cert != "" || t.Key != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate %s: %s", t.Cert, err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	} else {
+		ca, err := certs.LoadAuthority(ctx.Flags.Certs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate authority: %s", err)
+		}
+
+		cert, err := ca.Issue(t.Hosts)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts := t.Hosts
+		if len(hosts) == 0 {
+			hosts = certs.DefaultHosts
+		}
+
+		ctx.PublishInfo("trust %s to accept certificates for %s", ca.CertPath, strings.Join(hosts, ", "))
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.ClientAuth != nil {
+		if err := t.ClientAuth.apply(ctx, config); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// apply requires client certificates on config.
+func (c *ClientAuthConfig) apply(ctx *app.Context, config *tls.Config) error {
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if c.Optional {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	var ca *certs.Authority
+	if c.CA == "" || len(c.Issue) > 0 {
+		var err error
+		if ca, err = certs.LoadAuthority(ctx.Flags.Certs); err != nil {
+			return fmt.Errorf("failed to load certificate authority: %s", err)
+		}
+	}
+
+	if c.CA == "" {
+		config.ClientCAs = ca.Pool()
+	} else {
+		data, err := os.ReadFile(c.CA)
+		if err != nil {
+			return fmt.Errorf("failed to read client ca %s: %s", c.CA, err)
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in client ca %s", c.CA)
+		}
+	}
+
+	for _, name := range c.Issue {
+		certPath, keyPath, err := ca.WriteClient(ctx.Flags.Certs, name)
+		if err != nil {
+			return fmt.Errorf("failed to issue client certificate %s: %s", name, err)
+		}
+
+		ctx.PublishInfo("client certificate %s: %s %s", name, certPath, keyPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,17 @@
+package services
+
+import "time"
+
+// wait sleeps for d, returning false when done is closed first.
+func wait(done <-chan struct{}, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(d):
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/http_results"
+)
+
+// webhookClient sends webhooks. Receivers are expected to be local and quick.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendWebhooks delivers the webhooks of result in the background. They are
+// abandoned when the service stops.
+func sendWebhooks(ctx *app.Context, name string, result *http_results.Result, data http_results.WebhookData) {
+	for _, hook := range result.Webhooks {
+		go deliver(ctx, name, hook, data)
+	}
+}
+
+func deliver(ctx *app.Context, name string, hook *http_results.Webhook, data http_results.WebhookData) {
+	delay := hook.Delay
+
+	for attempt := 0; attempt <= hook.Retries; attempt++ {
+		if attempt > 0 {
+			delay = hook.RetryDelay
+		}
+
+		if !wait(ctx.Done(), delay) {
+			return
+		}
+
+		r, err := hook.NewRequest(data)
+		if err != nil {
+			ctx.PublishServiceError(name)
+			ctx.PublishError("%s: webhook %s: %s", name, hook.URL, err)
+			return
+		}
+
+		status, err := send(ctx, r)
+		if err == nil {
+			ctx.PublishInfo("%s: webhook %s %s %d delivered", name, r.Method, r.URL, status)
+			return
+		}
+
+		if attempt < hook.Retries {
+			ctx.PublishInfo("%s: webhook %s %s failed, retrying: %s", name, r.Method, r.URL, err)
+		} else {
+			ctx.PublishError("%s: webhook %s %s failed after %d attempts: %s", name, r.Method, r.URL, attempt+1, err)
+		}
+	}
+}
+
+// send makes the request, treating anything but a 2xx response as failed.
+func send(ctx *app.Context, r *http.Request) (int, error) {
+	resp, err := webhookClient.Do(r.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
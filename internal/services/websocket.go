@@ -0,0 +1,345 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/crit/fake-ops/internal/app"
+	"github.com/crit/fake-ops/internal/http_results"
+	"github.com/crit/fake-ops/internal/ws_scripts"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// StartWebSocket runs a fake WebSocket server. Every script file in the
+// service's results folder scripts the conversations on one path. Scripts are
+// reloaded as they change, conversations already going on keep their script.
+func StartWebSocket(svc Service, ctx *app.Context) {
+	var tlsConfig *tls.Config
+	if svc.TLS != nil {
+		var err error
+		tlsConfig, err = svc.TLS.serverConfig(ctx)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to configure tls for service %s: %s", svc.Name, err)
+			return
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("failed to create watcher for service %s: %s", svc.Name, err)
+		return
+	}
+	defer watcher.Close()
+
+	watch := func(dir string) {
+		if err := watcher.Add(dir); err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("failed to watch directory %s: %s", dir, err)
+		}
+	}
+
+	// The active scenario's scripts replace the base ones with the same path
+	roots := []string{filepath.Join(ctx.Flags.Results, svc.Name)}
+	if scenario := ctx.Scenario(); scenario != "" {
+		roots = append(roots, ScenarioResultsPath(ctx.Flags.Results, scenario, svc.Name))
+	}
+
+	upgrader := websocket.Upgrader{
+		// fakes are connected to from anywhere
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+
+	// newEngine routes connections to scripts. gin panics on paths that
+	// conflict, which is returned as an error.
+	newEngine := func(scripts []*ws_scripts.Script) (g *gin.Engine, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+
+		g = gin.New()
+		for _, script := range scripts {
+			g.GET(script.Path, func(c *gin.Context) {
+				params := make(map[string]string, len(c.Params))
+				for _, p := range c.Params {
+					params[p.Key] = p.Value
+				}
+				req := http_results.NewRequest(c.Request, params)
+
+				conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+				if err != nil {
+					// the upgrader has answered with an error
+					ctx.PublishInfo("%s: %s %s unmatched: %s", svc.Name, c.Request.Method, c.Request.URL.Path, err)
+					return
+				}
+
+				converse(ctx, svc, script, conn, req)
+			})
+		}
+
+		return g, nil
+	}
+
+	var mu sync.Mutex // guards reloads
+	var engine atomic.Pointer[gin.Engine]
+
+	// reload reads the scripts again. A script that fails to parse keeps its
+	// last good version.
+	lastGood := make(map[string]*ws_scripts.Script)
+	reload := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		healthy := true
+		problem := func(format string, args ...any) {
+			healthy = false
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError(format, args...)
+		}
+
+		var files []string
+		var scripts []*ws_scripts.Script
+		current := make(map[string]*ws_scripts.Script)
+
+		for _, root := range roots {
+			found, err := responseFiles(root, watch)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				problem("failed to read directory %s: %s", root, err)
+			}
+
+			paths := make(map[string]string)
+			for _, file := range found {
+				data, err := os.ReadFile(file)
+				if err == nil {
+					var script *ws_scripts.Script
+					if script, err = ws_scripts.Parse(data); err == nil {
+						script.File = file
+						lastGood[file] = script
+					}
+				}
+
+				if err != nil {
+					problem("failed to parse file %s: %s", file, err)
+				}
+
+				script := lastGood[file]
+				if script == nil {
+					continue
+				}
+
+				if other, ok := paths[script.Path]; ok {
+					problem("%s scripts %s already scripted by %s", file, script.Path, other)
+					continue
+				}
+				paths[script.Path] = file
+
+				// a later root, like a scenario, replaces the script for a path
+				scripts = slices.DeleteFunc(scripts, func(s *ws_scripts.Script) bool {
+					return s.Path == script.Path
+				})
+
+				current[file] = script
+				scripts = append(scripts, script)
+			}
+
+			files = append(files, found...)
+		}
+
+		lastGood = current
+
+		g, err := newEngine(scripts)
+		if err != nil {
+			problem("failed to load scripts for service %s, keeping the previous ones: %s", svc.Name, err)
+			return
+		}
+
+		svc.Files = files
+		engine.Store(g)
+
+		if healthy {
+			ctx.PublishServiceOnline(svc.Name)
+		}
+	}
+
+	reload()
+
+	// nothing to serve when the first load fails
+	if engine.Load() == nil {
+		engine.Store(gin.New())
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			engine.Load().ServeHTTP(w, r)
+		}),
+		TLSConfig: tlsConfig,
+	}
+
+	serveHTTP(ctx, svc, server)
+
+	go watchChanges(ctx, svc.Name, watcher, func() {
+		reload()
+		ctx.PublishInfo("reloaded service %s", svc.Name)
+	})
+
+	// wait for termination
+	<-ctx.Done()
+
+	ctx.PublishInfo("stopping service %s", svc.Name)
+
+	// conversations are hijacked from the server, they close themselves
+	if err := server.Close(); err != nil {
+		ctx.PublishServiceError(svc.Name)
+		ctx.PublishError("error stopping server: %s", err)
+	} else {
+		ctx.PublishServiceOffline(svc.Name)
+	}
+}
+
+// converse follows script with the client on conn until either side closes
+// the connection or the service stops.
+func converse(ctx *app.Context, svc Service, script *ws_scripts.Script, conn *websocket.Conn, req http_results.Request) {
+	path := req.Path
+	ctx.PublishFake("%s: %s connected", svc.Name, path)
+
+	done := make(chan struct{})
+	var once sync.Once
+	end := func() {
+		once.Do(func() {
+			close(done)
+			_ = conn.Close()
+		})
+	}
+	defer end()
+
+	// the connection allows one writer at a time
+	var writeMu sync.Mutex
+
+	closeWith := func(c *ws_scripts.Close) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		deadline := time.Now().Add(time.Second)
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(c.Code, c.Reason), deadline)
+		ctx.PublishFake("%s: %s closed with %d %s", svc.Name, path, c.Code, c.Reason)
+		end()
+	}
+
+	// send waits for the message's delay, then sends it or closes. It reports
+	// whether the conversation goes on.
+	send := func(m *ws_scripts.Message, data ws_scripts.Data) bool {
+		if !wait(done, m.Delay) {
+			return false
+		}
+
+		if m.Close != nil {
+			closeWith(m.Close)
+			return false
+		}
+
+		text, err := m.Render(data)
+		if err != nil {
+			ctx.PublishServiceError(svc.Name)
+			ctx.PublishError("%s: %s", script.File, err)
+			return true
+		}
+
+		writeMu.Lock()
+		defer writeMu.Unlock()
+
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(text)); err != nil {
+			end()
+			return false
+		}
+
+		return true
+	}
+
+	go func() {
+		// stop with the service
+		select {
+		case <-ctx.Done():
+			closeWith(&ws_scripts.Close{Code: websocket.CloseGoingAway, Reason: "service stopped"})
+		case <-done:
+		}
+	}()
+
+	if script.Close != nil {
+		go func() {
+			if wait(done, script.Close.After) {
+				closeWith(script.Close)
+			}
+		}()
+	}
+
+	go func() {
+		for _, m := range script.OnConnect {
+			if !send(m, ws_scripts.NewData(req, "", nil, 0)) {
+				return
+			}
+		}
+	}()
+
+	for _, push := range script.Pushes {
+		go func(push *ws_scripts.Push) {
+			for count := 1; push.Times == 0 || count <= push.Times; count++ {
+				if !wait(done, push.Every) || !send(&push.Message, ws_scripts.NewData(req, "", nil, count)) {
+					return
+				}
+			}
+		}(push)
+	}
+
+	// replies are sent in the order messages arrive
+	for count := 1; ; count++ {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var closed *websocket.CloseError
+			select {
+			case <-done:
+				// closed by the script, already logged
+			default:
+				if errors.As(err, &closed) {
+					ctx.PublishFake("%s: %s disconnected with %d %s", svc.Name, path, closed.Code, closed.Text)
+				} else {
+					ctx.PublishFake("%s: %s disconnected", svc.Name, path)
+				}
+			}
+			return
+		}
+
+		message := string(data)
+		reply, groups := script.Reply(message)
+		if reply == nil {
+			ctx.PublishInfo("%s: %s received %q unmatched", svc.Name, path, message)
+			continue
+		}
+
+		ctx.PublishFake("%s: %s received %q", svc.Name, path, message)
+
+		for _, m := range reply.Sends() {
+			if !send(m, ws_scripts.NewData(req, message, groups, count)) {
+				break
+			}
+		}
+	}
+}
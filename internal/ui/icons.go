@@ -1,7 +1,18 @@
 package ui
 
 const (
-	iGlobe   string = "\uF0AC"
-	iCloud   string = "\uF0C2"
-	iCommand string = "\uF120"
+	iGlobe    string = "\uF0AC"
+	iCloud    string = "\uF0C2"
+	iCommand  string = "\uF120"
+	iFake     string = "\uF0C5"
+	iProxy    string = "\uF0EC"
+	iKey      string = "\uF084"
+	iGraph    string = "\uF1E0"
+	iPlug     string = "\uF1E6"
+	iBolt     string = "\uF0E7"
+	iNetwork  string = "\uF0E8"
+	iMail     string = "\uF0E0"
+	iSigns    string = "\uF277"
+	iBox      string = "\uF187"
+	iDatabase string = "\uF1C0"
 )
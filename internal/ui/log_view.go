@@ -15,6 +15,8 @@ type LogView struct {
 	titleStyle lipgloss.Style
 	infoStyle  lipgloss.Style
 	errStyle   lipgloss.Style
+	fakeStyle  lipgloss.Style
+	proxyStyle lipgloss.Style
 	logStyle   lipgloss.Style
 }
 
@@ -27,6 +29,8 @@ func NewLogView() *LogView {
 		titleStyle: lipgloss.NewStyle().Foreground(cPrimary).Bold(true),
 		infoStyle:  lipgloss.NewStyle().Foreground(cSecondary),
 		errStyle:   lipgloss.NewStyle().Foreground(cDanger),
+		fakeStyle:  lipgloss.NewStyle().Foreground(cPrimary),
+		proxyStyle: lipgloss.NewStyle().Foreground(cBorder),
 		logStyle:   lipgloss.NewStyle().Foreground(cSecondary),
 	}
 }
@@ -53,6 +57,10 @@ func (lv *LogView) View() string {
 			formatted = append(formatted, lv.errStyle.Render(fmt.Sprintf("> %s", log)))
 		case app.InfoKind:
 			formatted = append(formatted, lv.infoStyle.Render(fmt.Sprintf("> %s", log)))
+		case app.FakeKind:
+			formatted = append(formatted, lv.fakeStyle.Render(fmt.Sprintf("%s %s", iFake, log)))
+		case app.ProxyKind:
+			formatted = append(formatted, lv.proxyStyle.Render(fmt.Sprintf("%s %s", iProxy, log)))
 		}
 	}
 
@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/crit/fake-ops/internal/app"
@@ -38,8 +39,12 @@ func NewServiceView() *ServiceView {
 
 // Update ServiceView with data needed for View.
 func (v *ServiceView) Update(msg app.ServiceMessage) {
-	if _, ok := v.position[msg.Name]; ok {
-		return // already in the slice
+	if pos, ok := v.position[msg.Name]; ok {
+		// already in the slice, a restart may have changed its details
+		v.services[pos].Kind = msg.Kind
+		v.services[pos].Port = msg.Port
+		v.services[pos].Addresses = msg.Addresses
+		return
 	}
 
 	v.services = append(v.services, msg)
@@ -99,11 +104,39 @@ func (v *ServiceView) View() string {
 			icon = iCommand
 		case "http":
 			icon = iCloud
+		case "oidc":
+			icon = iKey
+		case "graphql":
+			icon = iGraph
+		case "grpc":
+			icon = iPlug
+		case "websocket":
+			icon = iBolt
+		case "tcp", "udp":
+			icon = iNetwork
+		case "smtp":
+			icon = iMail
+		case "dns":
+			icon = iSigns
+		case "s3":
+			icon = iBox
+		case "redis":
+			icon = iDatabase
 		default:
 			icon = iGlobe
 		}
 
-		blocks = append(blocks, block.Render(fmt.Sprintf(" %s  %s:%d", icon, svc.Name, svc.Port)))
+		if len(svc.Addresses) == 0 {
+			blocks = append(blocks, block.Render(fmt.Sprintf(" %s  %s:%d", icon, svc.Name, svc.Port)))
+			continue
+		}
+
+		lines := []string{fmt.Sprintf(" %s  %s", icon, svc.Name)}
+		for _, address := range svc.Addresses {
+			lines = append(lines, "    "+address)
+		}
+
+		blocks = append(blocks, block.Height(len(lines)).Render(strings.Join(lines, "\n")))
 	}
 
 	return gridStyle.Render(lipgloss.JoinVertical(lipgloss.Top, blocks...))
@@ -26,6 +26,7 @@ type UI struct {
 	height         int
 	logs           *LogView
 	services       *ServiceView
+	scenario       app.ScenarioMessage
 	containerStyle lipgloss.Style
 	footerStyle    lipgloss.Style
 }
@@ -48,6 +49,8 @@ func (ui *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "q", "ctrl+c":
 			ui.cancel()
 			return ui, DelayedQuit
+		case "s":
+			return ui, ui.nextScenario()
 		}
 		return ui, nil // Ignore all other keys
 
@@ -75,6 +78,10 @@ func (ui *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		ui.services.UpdateStatus(msg)
 		return ui, nil
 
+	case app.ScenarioMessage:
+		ui.scenario = msg
+		return ui, nil
+
 	default:
 		return ui, nil
 	}
@@ -84,11 +91,47 @@ func (ui *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (ui *UI) View() string {
 	container := ui.containerStyle.Width(ui.width - 2).Height(ui.height - 2)
 	row := lipgloss.JoinHorizontal(lipgloss.Top, ui.services.View(), ui.logs.View())
-	footer := ui.footerStyle.Width(ui.width - 4).Render("q or ctrl+c to quit")
+	help := "q or ctrl+c to quit"
+	if len(ui.scenario.Available) > 0 {
+		scenario := ui.scenario.Active
+		if scenario == "" {
+			scenario = "base"
+		}
+
+		help = fmt.Sprintf("scenario: %s · s to switch · %s", scenario, help)
+	}
+
+	footer := ui.footerStyle.Width(ui.width - 4).Render(help)
 
 	return container.Render(lipgloss.JoinVertical(lipgloss.Top, row, footer))
 }
 
+// nextScenario switches to the scenario after the active one, wrapping back
+// to the base results after the last.
+func (ui *UI) nextScenario() tea.Cmd {
+	names := append([]string{""}, ui.scenario.Available...)
+	if len(names) == 1 {
+		return nil
+	}
+
+	next := names[0]
+	for i, name := range names {
+		if name == ui.scenario.Active {
+			next = names[(i+1)%len(names)]
+			break
+		}
+	}
+
+	// switching restarts services, which publish to the UI, so it must not
+	// happen inside Update
+	return func() tea.Msg {
+		if err := ui.ctx.SwitchScenario(next); err != nil {
+			ui.ctx.PublishError("%s", err)
+		}
+		return nil
+	}
+}
+
 // SetContext makes the app.Context available to the UI.
 func (ui *UI) SetContext(ctx *app.Context) {
 	ui.ctx = ctx
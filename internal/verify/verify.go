@@ -0,0 +1,316 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/crit/fake-ops/internal/journal"
+)
+
+// maxNearMisses is how many near misses a Report includes.
+const maxNearMisses = 5
+
+// Matcher checks a single value, like a body or a header. Every field that is
+// set must match.
+type Matcher struct {
+	Equals    *string         `json:"equals,omitempty"`
+	Contains  string          `json:"contains,omitempty"`
+	Matches   string          `json:"matches,omitempty"`
+	EqualJSON json.RawMessage `json:"equalJson,omitempty"`
+	Absent    bool            `json:"absent,omitempty"`
+}
+
+// Match reports why value does not satisfy the Matcher. An empty reason means
+// it matched. present is false when the value was not sent at all.
+func (m Matcher) Match(value string, present bool) string {
+	if m.Absent {
+		if present {
+			return fmt.Sprintf("expected to be absent, got %q", value)
+		}
+		return ""
+	}
+
+	if !present && (m.Equals != nil || m.Contains != "" || m.Matches != "" || m.EqualJSON != nil) {
+		return "expected to be present"
+	}
+
+	if m.Equals != nil && value != *m.Equals {
+		return fmt.Sprintf("expected %q, got %q", *m.Equals, value)
+	}
+
+	if m.Contains != "" && !strings.Contains(value, m.Contains) {
+		return fmt.Sprintf("expected to contain %q, got %q", m.Contains, value)
+	}
+
+	if m.Matches != "" {
+		re, err := regexp.Compile(m.Matches)
+		if err != nil {
+			return fmt.Sprintf("invalid pattern %q: %s", m.Matches, err)
+		}
+
+		if !re.MatchString(value) {
+			return fmt.Sprintf("expected to match %q, got %q", m.Matches, value)
+		}
+	}
+
+	if m.EqualJSON != nil {
+		var want, got any
+		if err := json.Unmarshal(m.EqualJSON, &want); err != nil {
+			return fmt.Sprintf("invalid expected json: %s", err)
+		}
+
+		if err := json.Unmarshal([]byte(value), &got); err != nil {
+			return fmt.Sprintf("expected json, got %q", value)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			return fmt.Sprintf("expected json %s, got %s", compact(m.EqualJSON), compact([]byte(value)))
+		}
+	}
+
+	return ""
+}
+
+// Request describes the requests to look for. Empty fields match everything.
+type Request struct {
+	Method  string             `json:"method"`
+	Path    string             `json:"path"`
+	Body    *Matcher           `json:"body"`
+	Headers map[string]Matcher `json:"headers"`
+	Query   map[string]Matcher `json:"query"`
+}
+
+// Count is how many requests are expected to match. When nothing is set at
+// least one is expected.
+type Count struct {
+	Exactly *int `json:"exactly,omitempty"`
+	AtLeast *int `json:"atLeast,omitempty"`
+	AtMost  *int `json:"atMost,omitempty"`
+}
+
+// String describes the expected count.
+func (c Count) String() string {
+	var parts []string
+
+	if c.Exactly != nil {
+		parts = append(parts, fmt.Sprintf("exactly %d", *c.Exactly))
+	}
+	if c.AtLeast != nil {
+		parts = append(parts, fmt.Sprintf("at least %d", *c.AtLeast))
+	}
+	if c.AtMost != nil {
+		parts = append(parts, fmt.Sprintf("at most %d", *c.AtMost))
+	}
+
+	if len(parts) == 0 {
+		return "at least 1"
+	}
+
+	return strings.Join(parts, " and ")
+}
+
+// allows reports whether n matching requests satisfies the Count.
+func (c Count) allows(n int) bool {
+	if c.Exactly == nil && c.AtLeast == nil && c.AtMost == nil {
+		return n >= 1
+	}
+
+	if c.Exactly != nil && n != *c.Exactly {
+		return false
+	}
+	if c.AtLeast != nil && n < *c.AtLeast {
+		return false
+	}
+	if c.AtMost != nil && n > *c.AtMost {
+		return false
+	}
+
+	return true
+}
+
+// Verification asks whether a service received the expected requests.
+type Verification struct {
+	Request
+	Count Count `json:"count"`
+}
+
+// NearMiss is a received request that failed some of the Request's checks.
+type NearMiss struct {
+	Entry      journal.Entry `json:"entry"`
+	Mismatches []string      `json:"mismatches"`
+}
+
+// Report is the outcome of a Verification.
+type Report struct {
+	OK         bool       `json:"ok"`
+	Message    string     `json:"message"`
+	Expected   string     `json:"expected"`
+	Matched    int        `json:"matched"`
+	MatchedIDs []int64    `json:"matchedIds"`
+	NearMisses []NearMiss `json:"nearMisses"`
+}
+
+// Verify checks v against the received entries. When it fails, the Report
+// lists the requests that came closest to matching.
+func Verify(entries []journal.Entry, v Verification) Report {
+	report := Report{
+		Expected:   v.Count.String(),
+		MatchedIDs: []int64{},
+		NearMisses: []NearMiss{},
+	}
+
+	var misses []NearMiss
+	for _, e := range entries {
+		mismatches := v.Request.check(e)
+		if len(mismatches) == 0 {
+			report.Matched++
+			report.MatchedIDs = append(report.MatchedIDs, e.ID)
+			continue
+		}
+
+		// requests failing every check are not worth reporting
+		if len(mismatches) < v.Request.checks() {
+			misses = append(misses, NearMiss{Entry: e, Mismatches: mismatches})
+		}
+	}
+
+	report.OK = v.Count.allows(report.Matched)
+	report.Message = fmt.Sprintf("expected %s %s, received %d", report.Expected, v.Request, report.Matched)
+
+	if !report.OK {
+		sort.SliceStable(misses, func(i, j int) bool {
+			return len(misses[i].Mismatches) < len(misses[j].Mismatches)
+		})
+
+		if len(misses) > maxNearMisses {
+			misses = misses[:maxNearMisses]
+		}
+
+		report.NearMisses = append(report.NearMisses, misses...)
+	}
+
+	return report
+}
+
+// String describes the requests being looked for.
+func (r Request) String() string {
+	method, path := r.Method, r.Path
+	if method == "" {
+		method = "*"
+	}
+	if path == "" {
+		path = "*"
+	}
+
+	return method + " " + path
+}
+
+// checks is how many separate checks the Request makes.
+func (r Request) checks() int {
+	n := len(r.Headers) + len(r.Query)
+	if r.Method != "" {
+		n++
+	}
+	if r.Path != "" {
+		n++
+	}
+	if r.Body != nil {
+		n++
+	}
+
+	return n
+}
+
+// check returns a description of every check e fails.
+func (r Request) check(e journal.Entry) []string {
+	var mismatches []string
+
+	if r.Method != "" && !strings.EqualFold(r.Method, e.Method) {
+		mismatches = append(mismatches, fmt.Sprintf("method: expected %s, got %s", strings.ToUpper(r.Method), e.Method))
+	}
+
+	if r.Path != "" && r.Path != e.Route && !matchPath(r.Path, e.Path) {
+		mismatches = append(mismatches, fmt.Sprintf("path: expected %s, got %s", r.Path, e.Path))
+	}
+
+	if r.Body != nil {
+		if reason := r.Body.Match(e.Body, e.Body != ""); reason != "" {
+			mismatches = append(mismatches, "body: "+reason)
+		}
+	}
+
+	for _, name := range sortedKeys(r.Headers) {
+		values, present := e.Headers[httpHeaderKey(e, name)]
+		if reason := r.Headers[name].Match(strings.Join(values, ", "), present); reason != "" {
+			mismatches = append(mismatches, fmt.Sprintf("header %s: %s", name, reason))
+		}
+	}
+
+	for _, name := range sortedKeys(r.Query) {
+		values, present := e.Query[name]
+		if reason := r.Query[name].Match(strings.Join(values, ","), present); reason != "" {
+			mismatches = append(mismatches, fmt.Sprintf("query %s: %s", name, reason))
+		}
+	}
+
+	return mismatches
+}
+
+// matchPath reports whether path satisfies pattern. Pattern segments starting
+// with : match any single segment and a segment starting with * matches the
+// rest of the path.
+func matchPath(pattern, path string) bool {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, segment := range want {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+
+		if i >= len(got) {
+			return false
+		}
+
+		if !strings.HasPrefix(segment, ":") && segment != got[i] {
+			return false
+		}
+	}
+
+	return len(want) == len(got)
+}
+
+// httpHeaderKey finds the key e's headers use for name, ignoring case.
+func httpHeaderKey(e journal.Entry, name string) string {
+	for key := range e.Headers {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+
+	return name
+}
+
+func sortedKeys(m map[string]Matcher) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func compact(data []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return string(data)
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,93 @@
+package verify
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/crit/fake-ops/internal/journal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var entries = []journal.Entry{
+	{
+		ID:      1,
+		Method:  "POST",
+		Path:    "/payments/pay_1/refund",
+		Route:   "/payments/:id/refund",
+		Headers: http.Header{"Content-Type": {"application/json"}},
+		Body:    `{"amount": 100.50}`,
+	},
+	{
+		ID:      2,
+		Method:  "POST",
+		Path:    "/payments/pay_2/refund",
+		Route:   "/payments/:id/refund",
+		Headers: http.Header{"Content-Type": {"application/json"}},
+		Body:    `{"amount": 5}`,
+	},
+	{
+		ID:     3,
+		Method: "GET",
+		Path:   "/payments/pay_1",
+		Route:  "/payments/:id",
+	},
+}
+
+func parse(t *testing.T, data string) Verification {
+	var v Verification
+	require.Nil(t, json.Unmarshal([]byte(data), &v), "invalid verification")
+	return v
+}
+
+func TestVerifyExactlyOnce(t *testing.T) {
+	v := parse(t, `{
+		"method": "POST",
+		"path": "/payments/:id/refund",
+		"headers": {"content-type": {"equals": "application/json"}},
+		"body": {"equalJson": {"amount": 100.5}},
+		"count": {"exactly": 1}
+	}`)
+
+	report := Verify(entries, v)
+	assert.True(t, report.OK, report.Message)
+	assert.Equal(t, []int64{1}, report.MatchedIDs, "wrong request matched")
+	assert.Empty(t, report.NearMisses, "near misses reported on success")
+}
+
+func TestVerifyReportsNearMisses(t *testing.T) {
+	v := parse(t, `{
+		"method": "POST",
+		"path": "/payments/pay_3/refund",
+		"body": {"contains": "100.50"}
+	}`)
+
+	report := Verify(entries, v)
+	assert.False(t, report.OK, "verification should fail")
+	assert.Equal(t, 0, report.Matched, "nothing should match")
+	require.Len(t, report.NearMisses, 2, "near misses")
+
+	closest := report.NearMisses[0]
+	assert.Equal(t, int64(1), closest.Entry.ID, "closest near miss is not first")
+	assert.Equal(t, []string{"path: expected /payments/pay_3/refund, got /payments/pay_1/refund"}, closest.Mismatches)
+}
+
+func TestVerifyCount(t *testing.T) {
+	v := parse(t, `{"method": "POST", "count": {"atMost": 1}}`)
+
+	report := Verify(entries, v)
+	assert.False(t, report.OK, "too many requests should fail")
+	assert.Equal(t, "at most 1", report.Expected)
+	assert.Equal(t, 2, report.Matched)
+
+	v = parse(t, `{"method": "DELETE", "count": {"exactly": 0}}`)
+	assert.True(t, Verify(entries, v).OK, "no requests should pass")
+}
+
+func TestMatchPath(t *testing.T) {
+	assert.True(t, matchPath("/payments/:id", "/payments/pay_1"))
+	assert.True(t, matchPath("/static/*file", "/static/css/site.css"))
+	assert.False(t, matchPath("/payments/:id", "/payments/pay_1/refund"))
+	assert.False(t, matchPath("/payments/:id/refund", "/payments/pay_1"))
+}
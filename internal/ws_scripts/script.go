@@ -0,0 +1,243 @@
+package ws_scripts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/crit/fake-ops/internal/http_results"
+	"gopkg.in/yaml.v3"
+)
+
+// Script is parsed from a websocket script file. It holds the conversation a
+// client connecting to Path has with the service.
+//
+//	path: /ws/prices
+//	onConnect:
+//	  - send: '{"type": "welcome"}'
+//	replies:
+//	  - match: '"type":\s*"ping"'
+//	    send: '{"type": "pong"}'
+//	pushes:
+//	  - every: 5s
+//	    send: '{"type": "price", "value": {{.Count}}}'
+type Script struct {
+	// Path is the route clients connect to. Defaults to /.
+	Path string `yaml:"path"`
+
+	// OnConnect is sent, in order, as soon as a client connects.
+	OnConnect []*Message `yaml:"onConnect"`
+
+	// Replies answer incoming messages. The first that matches is used.
+	Replies []*Reply `yaml:"replies"`
+
+	// Pushes are sent periodically while the client is connected.
+	Pushes []*Push `yaml:"pushes"`
+
+	// Close ends every conversation after a while.
+	Close *Close `yaml:"close"`
+
+	// File is the script file this Script was parsed from, when known.
+	File string `yaml:"-"`
+}
+
+// Message is sent to the client. Send is a template, rendered with Data.
+// Instead of sending, a Message can close the connection.
+type Message struct {
+	Send string `yaml:"send"`
+
+	// Delay is waited before sending.
+	Delay time.Duration `yaml:"delay"`
+
+	// Close closes the connection instead of sending.
+	Close *Close `yaml:"close"`
+
+	tmpl *template.Template
+}
+
+// Reply answers incoming messages matching the regular expression Match, or
+// every message when it is empty, with a Message or several.
+type Reply struct {
+	Match string `yaml:"match"`
+
+	Message `yaml:",inline"`
+
+	// Messages are sent after the inline Message.
+	Messages []*Message `yaml:"messages"`
+
+	match *regexp.Regexp
+}
+
+// Push sends a Message every interval.
+type Push struct {
+	Every time.Duration `yaml:"every"`
+
+	Message `yaml:",inline"`
+
+	// Times limits how often it is sent. Forever when 0.
+	Times int `yaml:"times"`
+}
+
+// Close closes a connection with a close code and reason.
+type Close struct {
+	// After is how long into the conversation the connection is closed, for
+	// the Close of a Script.
+	After time.Duration `yaml:"after"`
+
+	// Code defaults to 1000, a normal closure.
+	Code   int    `yaml:"code"`
+	Reason string `yaml:"reason"`
+}
+
+// Data is what message templates are rendered with.
+type Data struct {
+	// Request is the request the connection was opened with.
+	http_results.Request
+
+	// Message is the incoming message being replied to.
+	Message string
+
+	// JSON is Message decoded, when it is JSON.
+	JSON any
+
+	// Groups are the submatches of the reply's Match in Message.
+	Groups []string
+
+	// Count is how many times a push was sent, including this one, or how many
+	// messages were received.
+	Count int
+}
+
+// Parse takes in the content of a websocket script file and creates a Script.
+func Parse(data []byte) (*Script, error) {
+	var s Script
+
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid script: %s", err)
+	}
+
+	if s.Path == "" {
+		s.Path = "/"
+	}
+
+	if !strings.HasPrefix(s.Path, "/") {
+		return nil, fmt.Errorf("invalid path, it must start with /: %s", s.Path)
+	}
+
+	for _, m := range s.OnConnect {
+		if err := m.compile(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range s.Replies {
+		var err error
+		if r.match, err = regexp.Compile(r.Match); err != nil {
+			return nil, fmt.Errorf("invalid reply match %q: %s", r.Match, err)
+		}
+
+		for _, m := range r.Sends() {
+			if err := m.compile(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, p := range s.Pushes {
+		if p.Every <= 0 {
+			return nil, fmt.Errorf("push needs an interval in every")
+		}
+
+		if err := p.compile(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Close != nil {
+		if s.Close.After <= 0 {
+			return nil, fmt.Errorf("close needs a duration in after")
+		}
+
+		if err := s.Close.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+// Reply finds the reply to message, with the submatches of its Match.
+func (s *Script) Reply(message string) (*Reply, []string) {
+	for _, r := range s.Replies {
+		if groups := r.match.FindStringSubmatch(message); groups != nil {
+			return r, groups
+		}
+	}
+
+	return nil, nil
+}
+
+// Sends returns the messages of the reply in order: the inline one, when it
+// sends or closes, then Messages.
+func (r *Reply) Sends() []*Message {
+	var sends []*Message
+	if r.Send != "" || r.Close != nil {
+		sends = append(sends, &r.Message)
+	}
+
+	return append(sends, r.Messages...)
+}
+
+// compile prepares the template used by Render.
+func (m *Message) compile() error {
+	if m.Close != nil {
+		return m.Close.validate()
+	}
+
+	var err error
+	if m.tmpl, err = template.New("send").Funcs(http_results.TemplateFuncs()).Parse(m.Send); err != nil {
+		return fmt.Errorf("invalid message template: %s", err)
+	}
+
+	return nil
+}
+
+// Render creates the message to send.
+func (m *Message) Render(data Data) (string, error) {
+	if m.tmpl == nil {
+		return m.Send, nil
+	}
+
+	var buf bytes.Buffer
+	if err := m.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render message: %s", err)
+	}
+
+	return buf.String(), nil
+}
+
+// NewData creates the data templates replying to message are rendered with.
+func NewData(req http_results.Request, message string, groups []string, count int) Data {
+	data := Data{Request: req, Message: message, Groups: groups, Count: count}
+	_ = json.Unmarshal([]byte(message), &data.JSON)
+
+	return data
+}
+
+func (c *Close) validate() error {
+	if c.Code == 0 {
+		c.Code = 1000
+	}
+
+	// 1000-1003, 1007-1014 are sent by endpoints, 3000-4999 by applications
+	switch {
+	case c.Code >= 1000 && c.Code <= 1003, c.Code >= 1007 && c.Code <= 1014, c.Code >= 3000 && c.Code <= 4999:
+		return nil
+	default:
+		return fmt.Errorf("invalid close code: %d", c.Code)
+	}
+}
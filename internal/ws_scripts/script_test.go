@@ -0,0 +1,101 @@
+package ws_scripts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crit/fake-ops/internal/http_results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const script = `
+path: /ws/rooms/:room
+onConnect:
+  - send: 'welcome to {{.Params.room}}'
+replies:
+  - match: '"type":\s*"subscribe",\s*"symbol":\s*"(\w+)"'
+    send: '{"type": "subscribed", "symbol": "{{index .Groups 1}}"}'
+    messages:
+      - send: '{"type": "price", "symbol": "{{.JSON.symbol}}"}'
+        delay: 100ms
+  - match: ^bye$
+    close: {code: 4000, reason: bye}
+  - send: 'echo {{.Message}}'
+pushes:
+  - every: 1s
+    times: 3
+    send: 'tick {{.Count}}'
+close:
+  after: 1m
+  code: 1001
+`
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(script))
+	require.Nil(t, err, "error parsing script")
+
+	assert.Equal(t, "/ws/rooms/:room", s.Path)
+	assert.Equal(t, time.Minute, s.Close.After)
+	assert.Equal(t, 1001, s.Close.Code)
+
+	req := http_results.Request{Params: map[string]string{"room": "lobby"}}
+
+	welcome, err := s.OnConnect[0].Render(NewData(req, "", nil, 0))
+	require.Nil(t, err, "error rendering welcome")
+	assert.Equal(t, "welcome to lobby", welcome)
+
+	message := `{"type": "subscribe", "symbol": "ACME"}`
+	reply, groups := s.Reply(message)
+	require.NotNil(t, reply, "subscribe should be answered")
+
+	sends := reply.Sends()
+	require.Len(t, sends, 2)
+	assert.Equal(t, 100*time.Millisecond, sends[1].Delay)
+
+	data := NewData(req, message, groups, 1)
+	first, err := sends[0].Render(data)
+	require.Nil(t, err, "error rendering reply")
+	assert.Equal(t, `{"type": "subscribed", "symbol": "ACME"}`, first)
+
+	second, err := sends[1].Render(data)
+	require.Nil(t, err, "error rendering reply")
+	assert.Equal(t, `{"type": "price", "symbol": "ACME"}`, second)
+
+	reply, _ = s.Reply("bye")
+	require.NotNil(t, reply, "bye should be answered")
+	assert.Equal(t, &Close{Code: 4000, Reason: "bye"}, reply.Sends()[0].Close)
+
+	reply, _ = s.Reply("hello")
+	require.NotNil(t, reply, "a reply without match answers everything")
+	echo, err := reply.Sends()[0].Render(NewData(req, "hello", nil, 1))
+	require.Nil(t, err, "error rendering echo")
+	assert.Equal(t, "echo hello", echo)
+
+	tick, err := s.Pushes[0].Render(NewData(req, "", nil, 2))
+	require.Nil(t, err, "error rendering push")
+	assert.Equal(t, "tick 2", tick)
+	assert.Equal(t, 3, s.Pushes[0].Times)
+
+	s, err = Parse([]byte("onConnect: [{send: hi}]"))
+	require.Nil(t, err, "error parsing script without path")
+	assert.Equal(t, "/", s.Path)
+	assert.Empty(t, s.Replies)
+
+	tests := map[string]string{
+		"invalid yaml":        "replies: [",
+		"invalid path":        "path: ws",
+		"invalid match":       "replies: [{match: '[', send: x}]",
+		"invalid template":    "onConnect: [{send: '{{.Nope'}]",
+		"push without every":  "pushes: [{send: x}]",
+		"close without after": "close: {code: 1000}",
+		"invalid close code":  "replies: [{close: {code: 1005}}]",
+	}
+
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(file))
+			assert.NotNil(t, err)
+		})
+	}
+}
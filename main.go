@@ -4,13 +4,14 @@ import (
 	"fmt"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/crit/fake-ops/internal/admin"
 	"github.com/crit/fake-ops/internal/app"
 	"github.com/crit/fake-ops/internal/services"
 	"github.com/crit/fake-ops/internal/ui"
 	"github.com/gin-gonic/gin"
 )
 
-// ./main --services=./services --results=./results
+// ./main --services=./services --results=./results --scenario=slow-users --admin=:4000
 func main() {
 	// silence gin's debug messages
 	gin.SetMode(gin.ReleaseMode)
@@ -41,11 +42,22 @@ func startServices(ctx *app.Context) {
 		ctx.PublishError("failed to list services: %s", err)
 	}
 
+	// tell me what scenarios can be switched to
+	scenarios, err := services.ListScenarios(ctx.Flags.Results)
+	if err != nil {
+		ctx.PublishError("failed to list scenarios: %s", err)
+	}
+
+	if err := ctx.SetScenarios(scenarios); err != nil {
+		ctx.PublishError("%s", err)
+	}
+
 	// start each service with the files it needs
-	for _, service := range list {
-		err := services.Run(ctx, service)
-		if err != nil {
-			ctx.PublishError("failed to start service %s: %s", service.Name, err)
-		}
+	manager := services.NewManager(ctx, list)
+	manager.Start()
+
+	// let test suites drive the services
+	if ctx.Flags.Admin != "" {
+		admin.Start(ctx, manager)
 	}
 }